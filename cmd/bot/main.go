@@ -20,6 +20,8 @@ import (
 	jconfig "github.com/uber/jaeger-client-go/config"
 	"go.uber.org/zap"
 
+	"max.ks1230/finances-bot/internal/clients/cbr"
+	"max.ks1230/finances-bot/internal/clients/ecb"
 	"max.ks1230/finances-bot/internal/clients/fixer"
 	"max.ks1230/finances-bot/internal/clients/tg"
 	"max.ks1230/finances-bot/internal/config"
@@ -49,9 +51,12 @@ func main() {
 		logger.Fatal("failed to init client:", zap.Error(err))
 	}
 
-	fixerClient := fixer.New(conf.Fixer())
+	ratesChain, err := newRatesChain(conf)
+	if err != nil {
+		logger.Fatal("failed to init rate providers:", zap.Error(err))
+	}
 
-	userStorage, err := storage.NewPostgresStorage(conf.Postgres())
+	userStorage, err := storage.NewPostgresStorage(conf.Postgres(), conf.App())
 	if err != nil {
 		logger.Fatal("failed to init postgres:", zap.Error(err))
 	}
@@ -67,16 +72,18 @@ func main() {
 	}
 	defer producer.Close()
 
-	msgService := messages.NewService(conf.App(), tgClient, userStorage, reportCache, producer)
-
-	reportAcceptor, err := reports.NewServer(grpcPort, msgService)
+	ratesPuller, err := rates.NewPuller(userStorage, ratesChain, conf.App())
 	if err != nil {
-		logger.Fatal("failed to init grpc server:", zap.Error(err))
+		logger.Fatal("failed to init puller:", zap.Error(err))
 	}
 
-	ratesPuller, err := rates.NewPuller(userStorage, fixerClient, conf.App())
+	ratesCompactor := rates.NewCompactor(userStorage, conf.App())
+
+	msgService := messages.NewService(conf.App(), tgClient, userStorage, ratesPuller, reportCache, producer)
+
+	reportAcceptor, err := reports.NewServer(grpcPort, msgService)
 	if err != nil {
-		logger.Fatal("failed to init puller:", zap.Error(err))
+		logger.Fatal("failed to init grpc server:", zap.Error(err))
 	}
 
 	logger.Info("App init - end")
@@ -92,12 +99,35 @@ func main() {
 	)
 
 	go ratesPuller.Pull(ctx)
+	go ratesCompactor.Run(ctx)
+	go msgService.RunRecurring(ctx)
 	go reportAcceptor.Serve()
 	defer reportAcceptor.Shutdown()
 
 	tgClient.ListenUpdates(ctx, msgService)
 }
 
+// newRatesChain builds the chain of rate providers in the configured order.
+func newRatesChain(conf *config.Service) (*rates.Chain, error) {
+	names := conf.App().RateProviders()
+	sources := make([]rates.Source, 0, len(names))
+	for _, name := range names {
+		var source rates.Source
+		switch name {
+		case "fixer":
+			source = rates.Source{Name: name, Provider: fixer.New(conf.Fixer())}
+		case "cbr":
+			source = rates.Source{Name: name, Provider: cbr.New(conf.CBR())}
+		case "ecb":
+			source = rates.Source{Name: name, Provider: ecb.New(conf.ECB())}
+		default:
+			return nil, fmt.Errorf("unknown rate provider %s", name)
+		}
+		sources = append(sources, source)
+	}
+	return rates.NewChain(sources...), nil
+}
+
 func cancelOnSignals(cancel context.CancelFunc, signals ...os.Signal) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, signals...)
@@ -24,7 +24,7 @@ func main() {
 		logger.Fatal("failed to init config:", zap.Error(err))
 	}
 
-	db, err := storage.NewPostgresStorage(conf.Postgres())
+	db, err := storage.NewPostgresStorage(conf.Postgres(), conf.App())
 	if err != nil {
 		logger.Fatal("failed to init postgres:", zap.Error(err))
 	}
@@ -13,6 +13,10 @@ import (
 
 var defaultBase = 10
 
+// reports of named periods change when period boundaries move,
+// so they are not kept longer than an hour
+const reportExpirationSeconds = 60 * 60
+
 type MemcacheClient struct {
 	client *memcache.Client
 }
@@ -34,9 +38,10 @@ func formatKey(userID int64, option string) string {
 func (mc *MemcacheClient) CacheReport(userID int64, option string, report string) error {
 	logger.Info("cache report", zap.Int64("userID", userID), zap.String("option", option))
 	return mc.client.Set(&memcache.Item{
-		Key:   formatKey(userID, option),
-		Value: []byte(report)},
-	)
+		Key:        formatKey(userID, option),
+		Value:      []byte(report),
+		Expiration: reportExpirationSeconds,
+	})
 }
 
 func (mc *MemcacheClient) GetReport(userID int64, option string) (string, error) {
@@ -0,0 +1,131 @@
+package cbr
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"golang.org/x/net/html/charset"
+
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/logger"
+
+	"github.com/pkg/errors"
+	"max.ks1230/finances-bot/internal/entity/currency"
+)
+
+const (
+	defaultBaseURL = "https://www.cbr.ru/scripts"
+	dailyRatesPath = "/XML_daily.asp"
+	dateParam      = "date_req"
+	dateLayout     = "02/01/2006"
+)
+
+type config interface {
+	BaseURL() string
+}
+
+// Client pulls official rates of the Central Bank of Russia, quoted in rubles.
+type Client struct {
+	baseURL string
+}
+
+type valCurs struct {
+	Date    string   `xml:"Date,attr"`
+	Valutes []valute `xml:"Valute"`
+}
+
+type valute struct {
+	CharCode string `xml:"CharCode"`
+	Nominal  int64  `xml:"Nominal"`
+	// Value is the price of nominal units in rubles with a decimal comma
+	Value string `xml:"Value"`
+}
+
+func New(config config) *Client {
+	baseURL := strings.TrimSuffix(config.BaseURL(), "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &Client{baseURL: baseURL}
+}
+
+func (c *Client) GetRates(ctx context.Context, baseRate string, relativeRates []string) (map[string]float64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "cbrGetRates")
+	defer span.Finish()
+
+	return c.requestRates(ctx, nil, baseRate, relativeRates)
+}
+
+// GetHistoricalRates returns rates set for the given day.
+func (c *Client) GetHistoricalRates(ctx context.Context, baseRate string, relativeRates []string,
+	date time.Time) (map[string]float64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "cbrGetHistoricalRates")
+	defer span.Finish()
+
+	return c.requestRates(ctx, &date, baseRate, relativeRates)
+}
+
+func (c *Client) requestRates(ctx context.Context, date *time.Time, baseRate string,
+	relativeRates []string) (map[string]float64, error) {
+	client := &http.Client{}
+
+	url := c.baseURL + dailyRatesPath
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cbr client")
+	}
+	if date != nil {
+		q := req.URL.Query()
+		q.Add(dateParam, date.Format(dateLayout))
+		req.URL.RawQuery = q.Encode()
+	}
+
+	logger.Info("request cbr", zap.String("url", url))
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cbr client")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error from cbr (status = %d)", res.StatusCode)
+	}
+
+	// the feed is encoded in windows-1251
+	decoder := xml.NewDecoder(res.Body)
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	curs := valCurs{}
+	err = decoder.Decode(&curs)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling response")
+	}
+	logger.Info("response from cbr", zap.String("date", curs.Date), zap.Int("rates", len(curs.Valutes)))
+
+	anchored, err := unitsPerRuble(curs.Valutes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cbr client")
+	}
+	return currency.CrossRates(anchored, baseRate, relativeRates)
+}
+
+// unitsPerRuble returns how many units of every currency one ruble buys.
+func unitsPerRuble(valutes []valute) (map[string]float64, error) {
+	res := make(map[string]float64, len(valutes)+1)
+	res[currency.RUB] = 1
+	for _, v := range valutes {
+		value, err := strconv.ParseFloat(strings.Replace(v.Value, ",", ".", 1), 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s rate", v.CharCode)
+		}
+		if value <= 0 || v.Nominal <= 0 {
+			continue
+		}
+		res[v.CharCode] = float64(v.Nominal) / value
+	}
+	return res, nil
+}
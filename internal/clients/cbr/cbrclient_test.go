@@ -0,0 +1,59 @@
+package cbr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// names are encoded in windows-1251 as the real feed does
+const dailyXML = `<?xml version="1.0" encoding="windows-1251"?>
+<ValCurs Date="01.09.2022" name="Foreign Currency Market">
+<Valute ID="R01235"><NumCode>840</NumCode><CharCode>USD</CharCode><Nominal>1</Nominal>` +
+	"<Name>\xc4\xee\xeb\xeb\xe0\xf0 \xd1\xd8\xc0</Name>" + `<Value>60,3677</Value></Valute>
+<Valute ID="R01375"><NumCode>156</NumCode><CharCode>CNY</CharCode><Nominal>10</Nominal>` +
+	"<Name>\xce\xf4\xe8\xf1</Name>" + `<Value>87,5000</Value></Valute>
+</ValCurs>`
+
+type testConfig string
+
+func (c testConfig) BaseURL() string {
+	return string(c)
+}
+
+func newTestServer(t *testing.T, wantDate string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/XML_daily.asp", r.URL.Path)
+		assert.Equal(t, wantDate, r.URL.Query().Get("date_req"))
+		w.Header().Set("Content-Type", "application/xml; charset=windows-1251")
+		_, _ = w.Write([]byte(dailyXML))
+	}))
+}
+
+func Test_OnGetRates_ShouldConvertRublePricesToRates(t *testing.T) {
+	server := newTestServer(t, "")
+	defer server.Close()
+
+	rates, err := New(testConfig(server.URL)).GetRates(context.Background(), "RUB", []string{"USD", "CNY", "EUR"})
+
+	assert.NoError(t, err)
+	assert.Len(t, rates, 2)
+	assert.InDelta(t, 1/60.3677, rates["USD"], 1e-12)
+	assert.InDelta(t, 10/87.5, rates["CNY"], 1e-12)
+}
+
+func Test_OnGetHistoricalRates_ShouldRequestDayAndCrossRates(t *testing.T) {
+	server := newTestServer(t, "01/09/2022")
+	defer server.Close()
+
+	date := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	rates, err := New(testConfig(server.URL)).GetHistoricalRates(context.Background(), "USD", []string{"RUB", "CNY"}, date)
+
+	assert.NoError(t, err)
+	assert.InDelta(t, 60.3677, rates["RUB"], 1e-9)
+	assert.InDelta(t, 60.3677/8.75, rates["CNY"], 1e-9)
+}
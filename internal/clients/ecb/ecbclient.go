@@ -0,0 +1,143 @@
+package ecb
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/logger"
+
+	"github.com/pkg/errors"
+	"max.ks1230/finances-bot/internal/entity/currency"
+)
+
+const (
+	defaultBaseURL = "https://www.ecb.europa.eu/stats/eurofxref"
+	dailyRatesPath = "/eurofxref-daily.xml"
+	// recentRatesPath covers the last 90 days, allRatesPath the whole history since 1999
+	recentRatesPath = "/eurofxref-hist-90d.xml"
+	allRatesPath    = "/eurofxref-hist.xml"
+	recentDays      = 90
+	dayLayout       = "2006-01-02"
+)
+
+type config interface {
+	BaseURL() string
+}
+
+// Client pulls euro foreign exchange reference rates of the European Central Bank.
+// They are published on working days only.
+type Client struct {
+	baseURL string
+	clock   func() time.Time
+}
+
+type envelope struct {
+	Days []day `xml:"Cube>Cube"`
+}
+
+type day struct {
+	Time  string `xml:"time,attr"`
+	Rates []struct {
+		Currency string  `xml:"currency,attr"`
+		Rate     float64 `xml:"rate,attr"`
+	} `xml:"Cube"`
+}
+
+func New(config config) *Client {
+	baseURL := strings.TrimSuffix(config.BaseURL(), "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &Client{baseURL: baseURL, clock: time.Now}
+}
+
+func (c *Client) GetRates(ctx context.Context, baseRate string, relativeRates []string) (map[string]float64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ecbGetRates")
+	defer span.Finish()
+
+	days, err := c.requestDays(ctx, dailyRatesPath)
+	if err != nil {
+		return nil, err
+	}
+	return crossRatesAt(days, c.clock(), baseRate, relativeRates)
+}
+
+// GetHistoricalRates returns rates of the given day or the last working day before it.
+func (c *Client) GetHistoricalRates(ctx context.Context, baseRate string, relativeRates []string,
+	date time.Time) (map[string]float64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ecbGetHistoricalRates")
+	defer span.Finish()
+
+	path := allRatesPath
+	// one day less to be sure the recent file still has the day before the date
+	if c.clock().Sub(date) < (recentDays-1)*24*time.Hour {
+		path = recentRatesPath
+	}
+	days, err := c.requestDays(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return crossRatesAt(days, date, baseRate, relativeRates)
+}
+
+func (c *Client) requestDays(ctx context.Context, path string) ([]day, error) {
+	client := &http.Client{}
+
+	url := c.baseURL + path
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "ecb client")
+	}
+
+	logger.Info("request ecb", zap.String("url", url))
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "ecb client")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error from ecb (status = %d)", res.StatusCode)
+	}
+
+	env := envelope{}
+	err = xml.NewDecoder(res.Body).Decode(&env)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling response")
+	}
+	logger.Info("response from ecb", zap.Int("days", len(env.Days)))
+
+	return env.Days, nil
+}
+
+// crossRatesAt takes the latest day not after the date and converts its rates to the base currency.
+func crossRatesAt(days []day, date time.Time, baseRate string, relativeRates []string) (map[string]float64, error) {
+	// ISO dates compare as strings, the date keeps its own day regardless of location
+	at := date.Format(dayLayout)
+	var latest *day
+	for i := range days {
+		if days[i].Time > at {
+			continue
+		}
+		if latest == nil || days[i].Time > latest.Time {
+			latest = &days[i]
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("ecb has no rates at %s", at)
+	}
+
+	// reference rates are units of a currency per one euro
+	anchored := make(map[string]float64, len(latest.Rates)+1)
+	anchored[currency.EUR] = 1
+	for _, r := range latest.Rates {
+		anchored[r.Currency] = r.Rate
+	}
+	return currency.CrossRates(anchored, baseRate, relativeRates)
+}
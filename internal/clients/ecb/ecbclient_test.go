@@ -0,0 +1,81 @@
+package ecb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const histXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2022-09-02">
+			<Cube currency="USD" rate="0.9993"/>
+			<Cube currency="CNY" rate="6.8949"/>
+		</Cube>
+		<Cube time="2022-09-01">
+			<Cube currency="USD" rate="1.0"/>
+			<Cube currency="CNY" rate="6.9"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+type testConfig string
+
+func (c testConfig) BaseURL() string {
+	return string(c)
+}
+
+func newTestServer(t *testing.T, wantPath string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, wantPath, r.URL.Path)
+		_, _ = w.Write([]byte(histXML))
+	}))
+}
+
+func Test_OnGetRates_ShouldCrossRatesToBase(t *testing.T) {
+	server := newTestServer(t, "/eurofxref-daily.xml")
+	defer server.Close()
+
+	client := New(testConfig(server.URL))
+	client.clock = func() time.Time { return time.Date(2022, 9, 2, 16, 0, 0, 0, time.UTC) }
+	rates, err := client.GetRates(context.Background(), "USD", []string{"EUR", "CNY", "RUB"})
+
+	assert.NoError(t, err)
+	assert.Len(t, rates, 2)
+	assert.InDelta(t, 1/0.9993, rates["EUR"], 1e-12)
+	assert.InDelta(t, 6.8949/0.9993, rates["CNY"], 1e-12)
+}
+
+func Test_OnGetHistoricalRates_ShouldTakeLastWorkingDayBeforeDate(t *testing.T) {
+	server := newTestServer(t, "/eurofxref-hist.xml")
+	defer server.Close()
+
+	client := New(testConfig(server.URL))
+	client.clock = func() time.Time { return time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC) }
+	// Sep 1st in Moscow is still Aug 31st in UTC, yet the day of the date is taken
+	moscow := time.FixedZone("MSK", 3*60*60)
+	rates, err := client.GetHistoricalRates(context.Background(), "EUR", []string{"USD"},
+		time.Date(2022, 9, 1, 0, 0, 0, 0, moscow))
+
+	assert.NoError(t, err)
+	assert.InDelta(t, 1.0, rates["USD"], 1e-12)
+}
+
+func Test_OnGetHistoricalRates_ShouldUseRecentFileForRecentDates(t *testing.T) {
+	server := newTestServer(t, "/eurofxref-hist-90d.xml")
+	defer server.Close()
+
+	client := New(testConfig(server.URL))
+	client.clock = func() time.Time { return time.Date(2022, 9, 10, 0, 0, 0, 0, time.UTC) }
+	rates, err := client.GetHistoricalRates(context.Background(), "EUR", []string{"USD"},
+		time.Date(2022, 9, 4, 0, 0, 0, 0, time.UTC))
+
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.9993, rates["USD"], 1e-12)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 
@@ -16,17 +17,21 @@ import (
 )
 
 const (
-	latestRatesURL = "https://api.apilayer.com/fixer/latest"
-	baseParam      = "base"
-	relativesParam = "symbols"
+	defaultBaseURL   = "https://api.apilayer.com/fixer"
+	latestRatesPath  = "/latest"
+	historicalLayout = "2006-01-02"
+	baseParam        = "base"
+	relativesParam   = "symbols"
 )
 
-type apiKeyGetter interface {
+type config interface {
 	APIKey() string
+	BaseURL() string
 }
 
 type Client struct {
-	apiKey string
+	apiKey  string
+	baseURL string
 }
 
 type ratesResponse struct {
@@ -36,17 +41,35 @@ type ratesResponse struct {
 	Timestamp int64              `json:"timestamp"`
 }
 
-func New(getter apiKeyGetter) *Client {
-	return &Client{apiKey: getter.APIKey()}
+func New(config config) *Client {
+	baseURL := strings.TrimSuffix(config.BaseURL(), "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &Client{apiKey: config.APIKey(), baseURL: baseURL}
 }
 
 func (c *Client) GetRates(ctx context.Context, baseRate string, relativeRates []string) (map[string]float64, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "fixerGetRates")
 	defer span.Finish()
 
+	return c.requestRates(ctx, c.baseURL+latestRatesPath, baseRate, relativeRates)
+}
+
+// GetHistoricalRates returns rates at the end of the given day.
+func (c *Client) GetHistoricalRates(ctx context.Context, baseRate string, relativeRates []string,
+	date time.Time) (map[string]float64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "fixerGetHistoricalRates")
+	defer span.Finish()
+
+	return c.requestRates(ctx, c.baseURL+"/"+date.Format(historicalLayout), baseRate, relativeRates)
+}
+
+func (c *Client) requestRates(ctx context.Context, url string, baseRate string,
+	relativeRates []string) (map[string]float64, error) {
 	client := &http.Client{}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", latestRatesURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "fixer client")
 	}
@@ -57,7 +80,7 @@ func (c *Client) GetRates(ctx context.Context, baseRate string, relativeRates []
 	q.Add(relativesParam, strings.Join(relativeRates, ","))
 	req.URL.RawQuery = q.Encode()
 
-	logger.Info("request fixer")
+	logger.Info("request fixer", zap.String("url", url))
 	res, err := client.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "fixer client")
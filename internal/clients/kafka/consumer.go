@@ -14,6 +14,7 @@ import (
 
 	"github.com/Shopify/sarama"
 	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/reports"
 )
 
 type consumerConfig interface {
@@ -22,7 +23,10 @@ type consumerConfig interface {
 }
 
 type reportGenerator interface {
-	GenerateReport(ctx context.Context, userID int64, period string) (report *apiv12.ReportResult, err error)
+	GenerateReport(ctx context.Context, userID int64, period string, rng reports.Range,
+		filter reports.Filter) (report *apiv12.ReportResult, err error)
+	GenerateExport(ctx context.Context, userID int64, period string, rng reports.Range,
+		format string) (report *apiv12.ReportResult, err error)
 }
 
 type reportSender interface {
@@ -96,7 +100,30 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 }
 
 func (c *Consumer) processRequest(ctx context.Context, req *apiv1.ReportRequest) {
-	report, _ := c.generator.GenerateReport(ctx, req.GetUserID(), req.GetPeriod())
+	var rng reports.Range
+	if req.GetFrom() != nil {
+		rng.From = req.GetFrom().AsTime()
+	}
+	if req.GetTo() != nil {
+		rng.To = req.GetTo().AsTime()
+	}
+	// export requests are the ones asking for a document format
+	if req.GetFormat() != "" {
+		report, _ := c.generator.GenerateExport(ctx, req.GetUserID(), req.GetPeriod(), rng, req.GetFormat())
+		c.sendReport(ctx, report)
+		return
+	}
+	filter := reports.Filter{
+		Account:   req.GetAccount(),
+		ByAccount: req.GetByAccount(),
+		Tag:       req.GetTag(),
+		Category:  req.GetCategory(),
+	}
+	report, _ := c.generator.GenerateReport(ctx, req.GetUserID(), req.GetPeriod(), rng, filter)
+	c.sendReport(ctx, report)
+}
+
+func (c *Consumer) sendReport(ctx context.Context, report *apiv12.ReportResult) {
 	err := c.sender.SendReport(ctx, report)
 	if err != nil {
 		logger.Error("failed to send report", zap.Error(err))
@@ -2,6 +2,8 @@ package tg
 
 import (
 	"context"
+	"io"
+	"net/http"
 	"time"
 
 	"go.uber.org/zap"
@@ -9,12 +11,17 @@ import (
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/pkg/errors"
+	"max.ks1230/finances-bot/internal/entity/response"
 	"max.ks1230/finances-bot/internal/model/messages"
 )
 
 const (
 	defaultUpdateOffset = 0
 	timeoutSeconds      = 5
+	// rows of documents are converted at the rates of their days, the missing ones are pulled
+	documentTimeoutSeconds = 30
+	downloadTimeoutSeconds = 30
+	maxDocumentSize        = 1 << 20
 )
 
 type tokenGetter interface {
@@ -41,6 +48,49 @@ func (c *Client) SendMessage(text string, userID int64) error {
 	return nil
 }
 
+func (c *Client) SendKeyboardMessage(text string, buttons []response.Button, userID int64) error {
+	msg := tgbotapi.NewMessage(userID, text)
+	msg.ReplyMarkup = keyboardMarkup(buttons)
+	_, err := c.client.Send(msg)
+	if err != nil {
+		return errors.Wrap(err, "client.Send")
+	}
+	return nil
+}
+
+func (c *Client) EditMessage(text string, buttons []response.Button, chatID int64, messageID int) error {
+	var edit tgbotapi.EditMessageTextConfig
+	if len(buttons) > 0 {
+		edit = tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, keyboardMarkup(buttons))
+	} else {
+		edit = tgbotapi.NewEditMessageText(chatID, messageID, text)
+	}
+	_, err := c.client.Send(edit)
+	if err != nil {
+		return errors.Wrap(err, "client.Send")
+	}
+	return nil
+}
+
+// SendDocument sends the file with an optional caption.
+func (c *Client) SendDocument(doc response.Document, caption string, userID int64) error {
+	msg := tgbotapi.NewDocument(userID, tgbotapi.FileBytes{Name: doc.Name, Bytes: doc.Content})
+	msg.Caption = caption
+	_, err := c.client.Send(msg)
+	if err != nil {
+		return errors.Wrap(err, "client.Send")
+	}
+	return nil
+}
+
+func keyboardMarkup(buttons []response.Button) tgbotapi.InlineKeyboardMarkup {
+	row := make([]tgbotapi.InlineKeyboardButton, 0, len(buttons))
+	for _, b := range buttons {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(b.Text, b.Data))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
 func (c *Client) ListenUpdates(ctx context.Context, msgModel *messages.Service) {
 	u := tgbotapi.NewUpdate(defaultUpdateOffset)
 	u.Timeout = 60
@@ -61,6 +111,14 @@ func (c *Client) ListenUpdates(ctx context.Context, msgModel *messages.Service)
 }
 
 func (c *Client) listenOnce(ctx context.Context, update tgbotapi.Update, msgModel *messages.Service) {
+	if update.CallbackQuery != nil {
+		c.handleCallback(ctx, update.CallbackQuery, msgModel)
+		return
+	}
+	if update.Message != nil && update.Message.Document != nil {
+		c.handleDocument(ctx, update.Message, msgModel)
+		return
+	}
 	if update.Message != nil {
 		logger.Info(update.Message.Text, zap.String("user", update.Message.From.UserName))
 
@@ -76,3 +134,90 @@ func (c *Client) listenOnce(ctx context.Context, update tgbotapi.Update, msgMode
 		}
 	}
 }
+
+// handleDocument downloads the file sent by user and handles it along with its caption.
+// The file content is left nil if it can't be downloaded, so user is answered anyway.
+func (c *Client) handleDocument(ctx context.Context, msg *tgbotapi.Message, msgModel *messages.Service) {
+	logger.Info(msg.Document.FileName, zap.String("user", msg.From.UserName))
+
+	doc := &response.Document{Name: msg.Document.FileName}
+	content, err := c.downloadFile(ctx, msg.Document.FileID, msg.Document.FileSize)
+	if err != nil {
+		logger.Error("error downloading document:", zap.Error(err))
+	} else {
+		doc.Content = content
+	}
+
+	// a slow download doesn't shorten the handling
+	ctx, cancel := context.WithTimeout(ctx, time.Second*documentTimeoutSeconds)
+	defer cancel()
+
+	err = msgModel.HandleIncomingMessage(ctx, messages.Message{
+		Text:     msg.Caption,
+		UserID:   msg.From.ID,
+		Document: doc,
+	})
+	if err != nil {
+		logger.Error("error processing document:", zap.Error(err))
+	}
+}
+
+func (c *Client) downloadFile(ctx context.Context, fileID string, size int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*downloadTimeoutSeconds)
+	defer cancel()
+
+	if size > maxDocumentSize {
+		return nil, errors.Errorf("file of %d bytes is too large", size)
+	}
+	url, err := c.client.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, errors.Wrap(err, "client.GetFileDirectURL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "download file")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "download file")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("download file: status %d", resp.StatusCode)
+	}
+
+	// one byte over the limit tells the file is too large
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "download file")
+	}
+	if len(content) > maxDocumentSize {
+		return nil, errors.New("file is too large")
+	}
+	return content, nil
+}
+
+func (c *Client) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery, msgModel *messages.Service) {
+	logger.Info(query.Data, zap.String("user", query.From.UserName))
+
+	// callback must be answered to stop the button loading animation
+	if _, err := c.client.Request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+		logger.Error("error answering callback:", zap.Error(err))
+	}
+	if query.Message == nil || query.Message.Chat == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*timeoutSeconds)
+	defer cancel()
+
+	err := msgModel.HandleIncomingMessage(ctx, messages.Message{
+		Text:          query.Data,
+		UserID:        query.From.ID,
+		EditMessageID: query.Message.MessageID,
+		ChatID:        query.Message.Chat.ID,
+	})
+	if err != nil {
+		logger.Error("error processing callback:", zap.Error(err))
+	}
+}
@@ -1,8 +1,42 @@
 package config
 
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"max.ks1230/finances-bot/internal/entity/currency"
+)
+
+const (
+	defaultWeekStartDay = time.Monday
+	daysInWeek          = 7
+)
+
+const defaultRatesRetentionDays = 30
+
+// Actions on converting with a rate older than the max rate age.
+const (
+	staleRateWarn   = "warn"
+	staleRateRefuse = "refuse"
+)
+
+var (
+	defaultLimitWarningThresholds = []int{50, 80, 100}
+	defaultRateProviders          = []string{"fixer"}
+)
+
 type AppConfig struct {
-	BaseCurrencyName        string `yaml:"base-currency"`
-	RatePullingDelayMinutes int64  `yaml:"rate-pulling-delay-minutes"`
+	BaseCurrencyName        string   `yaml:"base-currency"`
+	RatePullingDelayMinutes int64    `yaml:"rate-pulling-delay-minutes"`
+	TimezoneName            string   `yaml:"timezone"`
+	WeekStart               string   `yaml:"week-start-day"`
+	LimitWarningThresholds  []int    `yaml:"limit-warning-thresholds"`
+	CurrencyCodes           []string `yaml:"currencies"`
+	RateProviderNames       []string `yaml:"rate-providers"`
+	MaxRateAgeMinutes       int64    `yaml:"max-rate-age-minutes"`
+	StaleRateAction         string   `yaml:"stale-rate-action"`
+	RatesRetentionDays      int64    `yaml:"rates-retention-days"`
 }
 
 func (s *AppConfig) BaseCurrency() string {
@@ -12,3 +46,89 @@ func (s *AppConfig) BaseCurrency() string {
 func (s *AppConfig) PullingDelayMinutes() int64 {
 	return s.RatePullingDelayMinutes
 }
+
+// Location returns the default timezone, UTC if it is not set or unknown.
+func (s *AppConfig) Location() *time.Location {
+	loc, err := time.LoadLocation(s.TimezoneName)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// WeekStartDay returns the configured first day of week, Monday by default.
+func (s *AppConfig) WeekStartDay() time.Weekday {
+	for day := time.Sunday; day < daysInWeek; day++ {
+		if strings.EqualFold(s.WeekStart, day.String()) {
+			return day
+		}
+	}
+	return defaultWeekStartDay
+}
+
+// LimitThresholds returns percentages of month limit to warn at in soft limit mode.
+func (s *AppConfig) LimitThresholds() []int {
+	if len(s.LimitWarningThresholds) == 0 {
+		return defaultLimitWarningThresholds
+	}
+	return s.LimitWarningThresholds
+}
+
+// Currencies returns ISO 4217 codes of supported currencies, the default ones if not set.
+func (s *AppConfig) Currencies() []string {
+	if len(s.CurrencyCodes) == 0 {
+		return currency.DefaultCurrencies
+	}
+	return s.CurrencyCodes
+}
+
+// RateProviders returns names of rate providers in the order they are tried, fixer only by default.
+func (s *AppConfig) RateProviders() []string {
+	if len(s.RateProviderNames) == 0 {
+		return defaultRateProviders
+	}
+	return s.RateProviderNames
+}
+
+// MaxRateAge returns the age after which rates are considered stale, zero means they never are.
+func (s *AppConfig) MaxRateAge() time.Duration {
+	return time.Duration(s.MaxRateAgeMinutes) * time.Minute
+}
+
+// RefuseStaleRates tells whether conversions with stale rates are refused rather than warned about.
+func (s *AppConfig) RefuseStaleRates() bool {
+	return s.StaleRateAction == staleRateRefuse
+}
+
+// RatesRetention returns how long all pulled rates are kept, only daily ones are kept afterwards.
+// It is 30 days by default.
+func (s *AppConfig) RatesRetention() time.Duration {
+	days := s.RatesRetentionDays
+	if days <= 0 {
+		days = defaultRatesRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (s *AppConfig) validate() error {
+	switch s.StaleRateAction {
+	case "", staleRateWarn, staleRateRefuse:
+	default:
+		return fmt.Errorf("stale rate action should be either %s or %s", staleRateWarn, staleRateRefuse)
+	}
+
+	seen := make(map[string]struct{}, len(s.Currencies()))
+	for _, code := range s.Currencies() {
+		if _, ok := currency.Lookup(code); !ok {
+			return fmt.Errorf("unknown currency %s", code)
+		}
+		if _, ok := seen[code]; ok {
+			return fmt.Errorf("duplicate currency %s", code)
+		}
+		seen[code] = struct{}{}
+	}
+	if _, ok := seen[s.BaseCurrency()]; !ok {
+		return fmt.Errorf("base currency %s is not among supported ones", s.BaseCurrency())
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnRatesRetention_ShouldKeep30DaysByDefault(t *testing.T) {
+	assert.Equal(t, 30*24*time.Hour, (&AppConfig{}).RatesRetention())
+	assert.Equal(t, 7*24*time.Hour, (&AppConfig{RatesRetentionDays: 7}).RatesRetention())
+}
@@ -0,0 +1,10 @@
+package config
+
+type CBRConfig struct {
+	CBRBaseURL string `yaml:"base-url"`
+}
+
+// BaseURL returns the Central Bank of Russia scripts root, the client uses the public one if it is empty.
+func (c *CBRConfig) BaseURL() string {
+	return c.CBRBaseURL
+}
@@ -12,6 +12,8 @@ const configFile = "data/config.yaml"
 type config struct {
 	Telegram  TelegramConfig  `yaml:"telegram"`
 	Fixer     FixerConfig     `yaml:"fixer"`
+	CBR       CBRConfig       `yaml:"cbr"`
+	ECB       ECBConfig       `yaml:"ecb"`
 	App       AppConfig       `yaml:"app"`
 	Postgres  PostgresConfig  `yaml:"postgres"`
 	Memcached MemcachedConfig `yaml:"memcached"`
@@ -35,6 +37,11 @@ func New() (*Service, error) {
 		return nil, errors.Wrap(err, "parsing yaml")
 	}
 
+	err = s.config.App.validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "validating app config")
+	}
+
 	return s, nil
 }
 
@@ -46,6 +53,14 @@ func (s *Service) Fixer() *FixerConfig {
 	return &s.config.Fixer
 }
 
+func (s *Service) CBR() *CBRConfig {
+	return &s.config.CBR
+}
+
+func (s *Service) ECB() *ECBConfig {
+	return &s.config.ECB
+}
+
 func (s *Service) App() *AppConfig {
 	return &s.config.App
 }
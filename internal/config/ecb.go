@@ -0,0 +1,10 @@
+package config
+
+type ECBConfig struct {
+	ECBBaseURL string `yaml:"base-url"`
+}
+
+// BaseURL returns the ECB reference rates root, the client uses the public one if it is empty.
+func (c *ECBConfig) BaseURL() string {
+	return c.ECBBaseURL
+}
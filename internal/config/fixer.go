@@ -1,9 +1,15 @@
 package config
 
 type FixerConfig struct {
-	FixerAPIKey string `yaml:"api-key"`
+	FixerAPIKey  string `yaml:"api-key"`
+	FixerBaseURL string `yaml:"base-url"`
 }
 
 func (f *FixerConfig) APIKey() string {
 	return f.FixerAPIKey
 }
+
+// BaseURL returns the fixer API root, the client uses the public one if it is empty.
+func (f *FixerConfig) BaseURL() string {
+	return f.FixerBaseURL
+}
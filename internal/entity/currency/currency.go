@@ -1,6 +1,9 @@
 package currency
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 const (
 	RUB = "RUB"
@@ -9,11 +12,31 @@ const (
 	CNY = "CNY"
 )
 
-var Currencies = []string{RUB, USD, EUR, CNY}
+// DefaultCurrencies are supported unless configured otherwise
+var DefaultCurrencies = []string{RUB, USD, EUR, CNY}
 
 type Rate struct {
 	Name      string
 	BaseRate  float64
 	Set       bool
 	UpdatedAt time.Time
+	// Source names the provider the rate was pulled from
+	Source string
+}
+
+// CrossRates converts rates quoted against an anchor currency to the ones against the base.
+// Anchored rates are units of a currency per one anchor unit, the ones missing for relatives are skipped.
+func CrossRates(anchored map[string]float64, base string, relatives []string) (map[string]float64, error) {
+	baseRate, ok := anchored[base]
+	if !ok || baseRate == 0 {
+		return nil, fmt.Errorf("base currency %s is not quoted", base)
+	}
+
+	res := make(map[string]float64, len(relatives))
+	for _, curr := range relatives {
+		if rate, ok := anchored[curr]; ok {
+			res[curr] = rate / baseRate
+		}
+	}
+	return res, nil
 }
@@ -0,0 +1,20 @@
+package currency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnCrossRates_ShouldConvertAnchoredRatesToBase(t *testing.T) {
+	anchored := map[string]float64{EUR: 1, USD: 1.25, RUB: 100}
+
+	res, err := CrossRates(anchored, RUB, []string{USD, EUR, CNY})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{USD: 0.0125, EUR: 0.01}, res)
+}
+
+func Test_OnCrossRates_ShouldRejectUnquotedBase(t *testing.T) {
+	_, err := CrossRates(map[string]float64{EUR: 1}, RUB, []string{EUR})
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package currency
+
+import (
+	_ "embed" // embedded currencies table
+	"encoding/csv"
+	"strconv"
+	"strings"
+)
+
+//go:embed iso4217.csv
+var iso4217CSV string
+
+// Info describes an ISO 4217 currency.
+type Info struct {
+	Code string
+	// MinorDigits is the number of digits after the decimal separator
+	MinorDigits int
+	Symbol      string
+}
+
+var iso4217 = mustParseTable(iso4217CSV)
+
+// Lookup returns the ISO 4217 currency with the given alphabetic code.
+func Lookup(code string) (Info, bool) {
+	info, ok := iso4217[code]
+	return info, ok
+}
+
+func mustParseTable(raw string) map[string]Info {
+	records, err := csv.NewReader(strings.NewReader(raw)).ReadAll()
+	if err != nil {
+		panic("malformed iso 4217 table: " + err.Error())
+	}
+
+	res := make(map[string]Info, len(records))
+	// the first record is a header
+	for _, rec := range records[1:] {
+		digits, err := strconv.Atoi(rec[1])
+		if err != nil {
+			panic("malformed iso 4217 table: " + err.Error())
+		}
+		res[rec[0]] = Info{Code: rec[0], MinorDigits: digits, Symbol: rec[2]}
+	}
+	return res
+}
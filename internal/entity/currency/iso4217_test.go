@@ -0,0 +1,35 @@
+package currency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnLookup_ShouldReturnMinorDigitsAndSymbol(t *testing.T) {
+	rub, ok := Lookup("RUB")
+	assert.True(t, ok)
+	assert.Equal(t, Info{Code: "RUB", MinorDigits: 2, Symbol: "₽"}, rub)
+
+	jpy, ok := Lookup("JPY")
+	assert.True(t, ok)
+	assert.Equal(t, 0, jpy.MinorDigits)
+
+	kwd, ok := Lookup("KWD")
+	assert.True(t, ok)
+	assert.Equal(t, 3, kwd.MinorDigits)
+}
+
+func Test_OnLookup_ShouldRejectUnknownCodes(t *testing.T) {
+	for _, code := range []string{"", "rub", "XXX", "code"} {
+		_, ok := Lookup(code)
+		assert.False(t, ok, code)
+	}
+}
+
+func Test_DefaultCurrencies_ShouldBeKnown(t *testing.T) {
+	for _, code := range DefaultCurrencies {
+		_, ok := Lookup(code)
+		assert.True(t, ok, code)
+	}
+}
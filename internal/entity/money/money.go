@@ -0,0 +1,230 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MinorDigits is the number of minor unit digits every amount keeps,
+// the most of ISO 4217 currencies, so amounts of any of them are exact.
+const MinorDigits = 4
+
+const (
+	minorUnits = 10000
+	// maxIntegerDigits keeps amounts far from int64 overflow
+	maxIntegerDigits = 14
+	// stringDigits are the fraction digits always written, the rest are written if they are not zeros
+	stringDigits = 2
+)
+
+var errInvalidAmount = errors.New("invalid money amount")
+
+// Amount is an exact money amount in ten-thousandths of a currency unit.
+type Amount int64
+
+// Parse parses a decimal amount like "123", "123.4" or "123,45".
+// Extra fraction digits are rounded half away from zero.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	intPart, fracPart, _ := strings.Cut(strings.Replace(s, ",", ".", 1), ".")
+	if intPart == "" && fracPart == "" || len(intPart) > maxIntegerDigits ||
+		!isDigits(intPart) || !isDigits(fracPart) {
+		return 0, errors.Wrap(errInvalidAmount, s)
+	}
+
+	var res int64
+	if intPart != "" {
+		res, _ = strconv.ParseInt(intPart, 10, 64)
+	}
+	res *= minorUnits
+
+	// the digit after minor ones decides the rounding
+	fracPart += strings.Repeat("0", MinorDigits+1)
+	minor, _ := strconv.ParseInt(fracPart[:MinorDigits], 10, 64)
+	res += minor
+	if fracPart[MinorDigits] >= '5' {
+		res++
+	}
+
+	if neg {
+		res = -res
+	}
+	return Amount(res), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromFloat converts a float amount rounding it half away from zero.
+func FromFloat(f float64) Amount {
+	return roundRat(new(big.Rat).Mul(ratOf(f), big.NewRat(minorUnits, 1)))
+}
+
+// Float returns an approximate float value of the amount, e.g. to compute ratios.
+func (a Amount) Float() float64 {
+	return float64(a) / minorUnits
+}
+
+// Mul multiplies the amount by the rate rounding the result half away from zero.
+func (a Amount) Mul(rate float64) Amount {
+	return roundRat(new(big.Rat).Mul(big.NewRat(int64(a), 1), ratOf(rate)))
+}
+
+// Div divides the amount by the rate rounding the result half away from zero.
+// Zero is returned for a zero rate.
+func (a Amount) Div(rate float64) Amount {
+	r := ratOf(rate)
+	if r.Sign() == 0 {
+		return 0
+	}
+	return roundRat(new(big.Rat).Quo(big.NewRat(int64(a), 1), r))
+}
+
+// String formats the amount exactly with at least 2 fraction digits, like 123.40 or 1.234.
+func (a Amount) String() string {
+	res := a.Format(MinorDigits)
+	for i := MinorDigits; i > stringDigits && strings.HasSuffix(res, "0"); i-- {
+		res = strings.TrimSuffix(res, "0")
+	}
+	return res
+}
+
+// Format formats the amount with the given number of fraction digits, e.g. currency minor ones.
+// Fewer digits than MinorDigits round the amount half away from zero, more are padded with zeros.
+func (a Amount) Format(digits int) string {
+	if digits > MinorDigits {
+		return a.Format(MinorDigits) + strings.Repeat("0", digits-MinorDigits)
+	}
+	if digits < 0 {
+		digits = 0
+	}
+
+	unit := digitsUnit(digits)
+	v := int64(a.Round(digits)) / unit
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	if digits == 0 {
+		return fmt.Sprintf("%s%d", sign, v)
+	}
+	scale := minorUnits / unit
+	return fmt.Sprintf("%s%d.%0*d", sign, v/scale, digits, v%scale)
+}
+
+// Round rounds the amount to the given number of fraction digits half away from zero.
+func (a Amount) Round(digits int) Amount {
+	if digits >= MinorDigits {
+		return a
+	}
+	unit := digitsUnit(digits)
+	return roundRat(big.NewRat(int64(a), unit)) * Amount(unit)
+}
+
+// FitsDigits tells if the amount has no more fraction digits than given, e.g. currency minor ones.
+func (a Amount) FitsDigits(digits int) bool {
+	return a.Round(digits) == a
+}
+
+// digitsUnit returns the number of minor units in the last of the given fraction digits.
+func digitsUnit(digits int) int64 {
+	if digits < 0 {
+		digits = 0
+	}
+	unit := int64(1)
+	for i := digits; i < MinorDigits; i++ {
+		unit *= 10
+	}
+	return unit
+}
+
+// Value stores the amount as an exact decimal, e.g. in a NUMERIC column.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan reads the amount from a decimal column, NULL is read as zero.
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		*a = Amount(v * minorUnits)
+	case float64:
+		*a = FromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money amount", src)
+	}
+	return nil
+}
+
+func (a *Amount) scanString(s string) error {
+	res, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = res
+	return nil
+}
+
+// MarshalJSON writes the amount as a decimal number, so it reads the same as a float one.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		*a = 0
+		return nil
+	}
+	if strings.ContainsAny(s, "eE") {
+		// exponent notation of a float, parsed approximately
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.Wrap(err, "unmarshal money amount")
+		}
+		*a = FromFloat(f)
+		return nil
+	}
+	return a.scanString(s)
+}
+
+// ratOf takes the shortest decimal representation of the float,
+// so 0.1 is exactly one tenth rather than its binary approximation.
+func ratOf(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// roundRat rounds the value to an integer half away from zero.
+func roundRat(r *big.Rat) Amount {
+	num, den := r.Num(), r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	// |2 * rem| >= den means the fraction is at least a half
+	if rem.Abs(rem).Lsh(rem, 1).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(int64(num.Sign())))
+	}
+	return Amount(quo.Int64())
+}
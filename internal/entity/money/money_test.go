@@ -0,0 +1,148 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnParse_ShouldReadDecimalAmounts(t *testing.T) {
+	cases := map[string]Amount{
+		"123":       1230000,
+		"123.4":     1234000,
+		"123.45":    1234500,
+		"123,45":    1234500,
+		"0.1":       1000,
+		".5":        5000,
+		"1.":        10000,
+		"-12.30":    -123000,
+		"+0.07":     700,
+		"0.005":     50,
+		"1.234":     12340,
+		"0.0001":    1,
+		"0.00005":   1,
+		"0.00004":   0,
+		"2.67575":   26758,
+		"-2.67575":  -26758,
+		"9.99999":   100000,
+		" 1000 ":    10000000,
+		"0000.0001": 1,
+	}
+	for in, expected := range cases {
+		res, err := Parse(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, expected, res, in)
+	}
+}
+
+func Test_OnParse_ShouldRejectMalformedAmounts(t *testing.T) {
+	for _, in := range []string{"", "-", ".", "abc", "1e3", "1.2.3", "1,2,3", "12a", "123456789012345"} {
+		_, err := Parse(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func Test_OnString_ShouldKeepMinorDigits(t *testing.T) {
+	assert.Equal(t, "0.00", Amount(0).String())
+	assert.Equal(t, "0.05", Amount(500).String())
+	assert.Equal(t, "123.40", Amount(1234000).String())
+	assert.Equal(t, "-0.50", Amount(-5000).String())
+	assert.Equal(t, "1.234", Amount(12340).String())
+	assert.Equal(t, "-0.0001", Amount(-1).String())
+}
+
+func Test_OnFormat_ShouldRespectCurrencyDigits(t *testing.T) {
+	assert.Equal(t, "123.45", Amount(1234500).Format(2))
+	assert.Equal(t, "123.450", Amount(1234500).Format(3))
+	assert.Equal(t, "123.5", Amount(1234500).Format(1))
+	assert.Equal(t, "123", Amount(1234500).Format(0))
+	assert.Equal(t, "124", Amount(1235000).Format(0))
+	assert.Equal(t, "-124", Amount(-1235000).Format(0))
+	assert.Equal(t, "0", Amount(4900).Format(0))
+	assert.Equal(t, "1.2345", Amount(12345).Format(4))
+	assert.Equal(t, "1.234500", Amount(12345).Format(6))
+}
+
+func Test_OnFitsDigits_ShouldTellCurrencyPrecision(t *testing.T) {
+	// 1.234 KWD has 3 minor digits
+	kwd, err := Parse("1.234")
+	assert.NoError(t, err)
+	assert.True(t, kwd.FitsDigits(3))
+	assert.False(t, kwd.FitsDigits(2))
+	assert.Equal(t, "1.234", kwd.Format(3))
+
+	// yen have no minor units
+	jpy, err := Parse("100.50")
+	assert.NoError(t, err)
+	assert.False(t, jpy.FitsDigits(0))
+	jpy, err = Parse("100.00")
+	assert.NoError(t, err)
+	assert.True(t, jpy.FitsDigits(0))
+
+	assert.Equal(t, Amount(1010000), Amount(1005000).Round(0))
+	assert.Equal(t, Amount(-1010000), Amount(-1005000).Round(0))
+	assert.Equal(t, Amount(12350), Amount(12345).Round(3))
+}
+
+func Test_OnConversion_ShouldRoundHalfAwayFromZero(t *testing.T) {
+	assert.Equal(t, Amount(26758), FromFloat(2.67575))
+	assert.Equal(t, Amount(-26758), FromFloat(-2.67575))
+	assert.Equal(t, Amount(1000), FromFloat(0.1))
+
+	// 100.00 / 3 = 33.333333...
+	assert.Equal(t, Amount(333333), Amount(1000000).Div(3))
+	// 0.0005 * 0.5 = 0.00025
+	assert.Equal(t, Amount(3), Amount(5).Mul(0.5))
+	assert.Equal(t, Amount(-3), Amount(-5).Mul(0.5))
+	// 1000.00 RUB at 0.016 USD per RUB
+	assert.Equal(t, Amount(160000), Amount(10000000).Mul(0.016))
+	assert.Equal(t, Amount(10000000), Amount(160000).Div(0.016))
+	assert.Equal(t, Amount(0), Amount(10000).Div(0))
+}
+
+func Test_OnSum_ShouldNotDrift(t *testing.T) {
+	var total Amount
+	var floatTotal float32
+	for i := 0; i < 1000; i++ {
+		a, err := Parse("0.10")
+		assert.NoError(t, err)
+		total += a
+		floatTotal += 0.1
+	}
+	assert.Equal(t, "100.00", total.String())
+	assert.NotEqual(t, float32(100), floatTotal)
+}
+
+func Test_OnScan_ShouldReadNumericColumns(t *testing.T) {
+	var a Amount
+	assert.NoError(t, a.Scan([]byte("1234.5600")))
+	assert.Equal(t, Amount(12345600), a)
+	assert.NoError(t, a.Scan([]byte("0.1234")))
+	assert.Equal(t, Amount(1234), a)
+	assert.NoError(t, a.Scan(int64(7)))
+	assert.Equal(t, Amount(70000), a)
+	assert.NoError(t, a.Scan(nil))
+	assert.Equal(t, Amount(0), a)
+	assert.Error(t, a.Scan(true))
+
+	v, err := Amount(12345600).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "1234.56", v)
+}
+
+func Test_OnJSON_ShouldReadFloatAmounts(t *testing.T) {
+	var s struct {
+		Amount Amount `json:"amount"`
+	}
+	// snapshots written with float amounts stay readable
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount": 99.99}`), &s))
+	assert.Equal(t, Amount(999900), s.Amount)
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount": 1e2}`), &s))
+	assert.Equal(t, Amount(1000000), s.Amount)
+
+	s.Amount = 1234500
+	data, err := json.Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"amount":123.45}`, string(data))
+}
@@ -0,0 +1,26 @@
+package response
+
+// Button is an inline keyboard button, Data is handled as a message text when pressed.
+type Button struct {
+	Text string
+	Data string
+}
+
+// Document is a file sent to user.
+type Document struct {
+	Name    string
+	Content []byte
+}
+
+// Message is a response to user, the text is the caption of the document if there is one.
+type Message struct {
+	Text     string
+	Buttons  []Button
+	Document *Document
+}
+
+// Notification is a message sent to user not in response to any of theirs.
+type Notification struct {
+	UserID int64
+	Text   string
+}
@@ -0,0 +1,224 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchYears bounds the search of the next run, so schedules that never fire, like "0 0 30 2 *", are detected.
+const searchYears = 5
+
+// aliases of common schedules, they are accepted with or without the leading @.
+var aliases = map[string]string{
+	"daily":    "0 0 * * *",
+	"weekly":   "0 0 * * 1",
+	"monthly":  "0 0 1 * *",
+	"yearly":   "0 0 1 1 *",
+	"annually": "0 0 1 1 *",
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	// 7 is Sunday as well as 0
+	{name: "day of week", min: 0, max: 7},
+}
+
+// bits is a set of the values a field matches.
+type bits uint64
+
+func (b bits) has(v int) bool {
+	return b&(1<<uint(v)) != 0
+}
+
+// Schedule is a parsed cron-like schedule: "minute hour day-of-month month day-of-week".
+// Fields accept *, numbers, ranges a-b, lists a,b and steps */n or a-b/n.
+// As in cron, if both days of month and week are restricted, a day matching either of them matches.
+type Schedule struct {
+	expr                        string
+	minutes, hours, dom, months bits
+	dow                         bits
+	domAny, dowAny              bool
+}
+
+// Parse parses the expression of five fields or one of the aliases: daily, weekly, monthly, yearly.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.Join(strings.Fields(expr), " ")
+	if alias, ok := aliases[strings.ToLower(strings.TrimPrefix(expr, "@"))]; ok {
+		s, err := Parse(alias)
+		s.expr = expr
+		return s, err
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("schedule should have %d fields, got %d", len(fields), len(parts))
+	}
+	sets := make([]bits, len(fields))
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return Schedule{}, err
+		}
+		sets[i] = set
+	}
+	// Sunday is matched by 0 only from here on
+	if sets[4].has(7) {
+		sets[4] |= 1
+	}
+
+	s := Schedule{
+		expr:    expr,
+		minutes: sets[0],
+		hours:   sets[1],
+		dom:     sets[2],
+		months:  sets[3],
+		dow:     sets[4],
+		domAny:  strings.HasPrefix(parts[2], "*"),
+		dowAny:  strings.HasPrefix(parts[4], "*"),
+	}
+	if s.Next(time.Now()).IsZero() {
+		return Schedule{}, fmt.Errorf("schedule %q never fires", expr)
+	}
+	return s, nil
+}
+
+func parseField(s string, f field) (bits, error) {
+	var set bits
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q of %s", stepStr, f.name)
+			}
+		}
+
+		from, to := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			lo, hi, _ := strings.Cut(rng, "-")
+			var err error
+			if from, err = parseValue(lo, f); err != nil {
+				return 0, err
+			}
+			if to, err = parseValue(hi, f); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q of %s", rng, f.name)
+			}
+		default:
+			v, err := parseValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			from = v
+			// a single value with a step, like 5/15, runs up to the maximum as in cron
+			if !hasStep {
+				to = v
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s should be from %d to %d, got %q", f.name, f.min, f.max, s)
+	}
+	return v, nil
+}
+
+// String returns the expression the schedule is parsed from.
+func (s Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first moment strictly after the given one the schedule fires at, in its location.
+// Zero time is returned if the schedule doesn't fire within the next years.
+func (s Schedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, loc).
+		Add(time.Minute)
+	limit := t.AddDate(searchYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !s.months.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !s.hours.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !s.minutes.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// MinInterval returns the shortest interval between runs as if the schedule fired every day:
+// between its minutes if it has several of them, otherwise between its hours.
+func (s Schedule) MinInterval() time.Duration {
+	if gap, ok := minGap(s.minutes, fields[0]); ok {
+		return time.Duration(gap) * time.Minute
+	}
+	if gap, ok := minGap(s.hours, fields[1]); ok {
+		return time.Duration(gap) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// minGap returns the shortest cyclic distance between the values of the set,
+// false if the set has less than two values.
+func minGap(set bits, f field) (int, bool) {
+	period := f.max - f.min + 1
+	first, prev, gap := -1, -1, period
+	for v := f.min; v <= f.max; v++ {
+		if !set.has(v) {
+			continue
+		}
+		if prev >= 0 && v-prev < gap {
+			gap = v - prev
+		}
+		if first < 0 {
+			first = v
+		}
+		prev = v
+	}
+	if first == prev {
+		return 0, false
+	}
+	if first+period-prev < gap {
+		gap = first + period - prev
+	}
+	return gap, true
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	domOK, dowOK := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
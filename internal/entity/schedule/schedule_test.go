@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnNext_ShouldFindNextRun(t *testing.T) {
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	at := time.Date(2022, 10, 14, 12, 30, 0, 0, moscow)
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"monthly", time.Date(2022, 11, 1, 0, 0, 0, 0, moscow)},
+		{"@daily", time.Date(2022, 10, 15, 0, 0, 0, 0, moscow)},
+		{"0 10 5 * *", time.Date(2022, 11, 5, 10, 0, 0, 0, moscow)},
+		{"*/15 * * * *", time.Date(2022, 10, 14, 12, 45, 0, 0, moscow)},
+		{"0 9 * * 1-5", time.Date(2022, 10, 17, 9, 0, 0, 0, moscow)},
+		{"0 0 31 * *", time.Date(2022, 10, 31, 0, 0, 0, 0, moscow)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, moscow)},
+		{"0 0 1,15 * 7", time.Date(2022, 10, 15, 0, 0, 0, 0, moscow)},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		assert.NoError(t, err, c.expr)
+		assert.Equal(t, c.want, s.Next(at), c.expr)
+	}
+}
+
+func Test_OnNext_ShouldBeStrictlyAfter(t *testing.T) {
+	s, err := Parse("30 12 * * *")
+	assert.NoError(t, err)
+
+	at := time.Date(2022, 10, 14, 12, 30, 0, 0, time.UTC)
+	assert.Equal(t, at.AddDate(0, 0, 1), s.Next(at))
+}
+
+func Test_OnParse_ShouldRejectInvalidSchedules(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "0 0 30 2 *"} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func Test_OnMinInterval_ShouldFindShortestGapBetweenRuns(t *testing.T) {
+	cases := []struct {
+		expr string
+		want time.Duration
+	}{
+		{"* * * * *", time.Minute},
+		{"*/15 * * * *", 15 * time.Minute},
+		{"0,50 * * * *", 10 * time.Minute},
+		{"30 * * * *", time.Hour},
+		{"0 9,17 * * 1-5", 8 * time.Hour},
+		{"0 1,23 * * *", 2 * time.Hour},
+		{"monthly", 24 * time.Hour},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		assert.NoError(t, err, c.expr)
+		assert.Equal(t, c.want, s.MinInterval(), c.expr)
+	}
+}
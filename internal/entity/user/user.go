@@ -1,18 +1,175 @@
 package user
 
 import (
+	"strings"
 	"time"
+
+	"max.ks1230/finances-bot/internal/entity/money"
 )
 
+// ExpenseRecord keeps the amount in base currency along with
+// the amount and currency user actually typed and the rate used for conversion.
 type ExpenseRecord struct {
-	Amount   float64
+	ID       int64
+	Amount   money.Amount
 	Category string
 	Created  time.Time
+
+	OriginalAmount money.Amount
+	// Currency is the original currency, empty for the base one
+	Currency string
+	// Rate is the base rate of the original currency at the moment of conversion
+	Rate float64
+
+	// AccountID is zero for expenses not bound to an account, Account is its name
+	AccountID int64
+	Account   string
+
+	// Tags are lowercase and without the leading #
+	Tags []string
+	Note string
+
+	// RecurringID is the recurring expense which run saved the expense, a run is never saved twice
+	RecurringID int64
+}
+
+// HasTag reports whether the expense is tagged with the tag regardless of case.
+func (e ExpenseRecord) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// AmountIn returns expense amount in the currency with the given base rate.
+// The original amount is returned as is when currencies match, so historic values are not reconverted.
+func (e ExpenseRecord) AmountIn(curr string, rate float64) money.Amount {
+	if e.Currency != "" && e.Currency == curr {
+		return e.OriginalAmount
+	}
+	return e.Amount.Mul(rate)
+}
+
+// IncomeRecord keeps the amount in base currency along with the amount and currency user actually typed.
+type IncomeRecord struct {
+	ID      int64
+	Amount  money.Amount
+	Source  string
+	Created time.Time
+
+	OriginalAmount money.Amount
+	// Currency is the original currency, empty for the base one
+	Currency string
+
+	// AccountID is zero for incomes not bound to an account, Account is its name
+	AccountID int64
+	Account   string
+}
+
+// AmountIn returns income amount in the currency with the given base rate, the same way as for expenses.
+func (i IncomeRecord) AmountIn(curr string, rate float64) money.Amount {
+	if i.Currency != "" && i.Currency == curr {
+		return i.OriginalAmount
+	}
+	return i.Amount.Mul(rate)
+}
+
+// Account is a named wallet of user, operations on it are typed in its own currency.
+type Account struct {
+	ID       int64
+	Name     string
+	Currency string
+	// StartingBalance and Balance are in the account currency
+	StartingBalance money.Amount
+	Balance         money.Amount
+	// Default account is used for operations without an explicit one
+	Default bool
+}
+
+// Transfer moves money between accounts of user, possibly exchanging it.
+// It is not an expense nor an income, so it only changes balances of the accounts.
+type Transfer struct {
+	ID      int64
+	Created time.Time
+
+	FromAccountID int64
+	From          string
+	// Amount is sent in the source account currency
+	Amount money.Amount
+
+	ToAccountID int64
+	To          string
+	// Received amount is in the destination account currency
+	Received money.Amount
+
+	// Rate is received amount per sent one, the current rate of the currencies
+	// or the effective one if the received amount is given explicitly
+	Rate float64
+}
+
+// RecurringExpense is saved as a regular expense every time its schedule fires.
+type RecurringExpense struct {
+	ID       int64
+	UserID   int64
+	Category string
+	// Amount is in the currency user typed it in, it is converted at the moment of every run
+	Amount   money.Amount
+	Currency string
+	// Schedule is a cron-like expression evaluated in user's timezone
+	Schedule string
+	NextRun  time.Time
+}
+
+// Category is a registered category of user, its aliases are typed instead of it.
+type Category struct {
+	Name    string
+	Aliases []string
+}
+
+// CategorySeparator separates subcategories in a category path, like food/groceries.
+const CategorySeparator = "/"
+
+// NormalizeCategory trims spaces and empty parts of the category path, like in "food//groceries/".
+// Empty string is returned if nothing is left.
+func NormalizeCategory(name string) string {
+	return strings.Join(CategoryPath(name), CategorySeparator)
+}
+
+// CategoryPath splits the category into its non-empty parts from the top one to the category itself.
+func CategoryPath(name string) []string {
+	parts := strings.Split(name, CategorySeparator)
+	res := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// IsWithinCategory reports whether the category is the parent one or any of its subcategories regardless of case.
+func IsWithinCategory(category, parent string) bool {
+	category, parent = strings.ToLower(NormalizeCategory(category)), strings.ToLower(NormalizeCategory(parent))
+	return category == parent || strings.HasPrefix(category, parent+CategorySeparator)
+}
+
+// ExpenseFilter narrows down a list of expenses. Zero values do not filter.
+// From is inclusive, To is exclusive. Category matches its subcategories as well.
+type ExpenseFilter struct {
+	From     time.Time
+	To       time.Time
+	Category string
+	Tag      string
 }
 
 type Record struct {
 	preferredCurrency string
-	MonthLimit        float64
+	timezone          string
+	MonthLimit        money.Amount
+	// SoftLimit makes exceeding expenses saved with a warning instead of being rejected
+	SoftLimit bool
 }
 
 func (r *Record) PreferredCurrencyOrDefault(def string) string {
@@ -29,3 +186,24 @@ func (r *Record) PreferredCurrency() string {
 func (r *Record) SetPreferredCurrency(curr string) {
 	r.preferredCurrency = curr
 }
+
+func (r *Record) Timezone() string {
+	return r.timezone
+}
+
+func (r *Record) SetTimezone(tz string) {
+	r.timezone = tz
+}
+
+// LocationOrDefault returns the location of user's timezone.
+// Default is returned if the timezone is not set or unknown.
+func (r *Record) LocationOrDefault(def *time.Location) *time.Location {
+	if r.timezone == "" {
+		return def
+	}
+	loc, err := time.LoadLocation(r.timezone)
+	if err != nil {
+		return def
+	}
+	return loc
+}
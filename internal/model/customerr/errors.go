@@ -1,5 +1,10 @@
 package customerr
 
+import (
+	"fmt"
+	"time"
+)
+
 type LimitError struct {
 	Err string
 }
@@ -7,3 +12,38 @@ type LimitError struct {
 func (e *LimitError) Error() string {
 	return e.Err
 }
+
+type NotFoundError struct {
+	Err string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Err
+}
+
+type AlreadyExistsError struct {
+	Err string
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return e.Err
+}
+
+// BudgetError means that the monthly budget of a category is exceeded.
+type BudgetError struct {
+	Category string
+}
+
+func (e *BudgetError) Error() string {
+	return "budget exceeded for category " + e.Category
+}
+
+// StaleRateError means that the latest rate of a currency is too old to convert with.
+type StaleRateError struct {
+	Currency string
+	Age      time.Duration
+}
+
+func (e *StaleRateError) Error() string {
+	return fmt.Sprintf("rate %s is stale, updated %s ago", e.Currency, e.Age)
+}
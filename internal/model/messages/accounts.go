@@ -0,0 +1,196 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/customerr"
+	"max.ks1230/finances-bot/internal/utils"
+)
+
+const accountPrefix = "@"
+
+// byAccountArg makes report grouped by accounts instead of categories
+const byAccountArg = "accounts"
+
+const (
+	accountAddCmd     = "add"
+	accountListCmd    = "list"
+	accountDefaultCmd = "default"
+)
+
+const (
+	accountAddMinParts = 3
+	accountAddMaxParts = 4
+)
+
+const (
+	noAccountsMessage          = "You have no accounts yet. Add one with /account add <name> <currency> [balance]"
+	accountsHeaderMessage      = "Accounts:"
+	accountRecordTemplate      = "%s: %s"
+	defaultAccountSuffix       = " (default)"
+	accountAddedTemplate       = "Gotcha! Account %s is added"
+	accountExistsTemplate      = "You already have account %s"
+	unknownAccountTemplate     = "I don't know account %s. Add it with /account add"
+	incorrectAccountMessage    = "Account name should be a single word without @"
+	incorrectBalanceMessage    = "The starting balance is incorrect"
+	cannotGetAccountsMessage   = "Can't get your accounts atm. Try later"
+	cannotSaveAccountMessage   = "Can't save your account atm. Try later"
+	cannotSetDefaultAccMessage = "Can't set your default account atm. Try later"
+	reportAccountTemplate      = "Account: %s"
+	reportByAccountMessage     = "By accounts:"
+)
+
+// handleAccount handles "add <name> <currency> [balance]", "list" and "default <name>" subcommands.
+func (s *HandlerService) handleAccount(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleAccount - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleAccount - end")
+
+	args := strings.Fields(arg)
+	if len(args) == 0 {
+		return incorrectUsageMessage, nil
+	}
+	switch strings.ToLower(args[0]) {
+	case accountAddCmd:
+		return s.addAccount(ctx, args[1:], userID)
+	case accountListCmd:
+		return s.listAccounts(ctx, userID)
+	case accountDefaultCmd:
+		if len(args) != 2 {
+			return incorrectUsageMessage, nil
+		}
+		return s.setDefaultAccount(ctx, strings.TrimPrefix(args[1], accountPrefix), userID)
+	default:
+		return incorrectUsageMessage, nil
+	}
+}
+
+func (s *HandlerService) addAccount(ctx context.Context, args []string, userID int64) (string, error) {
+	if len(args) < accountAddMinParts-1 || len(args) > accountAddMaxParts-1 {
+		return incorrectUsageMessage, nil
+	}
+	name := strings.TrimPrefix(args[0], accountPrefix)
+	if name == "" || strings.Contains(name, accountPrefix) {
+		return incorrectAccountMessage, nil
+	}
+	curr := strings.ToUpper(args[1])
+	if !utils.Contains(s.currencies, curr) {
+		return fmt.Sprintf(invalidCurrencyTemplate, strings.Join(s.currencies, ", ")), nil
+	}
+	var balance money.Amount
+	if len(args) == accountAddMaxParts-1 {
+		var err error
+		balance, err = money.Parse(args[2])
+		if err != nil {
+			return incorrectBalanceMessage, errors.Wrap(err, "add account")
+		}
+		if msg, err := checkPrecision(balance, curr); err != nil {
+			return msg, errors.Wrap(err, "add account")
+		}
+	}
+
+	_, err := s.storage.SaveAccount(ctx, userID, user.Account{
+		Name:            name,
+		Currency:        curr,
+		StartingBalance: balance,
+	})
+	if err != nil {
+		var existsErr *customerr.AlreadyExistsError
+		if errors.As(err, &existsErr) {
+			return fmt.Sprintf(accountExistsTemplate, name), err
+		}
+		return cannotSaveAccountMessage, errors.Wrap(err, "add account")
+	}
+	return fmt.Sprintf(accountAddedTemplate, name), nil
+}
+
+func (s *HandlerService) listAccounts(ctx context.Context, userID int64) (string, error) {
+	accounts, err := s.storage.GetAccounts(ctx, userID)
+	if err != nil {
+		return cannotGetAccountsMessage, errors.Wrap(err, "list accounts")
+	}
+	if len(accounts) == 0 {
+		return noAccountsMessage, nil
+	}
+
+	res := make([]string, 0, len(accounts)+1)
+	res = append(res, accountsHeaderMessage)
+	for _, acc := range accounts {
+		line := fmt.Sprintf(accountRecordTemplate, acc.Name, formatMoney(acc.Balance, acc.Currency))
+		if acc.Default {
+			line += defaultAccountSuffix
+		}
+		res = append(res, line)
+	}
+	return strings.Join(res, "\n"), nil
+}
+
+func (s *HandlerService) setDefaultAccount(ctx context.Context, name string, userID int64) (string, error) {
+	err := s.storage.SetDefaultAccount(ctx, userID, name)
+	if err != nil {
+		var notFoundErr *customerr.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return fmt.Sprintf(unknownAccountTemplate, name), err
+		}
+		return cannotSetDefaultAccMessage, errors.Wrap(err, "set default account")
+	}
+	return okMessage, nil
+}
+
+// extractAccount takes an optional "@account" token out of command arguments.
+func extractAccount(args []string) ([]string, string) {
+	rest := make([]string, 0, len(args))
+	var account string
+	for _, a := range args {
+		if strings.HasPrefix(a, accountPrefix) && len(a) > len(accountPrefix) {
+			account = strings.TrimPrefix(a, accountPrefix)
+			continue
+		}
+		rest = append(rest, a)
+	}
+	return rest, account
+}
+
+// accountOf returns the account an operation is bound to, the default one if no name is given.
+// Zero account is returned if no name is given and user has no default account.
+// In case of an error it returns the message to be shown to user.
+func (s *HandlerService) accountOf(ctx context.Context, userID int64, name string) (user.Account, string, error) {
+	acc, err := s.storage.FindAccount(ctx, userID, name)
+	if err == nil {
+		return acc, "", nil
+	}
+	var notFoundErr *customerr.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		return user.Account{}, cannotGetAccountsMessage, err
+	}
+	if name != "" {
+		return user.Account{}, fmt.Sprintf(unknownAccountTemplate, name), err
+	}
+	return user.Account{}, "", nil
+}
+
+// defaultAccountIn returns the default account of the user to bind expenses in the currency to, which are
+// saved without one being named, like recurring and imported ones. Zero account is returned if user has
+// no default account or it is in another currency, as balances are summed in the currency of the account.
+func (s *HandlerService) defaultAccountIn(ctx context.Context, userID int64, curr string) (user.Account, error) {
+	acc, _, err := s.accountOf(ctx, userID, "")
+	if err != nil || acc.Currency != curr {
+		return user.Account{}, err
+	}
+	return acc, nil
+}
+
+// operationCurrency returns the currency operations are typed in,
+// the one of their account or user's preferred one otherwise.
+func (s *HandlerService) operationCurrency(userRec user.Record, acc user.Account) string {
+	if acc.ID != 0 {
+		return acc.Currency
+	}
+	return userRec.PreferredCurrencyOrDefault(s.defaultCurrency)
+}
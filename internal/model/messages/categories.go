@@ -0,0 +1,234 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/customerr"
+)
+
+const (
+	categoryListCmd   = "list"
+	categoryAliasCmd  = "alias"
+	categoryRenameCmd = "rename"
+	categoryMergeCmd  = "merge"
+)
+
+// categoryPairParts are "<subcommand> <category> <category>"
+const categoryPairParts = 3
+
+// suggestionDistanceDivisor makes the edit distance allowed for suggestions grow with the name length
+const suggestionDistanceDivisor = 3
+
+const (
+	noCategoriesMessage        = "You have no categories yet"
+	categoriesHeaderMessage    = "Categories:"
+	categoryAliasesTemplate    = " (aka %s)"
+	unknownCategoryTemplate    = "I don't know category %s"
+	categoryExistsTemplate     = "You already have category %s"
+	sameCategoryMessage        = "Those are the same category"
+	intoSubcategoryTemplate    = "Can't merge %s into its own subcategory %s"
+	categoriesMergedTemplate   = "Gotcha! Moved expenses: %d"
+	newCategoryTemplate        = "New category %s. Did you mean %s? Fix it with /category merge %s %s"
+	cannotGetCategoriesMessage = "Can't get your categories atm. Try later"
+	cannotSaveCategoryMessage  = "Can't change your categories atm. Try later"
+	reportCategoryTemplate     = "Category: %s"
+)
+
+// handleCategory handles "list", "alias <alias> <category>", "rename <category> <name>"
+// and "merge <category> <into>" subcommands. Renames and merges rewrite the history as well.
+func (s *HandlerService) handleCategory(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleCategory - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleCategory - end")
+
+	args := strings.Fields(arg)
+	if len(args) == 0 {
+		return incorrectUsageMessage, nil
+	}
+	sub := strings.ToLower(args[0])
+	if sub == categoryListCmd {
+		return s.listCategories(ctx, userID)
+	}
+	if len(args) != categoryPairParts {
+		return incorrectUsageMessage, nil
+	}
+	switch sub {
+	case categoryAliasCmd:
+		return s.aliasCategory(ctx, args[1], args[2], userID)
+	case categoryRenameCmd:
+		return s.renameCategory(ctx, args[1], args[2], userID)
+	case categoryMergeCmd:
+		return s.mergeCategories(ctx, args[1], args[2], userID)
+	default:
+		return incorrectUsageMessage, nil
+	}
+}
+
+func (s *HandlerService) listCategories(ctx context.Context, userID int64) (string, error) {
+	categories, err := s.storage.GetCategories(ctx, userID)
+	if err != nil {
+		return cannotGetCategoriesMessage, errors.Wrap(err, "list categories")
+	}
+	if len(categories) == 0 {
+		return noCategoriesMessage, nil
+	}
+
+	res := make([]string, 0, len(categories)+1)
+	res = append(res, categoriesHeaderMessage)
+	for _, c := range categories {
+		line := c.Name
+		if len(c.Aliases) > 0 {
+			line += fmt.Sprintf(categoryAliasesTemplate, strings.Join(c.Aliases, ", "))
+		}
+		res = append(res, line)
+	}
+	return strings.Join(res, "\n"), nil
+}
+
+func (s *HandlerService) aliasCategory(ctx context.Context, alias, category string, userID int64) (string, error) {
+	err := s.storage.AliasCategory(ctx, userID, alias, category)
+	if err != nil {
+		return categoryErrorMessage(err, category, alias), errors.Wrap(err, "alias category")
+	}
+	return okMessage, nil
+}
+
+func (s *HandlerService) renameCategory(ctx context.Context, from, to string, userID int64) (string, error) {
+	to = user.NormalizeCategory(to)
+	if to == "" {
+		return incorrectCategoryMessage, nil
+	}
+	// renaming by an alias is renaming the category it stands for, as merging does
+	fromName, err := s.storage.ResolveCategory(ctx, userID, from)
+	if err != nil {
+		return categoryErrorMessage(err, from, to), errors.Wrap(err, "rename category")
+	}
+	err = s.storage.RenameCategory(ctx, userID, fromName, to)
+	if err != nil {
+		return categoryErrorMessage(err, fromName, to), errors.Wrap(err, "rename category")
+	}
+	s.invalidateReports(userID)
+	return okMessage, nil
+}
+
+func (s *HandlerService) mergeCategories(ctx context.Context, from, into string, userID int64) (string, error) {
+	// merging by an alias is merging the category it stands for
+	fromName, err := s.storage.ResolveCategory(ctx, userID, from)
+	if err != nil {
+		return categoryErrorMessage(err, from, into), errors.Wrap(err, "merge categories")
+	}
+	intoName, err := s.storage.ResolveCategory(ctx, userID, into)
+	if err != nil {
+		return categoryErrorMessage(err, into, from), errors.Wrap(err, "merge categories")
+	}
+	if fromName == intoName {
+		return sameCategoryMessage, nil
+	}
+	if user.IsWithinCategory(intoName, fromName) {
+		return fmt.Sprintf(intoSubcategoryTemplate, fromName, intoName),
+			errors.Errorf("merge categories: %s is a subcategory of %s", intoName, fromName)
+	}
+
+	moved, err := s.storage.MergeCategories(ctx, userID, fromName, intoName)
+	if err != nil {
+		return categoryErrorMessage(err, fromName, intoName), errors.Wrap(err, "merge categories")
+	}
+	s.invalidateReports(userID)
+	return fmt.Sprintf(categoriesMergedTemplate, moved), nil
+}
+
+// categoryErrorMessage returns the message shown to user when the category is not found
+// or the name is already taken.
+func categoryErrorMessage(err error, category, name string) string {
+	var notFoundErr *customerr.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return fmt.Sprintf(unknownCategoryTemplate, category)
+	}
+	var existsErr *customerr.AlreadyExistsError
+	if errors.As(err, &existsErr) {
+		return fmt.Sprintf(categoryExistsTemplate, name)
+	}
+	return cannotSaveCategoryMessage
+}
+
+// resolveCategory returns the registered name of the typed category, matched regardless of case or by alias.
+// An unknown category is kept as typed and becomes a new one, the hint suggests a similar known one if any.
+// In case of an error it returns the message to be shown to user.
+func (s *HandlerService) resolveCategory(ctx context.Context, userID int64, typed string) (name, hint string, err error) {
+	name, err = s.storage.ResolveCategory(ctx, userID, typed)
+	if err == nil {
+		return name, "", nil
+	}
+	var notFoundErr *customerr.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		return "", cannotGetCategoriesMessage, err
+	}
+
+	categories, err := s.storage.GetCategories(ctx, userID)
+	if err != nil {
+		return "", cannotGetCategoriesMessage, err
+	}
+	if similar, ok := similarCategory(typed, categories); ok {
+		hint = fmt.Sprintf(newCategoryTemplate, typed, similar, typed, similar)
+	}
+	return typed, hint, nil
+}
+
+// similarCategory returns the category which name or alias is the closest to the typed one by edit distance.
+// Only the categories a few typos away are considered similar.
+func similarCategory(typed string, categories []user.Category) (string, bool) {
+	typed = strings.ToLower(typed)
+	maxDistance := utf8.RuneCountInString(typed) / suggestionDistanceDivisor
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	var res string
+	best := maxDistance + 1
+	for _, c := range categories {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if d := editDistance(typed, strings.ToLower(name)); d < best {
+				res, best = c.Name, d
+			}
+		}
+	}
+	return res, best <= maxDistance
+}
+
+// editDistance returns the Levenshtein distance between the strings counted in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	res := first
+	for _, v := range rest {
+		if v < res {
+			res = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,123 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/currency"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/utils"
+)
+
+const (
+	convertMinParts = 2
+	convertMaxParts = 3
+	rateDigits      = 4
+)
+
+const (
+	convertedTemplate   = "%s = %s"
+	ratesHeaderTemplate = "Rates in %s:"
+	rateRecordTemplate  = "1 %s = %s %s, updated %s ago"
+	unknownRateTemplate = "%s: unknown yet"
+)
+
+// handleConvert handles "<amount> <from> [to]", the target currency is user's preferred one by default.
+func (s *HandlerService) handleConvert(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleConvert - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleConvert - end")
+
+	args := strings.Fields(arg)
+	if len(args) < convertMinParts || len(args) > convertMaxParts {
+		return incorrectUsageMessage, nil
+	}
+	amount, ok := parsePositiveAmount(args[0])
+	if !ok {
+		return incorrectAmountMessage, errors.New("handle convert: incorrect amount")
+	}
+
+	from := strings.ToUpper(args[1])
+	var to string
+	if len(args) == convertMaxParts {
+		to = strings.ToUpper(args[2])
+	} else {
+		u, err := s.storage.GetUserByID(ctx, userID)
+		if err != nil {
+			return cannotGetRateMessage, errors.Wrap(err, "handle convert")
+		}
+		to = u.PreferredCurrencyOrDefault(s.defaultCurrency)
+	}
+	for _, curr := range []string{from, to} {
+		if !utils.Contains(s.currencies, curr) {
+			return fmt.Sprintf(invalidCurrencyTemplate, strings.Join(s.currencies, ", ")), nil
+		}
+	}
+	if msg, err := checkPrecision(amount, from); err != nil {
+		return msg, errors.Wrap(err, "handle convert")
+	}
+
+	converted, warning, err := s.exchange(ctx, amount, from, to)
+	if err != nil {
+		return rateErrorMessage(err), errors.Wrap(err, "handle convert")
+	}
+
+	res := fmt.Sprintf(convertedTemplate, formatMoney(amount, from), formatMoney(converted, to))
+	return withWarning(res, warning), nil
+}
+
+// handleRates shows current rates of all supported currencies in user's preferred one.
+func (s *HandlerService) handleRates(ctx context.Context, _ string, userID int64) (string, error) {
+	logger.Info("handleRates - start", zap.Int64("userID", userID))
+	defer logger.Info("handleRates - end")
+
+	u, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotGetRateMessage, errors.Wrap(err, "handle rates")
+	}
+	curr := u.PreferredCurrencyOrDefault(s.defaultCurrency)
+	userRate, err := s.storage.GetRate(ctx, curr)
+	if err != nil {
+		return cannotGetRateMessage, errors.Wrap(err, "handle rates")
+	}
+
+	res := make([]string, 0, len(s.currencies))
+	res = append(res, fmt.Sprintf(ratesHeaderTemplate, curr))
+	for _, other := range s.currencies {
+		if other == curr {
+			continue
+		}
+		rate, err := s.storage.GetRate(ctx, other)
+		if err != nil || rate.BaseRate == 0 {
+			logger.Error("cannot get rate", zap.String("rate", other), zap.Error(err))
+			res = append(res, fmt.Sprintf(unknownRateTemplate, other))
+			continue
+		}
+		res = append(res, fmt.Sprintf(rateRecordTemplate,
+			other,
+			strconv.FormatFloat(userRate.BaseRate/rate.BaseRate, 'f', rateDigits, 64),
+			curr,
+			formatAge(s.rateAge(rate, userRate)),
+		))
+	}
+	return strings.Join(res, "\n"), nil
+}
+
+// rateAge returns the age of the cross rate, that is the age of its older pulled part.
+// Base currency rate is always 1, so its own age doesn't count.
+func (s *HandlerService) rateAge(rates ...currency.Rate) time.Duration {
+	var age time.Duration
+	for _, rate := range rates {
+		if rate.Name == s.defaultCurrency {
+			continue
+		}
+		if a := time.Since(rate.UpdatedAt); a > age {
+			age = a
+		}
+	}
+	return age
+}
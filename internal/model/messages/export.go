@@ -0,0 +1,70 @@
+package messages
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	apiv12 "max.ks1230/finances-bot/api/grpc"
+	apiv1 "max.ks1230/finances-bot/api/kafka"
+	"max.ks1230/finances-bot/internal/entity/response"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/reports"
+	"max.ks1230/finances-bot/internal/utils"
+)
+
+const (
+	preparingExportMessage = "Preparing your export..."
+	cannotExportMessage    = "Can't export your expenses atm. Try later"
+)
+
+// handleExport handles "[period] [format]" arguments in any order, all expenses are exported to CSV by default.
+// The document is generated by reporter and sent when it is accepted back.
+func (s *HandlerService) handleExport(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleExport - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleExport - end")
+
+	formats := reports.ExportFormats()
+	req := &apiv1.ReportRequest{
+		UserID: userID,
+		Format: formats[0],
+	}
+	var periodSet, formatSet bool
+	for _, a := range strings.Fields(arg) {
+		if f := strings.ToLower(a); utils.Contains(formats, f) && !formatSet {
+			req.Format, formatSet = f, true
+			continue
+		}
+		if periodSet {
+			return incorrectUsageMessage, nil
+		}
+		req.Period, periodSet = a, true
+	}
+
+	if msg, err := s.requestReport(ctx, req); err != nil || msg != "" {
+		return msg, errors.Wrap(err, "handle export")
+	}
+	return preparingExportMessage, nil
+}
+
+// AcceptExport answers with the exported document generated by reporter.
+func (s *HandlerService) AcceptExport(_ context.Context, report *apiv12.ReportResult) (response.Message, error) {
+	logger.Info("acceptExport - start", zap.Int64("userID", report.GetUserID()))
+	defer logger.Info("acceptExport - end")
+
+	if !report.GetStatus().GetSuccess() {
+		return response.Message{Text: cannotExportMessage},
+			errors.Wrap(errors.New(report.GetStatus().GetError()), "accept export")
+	}
+	doc := report.GetDocument()
+	if doc == nil {
+		return response.Message{Text: noHistoryMessage}, nil
+	}
+	return response.Message{
+		Document: &response.Document{
+			Name:    doc.GetName(),
+			Content: doc.GetContent(),
+		},
+	}, nil
+}
@@ -11,6 +11,7 @@ import (
 	"max.ks1230/finances-bot/internal/model/reports"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	apiv1 "max.ks1230/finances-bot/api/kafka"
 
 	"github.com/opentracing/opentracing-go"
@@ -20,16 +21,35 @@ import (
 
 	"github.com/pkg/errors"
 	"max.ks1230/finances-bot/internal/entity/currency"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/response"
 	"max.ks1230/finances-bot/internal/entity/user"
 	"max.ks1230/finances-bot/internal/model/customerr"
 	"max.ks1230/finances-bot/internal/utils"
 )
 
 const dateLayout = "02.01.2006"
-const floatBitSize = 32
+
+const (
+	idBase    = 10
+	idBitSize = 64
+)
 
 const (
 	expenseCmdParts = 2
+	editCmdParts    = 3
+	budgetCmdParts  = 2
+	reportCmdParts  = 2
+)
+
+const (
+	limitModeSoft = "soft"
+	limitModeHard = "hard"
+)
+
+const (
+	defaultUndoCount = 1
+	maxUndoCount     = 20
 )
 
 const (
@@ -40,27 +60,76 @@ const (
 	okMessage             = "Gotcha!"
 	noExpensesMessage     = "You have no expenses yet"
 	generatingReport      = "Generating report..."
+	expenseSavedTemplate  = "Gotcha! Expense ID: %d"
+	incomeSavedTemplate   = "Gotcha! Income ID: %d"
+	balanceTemplate       = "Income: %s\nExpenses: %s\nBalance: %s"
+	nothingToUndoMessage  = "There is nothing to undo"
+	undoneTemplate        = "Undone actions: %d"
 
-	incorrectUsageMessage    = "That is an incorrect command usage"
-	incorrectExpenseMessage  = "Your expense amount is incorrect"
-	incorrectLimitMessage    = "Your limit amount is incorrect"
-	incorrectDateMessage     = "The date is incorrect. Should be dd.mm.yyyy"
-	cannotGetExpensesMessage = "Can't get your expenses atm. Try later"
-	cannotSaveExpenseMessage = "Can't save your expense atm. Try later"
-	cannotSetCurrencyMessage = "Can't set your preferred currency atm. Try later"
-	cannotSetLimitMessage    = "Can't set your month limit atm. Try later"
-	cannotGetRateMessage     = "Can't get currencies rates atm. Try later"
-	cannotGenReportMessage   = "Can't generate report atm. Try later"
-	limitExceededMessage     = "You exceeded your limit and I'm not writing that down! Congrats!"
-	invalidCurrencyTemplate  = "I don't know that currency. Try one of: %s"
+	incorrectUsageMessage      = "That is an incorrect command usage"
+	incorrectExpenseMessage    = "Your expense amount is incorrect"
+	incorrectAmountMessage     = "The amount is incorrect"
+	incorrectLimitMessage      = "Your limit amount is incorrect"
+	incorrectDateMessage       = "The date is incorrect. Should be dd.mm.yyyy"
+	incorrectCategoryMessage   = "The category is incorrect. Subcategories are separated with /, like food/groceries"
+	incorrectIncomeMessage     = "Your income amount is incorrect"
+	incorrectSourceMessage     = "The income source is incorrect"
+	incorrectExpenseIDMessage  = "Your expense ID is incorrect"
+	expenseNotFoundMessage     = "I can't find an expense with that ID"
+	cannotGetExpensesMessage   = "Can't get your expenses atm. Try later"
+	cannotSaveExpenseMessage   = "Can't save your expense atm. Try later"
+	cannotSaveIncomeMessage    = "Can't save your income atm. Try later"
+	cannotGetBalanceMessage    = "Can't get your balance atm. Try later"
+	cannotEditExpenseMessage   = "Can't edit your expense atm. Try later"
+	cannotDeleteExpenseMessage = "Can't delete your expense atm. Try later"
+	cannotUndoMessage          = "Can't undo your actions atm. Try later"
+	incorrectUndoCountTemplate = "You can undo from 1 to %d actions at once"
+	cannotSetCurrencyMessage   = "Can't set your preferred currency atm. Try later"
+	cannotSetLimitMessage      = "Can't set your month limit atm. Try later"
+	cannotSetBudgetMessage     = "Can't set your budget atm. Try later"
+	cannotSetTimezoneMessage   = "Can't set your timezone atm. Try later"
+	incorrectTimezoneMessage   = "I don't know that timezone. Try one like Europe/Moscow"
+	cannotGetRateMessage       = "Can't get currencies rates atm. Try later"
+	cannotGenReportMessage     = "Can't generate report atm. Try later"
+	limitExceededMessage       = "You exceeded your limit and I'm not writing that down! Congrats!"
+	budgetExceededTemplate     = "You exceeded your %s budget and I'm not writing that down!"
+	limitWarningTemplate       = "Heads up! You've spent %d%% of your month limit"
+	budgetWarningTemplate      = "Heads up! You've exceeded your %s budget"
+	staleRateWarningTemplate   = "Heads up! The %s rate was updated %s ago, the conversion may be off"
+	staleRateRefusedTemplate   = "The %s rate was updated %s ago, it's too old to convert with. Try later"
+	incorrectLimitModeMessage  = "Limit mode should be either soft or hard"
+	noFractionTemplate         = "%s amounts can't have a fraction part"
+	tooPreciseTemplate         = "%s amounts can't have more than %d digits after the point"
+	invalidCurrencyTemplate    = "I don't know that currency. Try one of: %s"
+	unsupportedPeriodTemplate  = "I don't know that period. Try one of: %s or dd.mm.yyyy-dd.mm.yyyy"
 )
 
 const (
-	startCmd    = "/start"
-	expenseCmd  = "/expense"
-	reportCmd   = "/report"
-	currencyCmd = "/currency"
-	limitCmd    = "/limit"
+	startCmd     = "/start"
+	expenseCmd   = "/expense"
+	reportCmd    = "/report"
+	currencyCmd  = "/currency"
+	limitCmd     = "/limit"
+	timezoneCmd  = "/timezone"
+	budgetCmd    = "/budget"
+	limitModeCmd = "/limitmode"
+	incomeCmd    = "/income"
+	balanceCmd   = "/balance"
+	deleteCmd    = "/delete"
+	editCmd      = "/edit"
+	undoCmd      = "/undo"
+	historyCmd   = "/history"
+	convertCmd   = "/convert"
+	ratesCmd     = "/rates"
+	accountCmd   = "/account"
+	transferCmd  = "/transfer"
+	recurringCmd = "/recurring"
+	categoryCmd  = "/category"
+	exportCmd    = "/export"
+	importCmd    = "/import"
+
+	// historyPageCmd is sent by history inline keyboard
+	historyPageCmd = "/history_page"
 )
 
 type reportRequestProducer interface {
@@ -71,7 +140,38 @@ type userStorage interface {
 	GetUserByID(ctx context.Context, userID int64) (user.Record, error)
 	SaveUserByID(ctx context.Context, userID int64, rec user.Record) error
 	GetRate(ctx context.Context, name string) (currency.Rate, error)
-	SaveExpense(ctx context.Context, userID int64, record user.ExpenseRecord) error
+	GetExpensesPage(ctx context.Context, userID int64, filter user.ExpenseFilter, offset, limit uint64) ([]user.ExpenseRecord, error)
+	SaveExpense(ctx context.Context, userID int64, record user.ExpenseRecord) (int64, error)
+	GetExpense(ctx context.Context, userID int64, expenseID int64) (user.ExpenseRecord, error)
+	UpdateExpense(ctx context.Context, userID int64, record user.ExpenseRecord) error
+	DeleteExpense(ctx context.Context, userID int64, expenseID int64) error
+	UndoActions(ctx context.Context, userID int64, n int) (int, error)
+	SaveBudget(ctx context.Context, userID int64, category string, amount money.Amount) error
+	FireLimitWarnings(ctx context.Context, userID int64, category string, at time.Time,
+		thresholds []int) ([]int, bool, error)
+	SaveIncome(ctx context.Context, userID int64, record user.IncomeRecord) (int64, error)
+	GetBalance(ctx context.Context, userID int64, from, to time.Time) (income, expenses money.Amount, err error)
+	SaveAccount(ctx context.Context, userID int64, acc user.Account) (int64, error)
+	GetAccounts(ctx context.Context, userID int64) ([]user.Account, error)
+	FindAccount(ctx context.Context, userID int64, name string) (user.Account, error)
+	SetDefaultAccount(ctx context.Context, userID int64, name string) error
+	SaveTransfer(ctx context.Context, userID int64, t user.Transfer) (int64, error)
+	SaveRecurring(ctx context.Context, userID int64, rec user.RecurringExpense) (int64, error)
+	GetRecurring(ctx context.Context, userID int64) ([]user.RecurringExpense, error)
+	DeleteRecurring(ctx context.Context, userID int64, id int64) error
+	GetDueRecurring(ctx context.Context, at time.Time, limit uint64) ([]user.RecurringExpense, error)
+	ScheduleRecurring(ctx context.Context, id int64, due, next time.Time) error
+	ResolveCategory(ctx context.Context, userID int64, name string) (string, error)
+	GetCategories(ctx context.Context, userID int64) ([]user.Category, error)
+	AliasCategory(ctx context.Context, userID int64, alias, category string) error
+	RenameCategory(ctx context.Context, userID int64, from, to string) error
+	MergeCategories(ctx context.Context, userID int64, from, into string) (int64, error)
+	ImportExpenses(ctx context.Context, userID int64, recs []user.ExpenseRecord) (int, error)
+}
+
+type historicalRates interface {
+	RateAt(ctx context.Context, name string, at time.Time) (currency.Rate, error)
+	DailyRates(ctx context.Context, name string, days []time.Time) (map[string]currency.Rate, error)
 }
 
 type reportCache interface {
@@ -82,36 +182,63 @@ type reportCache interface {
 
 type config interface {
 	BaseCurrency() string
+	Location() *time.Location
+	WeekStartDay() time.Weekday
+	LimitThresholds() []int
+	Currencies() []string
+	MaxRateAge() time.Duration
+	RefuseStaleRates() bool
 }
 
-type handler func(ctx context.Context, arg string, user int64) (string, error)
+type handler func(ctx context.Context, arg string, user int64) (response.Message, error)
+
+type textHandler func(ctx context.Context, arg string, user int64) (string, error)
 
 type handlerMap map[string]handler
 
 type HandlerService struct {
 	handlersMap     handlerMap
 	storage         userStorage
+	rates           historicalRates
 	cache           reportCache
 	producer        reportRequestProducer
 	defaultCurrency string
+	defaultLocation *time.Location
+	weekStart       time.Weekday
+	limitThresholds []int
+	currencies      []string
+	maxRateAge      time.Duration
+	refuseStale     bool
+	imports         *pendingImports
+	historyQueries  *historyQueries
 }
 
 func newHandler(config config,
 	userStorage userStorage,
+	rates historicalRates,
 	cache reportCache,
 	producer reportRequestProducer) *HandlerService {
 	res := &HandlerService{
 		handlersMap:     nil,
 		storage:         userStorage,
+		rates:           rates,
 		cache:           cache,
 		producer:        producer,
 		defaultCurrency: config.BaseCurrency(),
+		defaultLocation: config.Location(),
+		weekStart:       config.WeekStartDay(),
+		limitThresholds: config.LimitThresholds(),
+		currencies:      config.Currencies(),
+		maxRateAge:      config.MaxRateAge(),
+		refuseStale:     config.RefuseStaleRates(),
+		imports:         newPendingImports(),
+		historyQueries:  newHistoryQueries(),
 	}
 	res.handlersMap = newMap(res)
 	return res
 }
 
-func (s *HandlerService) HandleMessage(ctx context.Context, text string, userID int64) (string, error) {
+func (s *HandlerService) HandleMessage(ctx context.Context, text string, userID int64) (response.Message, error) {
 	cmd, arg := parseCommand(text)
 
 	span, ctx := opentracing.StartSpanFromContext(ctx, "handleCommand")
@@ -122,22 +249,48 @@ func (s *HandlerService) HandleMessage(ctx context.Context, text string, userID
 	if ok {
 		return handler(ctx, arg, userID)
 	}
-	return dontUnderstandMessage, nil
+	return response.Message{Text: dontUnderstandMessage}, nil
 }
 
 func newMap(s *HandlerService) handlerMap {
 	m := make(handlerMap)
-	m[startCmd] = s.handleStart
-	m[expenseCmd] = s.handleExpense
-	m[reportCmd] = s.handleReport
-	m[currencyCmd] = s.handleCurrency
-	m[limitCmd] = s.handleLimit
+	m[startCmd] = text(s.handleStart)
+	m[expenseCmd] = text(s.handleExpense)
+	m[reportCmd] = text(s.handleReport)
+	m[currencyCmd] = text(s.handleCurrency)
+	m[limitCmd] = text(s.handleLimit)
+	m[timezoneCmd] = text(s.handleTimezone)
+	m[budgetCmd] = text(s.handleBudget)
+	m[limitModeCmd] = text(s.handleLimitMode)
+	m[incomeCmd] = text(s.handleIncome)
+	m[balanceCmd] = text(s.handleBalance)
+	m[deleteCmd] = text(s.handleDelete)
+	m[editCmd] = text(s.handleEdit)
+	m[undoCmd] = text(s.handleUndo)
+	m[historyCmd] = s.handleHistory
+	m[historyPageCmd] = s.handleHistoryPage
+	m[convertCmd] = text(s.handleConvert)
+	m[ratesCmd] = text(s.handleRates)
+	m[accountCmd] = text(s.handleAccount)
+	m[transferCmd] = text(s.handleTransfer)
+	m[recurringCmd] = text(s.handleRecurring)
+	m[categoryCmd] = text(s.handleCategory)
+	m[exportCmd] = text(s.handleExport)
+	m[importCmd] = text(s.handleImport)
 
-	m[""] = s.handleNoCommand
+	m[""] = text(s.handleNoCommand)
 
 	return m
 }
 
+// text adapts handlers answering with a plain text only.
+func text(h textHandler) handler {
+	return func(ctx context.Context, arg string, user int64) (response.Message, error) {
+		res, err := h(ctx, arg, user)
+		return response.Message{Text: res}, err
+	}
+}
+
 func (s *HandlerService) handleStart(ctx context.Context, _ string, userID int64) (string, error) {
 	logger.Info("handleStart - start", zap.Int64("userID", userID))
 	defer logger.Info("handleStart - end")
@@ -156,88 +309,545 @@ func (s *HandlerService) handleExpense(ctx context.Context, arg string, userID i
 	defer func() {
 		// invalidate cache in case of success
 		if err == nil {
-			opts := reports.ReportPeriods()
-			cacheErr := s.cache.InvalidateCache(userID, opts)
-			if cacheErr != nil {
-				logger.Error("failed to invalidate cache", zap.Error(cacheErr))
-			}
+			s.invalidateReports(userID)
 		}
 	}()
 
-	args := strings.Fields(arg)
+	parsed, msg, err := splitExpenseArgs(arg)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle expense")
+	}
+	if len(parsed.args) < expenseCmdParts {
+		return incorrectUsageMessage, nil
+	}
+	userRec, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotGetExpensesMessage, errors.Wrap(err, "handle expense")
+	}
+	expense, msg, err := parseExpense(parsed.args, userRec.LocationOrDefault(s.defaultLocation))
+	if err != nil {
+		return msg, errors.Wrap(err, "handle expense")
+	}
+	expense.Tags, expense.Note = parsed.tags, parsed.note
+	category, categoryHint, err := s.resolveCategory(ctx, userID, expense.Category)
+	if err != nil {
+		return categoryHint, errors.Wrap(err, "handle expense")
+	}
+	expense.Category = category
+	acc, msg, err := s.accountOf(ctx, userID, parsed.account)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle expense")
+	}
+
+	curr := s.operationCurrency(userRec, acc)
+	msg, err = checkPrecision(expense.Amount, curr)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle expense")
+	}
+
+	rateWarning, err := s.convertExpense(ctx, curr, &expense)
+	if err != nil {
+		return rateErrorMessage(err), errors.Wrap(err, "handle expense")
+	}
+	expense.AccountID, expense.Account = acc.ID, acc.Name
+
+	id, err := s.storage.SaveExpense(ctx, userID, expense)
+	if err != nil {
+		if msg, ok := limitErrorMessage(err); ok {
+			return msg, err
+		}
+		return cannotSaveExpenseMessage, errors.Wrap(err, "handle expense")
+	}
+	return withWarning(withWarning(
+		s.withLimitWarning(ctx, userRec, userID, expense.Category, expense.Created, fmt.Sprintf(expenseSavedTemplate, id)),
+		rateWarning), categoryHint), nil
+}
+
+func (s *HandlerService) handleIncome(ctx context.Context, arg string, userID int64) (res string, err error) {
+	logger.Info("handleIncome - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleIncome - end")
+
+	defer func() {
+		// invalidate cache in case of success
+		if err == nil {
+			s.invalidateReports(userID)
+		}
+	}()
+
+	args, accountName := extractAccount(strings.Fields(arg))
 	if len(args) < expenseCmdParts {
 		return incorrectUsageMessage, nil
 	}
-	amount, err := strconv.ParseFloat(args[1], floatBitSize)
-	if err != nil || amount <= 0 {
-		return incorrectExpenseMessage, errors.Wrap(err, "handle expense")
+	userRec, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotSaveIncomeMessage, errors.Wrap(err, "handle income")
+	}
+	parsed, msg, err := parseIncome(args, userRec.LocationOrDefault(s.defaultLocation))
+	if err != nil {
+		return msg, errors.Wrap(err, "handle income")
+	}
+	acc, msg, err := s.accountOf(ctx, userID, accountName)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle income")
+	}
+	curr := s.operationCurrency(userRec, acc)
+	msg, err = checkPrecision(parsed.Amount, curr)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle income")
+	}
+
+	rateWarning, err := s.convertExpense(ctx, curr, &parsed)
+	if err != nil {
+		return rateErrorMessage(err), errors.Wrap(err, "handle income")
+	}
+
+	id, err := s.storage.SaveIncome(ctx, userID, user.IncomeRecord{
+		Amount:         parsed.Amount,
+		Source:         parsed.Category,
+		Created:        parsed.Created,
+		OriginalAmount: parsed.OriginalAmount,
+		Currency:       parsed.Currency,
+		AccountID:      acc.ID,
+	})
+	if err != nil {
+		return cannotSaveIncomeMessage, errors.Wrap(err, "handle income")
+	}
+	return withWarning(fmt.Sprintf(incomeSavedTemplate, id), rateWarning), nil
+}
+
+func (s *HandlerService) handleBalance(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleBalance - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleBalance - end")
+
+	userRec, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotGetBalanceMessage, errors.Wrap(err, "handle balance")
+	}
+	loc := userRec.LocationOrDefault(s.defaultLocation)
+	rng, ok := parsePeriod(strings.TrimSpace(arg), time.Now().In(loc), s.weekStart)
+	if !ok {
+		return fmt.Sprintf(unsupportedPeriodTemplate, strings.Join(namedPeriods(), ", ")), nil
+	}
+
+	curr := userRec.PreferredCurrencyOrDefault(s.defaultCurrency)
+	rate, err := s.storage.GetRate(ctx, curr)
+	if err != nil {
+		return cannotGetRateMessage, errors.Wrap(err, "handle balance")
+	}
+	income, expenses, err := s.storage.GetBalance(ctx, userID, rng.From, rng.To)
+	if err != nil {
+		return cannotGetBalanceMessage, errors.Wrap(err, "handle balance")
+	}
+
+	income, expenses = income.Mul(rate.BaseRate), expenses.Mul(rate.BaseRate)
+	return fmt.Sprintf(balanceTemplate,
+		formatMoney(income, curr),
+		formatMoney(expenses, curr),
+		formatMoney(income-expenses, curr),
+	), nil
+}
+
+func (s *HandlerService) handleEdit(ctx context.Context, arg string, userID int64) (res string, err error) {
+	logger.Info("handleEdit - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleEdit - end")
+
+	defer func() {
+		// invalidate cache in case of success
+		if err == nil {
+			s.invalidateReports(userID)
+		}
+	}()
+
+	parsed, msg, err := splitExpenseArgs(arg)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle edit")
+	}
+	if len(parsed.args) < editCmdParts {
+		return incorrectUsageMessage, nil
+	}
+	id, err := strconv.ParseInt(parsed.args[0], idBase, idBitSize)
+	if err != nil {
+		return incorrectExpenseIDMessage, errors.Wrap(err, "handle edit")
+	}
+	userRec, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotGetExpensesMessage, errors.Wrap(err, "handle edit")
+	}
+	expense, msg, err := parseExpense(parsed.args[1:], userRec.LocationOrDefault(s.defaultLocation))
+	if err != nil {
+		return msg, errors.Wrap(err, "handle edit")
+	}
+	expense.Tags, expense.Note = parsed.tags, parsed.note
+	expense.ID = id
+	category, categoryHint, err := s.resolveCategory(ctx, userID, expense.Category)
+	if err != nil {
+		return categoryHint, errors.Wrap(err, "handle edit")
+	}
+	expense.Category = category
+	acc, curr, msg, err := s.editedAccount(ctx, userRec, userID, id, parsed.account)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle edit")
+	}
+	msg, err = checkPrecision(expense.Amount, curr)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle edit")
+	}
+
+	rateWarning, err := s.convertExpense(ctx, curr, &expense)
+	if err != nil {
+		return rateErrorMessage(err), errors.Wrap(err, "handle edit")
+	}
+	expense.AccountID, expense.Account = acc.ID, acc.Name
+
+	err = s.storage.UpdateExpense(ctx, userID, expense)
+	if err != nil {
+		if msg, ok := limitErrorMessage(err); ok {
+			return msg, err
+		}
+		var notFoundErr *customerr.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return expenseNotFoundMessage, err
+		}
+		return cannotEditExpenseMessage, errors.Wrap(err, "handle edit")
+	}
+	return withWarning(withWarning(
+		s.withLimitWarning(ctx, userRec, userID, expense.Category, expense.Created, okMessage), rateWarning), categoryHint), nil
+}
+
+// editedAccount returns the account and the currency of the edited expense.
+// Without an account name the expense stays on its current account and in its currency.
+// In case of an error it returns the message to be shown to user.
+func (s *HandlerService) editedAccount(ctx context.Context, userRec user.Record, userID, expenseID int64,
+	name string) (user.Account, string, string, error) {
+	if name != "" {
+		acc, msg, err := s.accountOf(ctx, userID, name)
+		return acc, s.operationCurrency(userRec, acc), msg, err
+	}
+
+	cur, err := s.storage.GetExpense(ctx, userID, expenseID)
+	if err != nil {
+		var notFoundErr *customerr.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return user.Account{}, "", expenseNotFoundMessage, err
+		}
+		return user.Account{}, "", cannotEditExpenseMessage, err
+	}
+	curr := cur.Currency
+	if curr == "" {
+		// expenses saved before original amounts were stored are in base currency
+		curr = s.defaultCurrency
+	}
+	return user.Account{ID: cur.AccountID, Name: cur.Account}, curr, "", nil
+}
+
+func (s *HandlerService) handleDelete(ctx context.Context, arg string, userID int64) (res string, err error) {
+	logger.Info("handleDelete - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleDelete - end")
+
+	defer func() {
+		// invalidate cache in case of success
+		if err == nil {
+			s.invalidateReports(userID)
+		}
+	}()
+
+	id, err := strconv.ParseInt(strings.TrimSpace(arg), idBase, idBitSize)
+	if err != nil {
+		return incorrectExpenseIDMessage, errors.Wrap(err, "handle delete")
+	}
+
+	err = s.storage.DeleteExpense(ctx, userID, id)
+	if err != nil {
+		var notFoundErr *customerr.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return expenseNotFoundMessage, err
+		}
+		return cannotDeleteExpenseMessage, errors.Wrap(err, "handle delete")
+	}
+	return okMessage, nil
+}
+
+func (s *HandlerService) handleUndo(ctx context.Context, arg string, userID int64) (res string, err error) {
+	logger.Info("handleUndo - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleUndo - end")
+
+	n := defaultUndoCount
+	if arg = strings.TrimSpace(arg); arg != "" {
+		n, err = strconv.Atoi(arg)
+		if err != nil || n < 1 || n > maxUndoCount {
+			return fmt.Sprintf(incorrectUndoCountTemplate, maxUndoCount), errors.Wrap(err, "handle undo")
+		}
+	}
+
+	undone, err := s.storage.UndoActions(ctx, userID, n)
+	if err != nil {
+		return cannotUndoMessage, errors.Wrap(err, "handle undo")
+	}
+	if undone == 0 {
+		return nothingToUndoMessage, nil
+	}
+
+	s.invalidateReports(userID)
+	return fmt.Sprintf(undoneTemplate, undone), nil
+}
+
+// parseExpense parses "<category> <amount> [date]" arguments, the date is taken in the given location.
+// In case of an error it returns the message to be shown to user.
+func parseExpense(args []string, loc *time.Location) (user.ExpenseRecord, string, error) {
+	if len(args) < expenseCmdParts {
+		return user.ExpenseRecord{}, incorrectUsageMessage, errors.New("not enough arguments")
+	}
+	amount, err := money.Parse(args[1])
+	if err != nil {
+		return user.ExpenseRecord{}, incorrectExpenseMessage, err
+	}
+	if amount <= 0 {
+		return user.ExpenseRecord{}, incorrectExpenseMessage, errors.New("non-positive amount")
+	}
+	category, date := user.NormalizeCategory(args[0]), time.Now()
+	if category == "" {
+		return user.ExpenseRecord{}, incorrectCategoryMessage, errors.New("empty category")
 	}
-	category, date := args[0], time.Now()
 	if len(args) > expenseCmdParts {
-		date, err = time.ParseInLocation(dateLayout, args[2], location())
+		date, err = time.ParseInLocation(dateLayout, args[2], loc)
 		if err != nil {
-			return incorrectDateMessage, errors.Wrap(err, "handle expense")
+			return user.ExpenseRecord{}, incorrectDateMessage, err
 		}
 	}
-
-	expense := user.ExpenseRecord{
+	return user.ExpenseRecord{
 		Amount:   amount,
 		Category: category,
 		Created:  date,
+	}, "", nil
+}
+
+// parseIncome parses "<source> <amount> [date]" arguments, the same shape as the expense ones,
+// the source is returned as the category. In case of an error it returns the message to be shown to user.
+func parseIncome(args []string, loc *time.Location) (user.ExpenseRecord, string, error) {
+	parsed, msg, err := parseExpense(args, loc)
+	switch msg {
+	case incorrectExpenseMessage:
+		msg = incorrectIncomeMessage
+	case incorrectCategoryMessage:
+		msg = incorrectSourceMessage
 	}
+	return parsed, msg, err
+}
 
-	userRec, err := s.storage.GetUserByID(ctx, userID)
+// convertExpense converts expense amount from the currency it is typed in to base one.
+// Backdated expenses are converted at the rate of their day.
+// It returns a warning to be shown to user if the current rate is stale.
+func (s *HandlerService) convertExpense(ctx context.Context, curr string, expense *user.ExpenseRecord) (string, error) {
+	var rate currency.Rate
+	var warning string
+	var err error
+	if isBackdated(expense.Created) {
+		rate, err = s.rates.RateAt(ctx, curr, expense.Created)
+	} else {
+		rate, warning, err = s.currentRate(ctx, curr)
+	}
 	if err != nil {
-		return cannotGetExpensesMessage, errors.Wrap(err, "handle expense")
+		return "", err
 	}
 
-	rate, err := s.storage.GetRate(ctx, userRec.PreferredCurrencyOrDefault(s.defaultCurrency))
+	convertExpenseToBase(expense, curr, rate.BaseRate)
+	return warning, nil
+}
+
+// currentRate returns the latest rate of the currency to convert user input with.
+// A rate older than max rate age is either refused with StaleRateError or returned along with a warning.
+func (s *HandlerService) currentRate(ctx context.Context, curr string) (currency.Rate, string, error) {
+	rate, err := s.storage.GetRate(ctx, curr)
 	if err != nil {
-		return cannotGetRateMessage, errors.Wrap(err, "handle expense")
+		return currency.Rate{}, "", err
+	}
+	// base currency rate is always 1 however old it is
+	if s.maxRateAge == 0 || curr == s.defaultCurrency {
+		return rate, "", nil
+	}
+
+	age := time.Since(rate.UpdatedAt)
+	if age <= s.maxRateAge {
+		return rate, "", nil
+	}
+	if s.refuseStale {
+		return currency.Rate{}, "", &customerr.StaleRateError{Currency: curr, Age: age}
+	}
+	return rate, fmt.Sprintf(staleRateWarningTemplate, curr, formatAge(age)), nil
+}
+
+// rateErrorMessage returns the message to be shown to user when a rate can't be used.
+func rateErrorMessage(err error) string {
+	var staleErr *customerr.StaleRateError
+	if errors.As(err, &staleErr) {
+		return fmt.Sprintf(staleRateRefusedTemplate, staleErr.Currency, formatAge(staleErr.Age))
 	}
+	return cannotGetRateMessage
+}
+
+// limitErrorMessage returns the message to be shown to user when an expense is rejected by limits.
+func limitErrorMessage(err error) (string, bool) {
+	var limErr *customerr.LimitError
+	if errors.As(err, &limErr) {
+		return limitExceededMessage, true
+	}
+	var budgetErr *customerr.BudgetError
+	if errors.As(err, &budgetErr) {
+		return fmt.Sprintf(budgetExceededTemplate, budgetErr.Category), true
+	}
+	return "", false
+}
+
+func withWarning(msg, warning string) string {
+	if warning == "" {
+		return msg
+	}
+	return msg + "\n" + warning
+}
 
-	convertExpenseToBase(&expense, rate.BaseRate)
-	err = s.storage.SaveExpense(ctx, userID, expense)
+// withLimitWarning appends warnings about the highest month limit threshold reached for the first time
+// and the exceeded budget of the category in the month of the given moment, in soft limit mode only
+// as hard one rejects exceeding expenses.
+// Failures are only logged, as the expense itself has already been saved.
+func (s *HandlerService) withLimitWarning(ctx context.Context, userRec user.Record, userID int64, category string,
+	at time.Time, msg string) string {
+	if !userRec.SoftLimit {
+		return msg
+	}
+	fired, overBudget, err := s.storage.FireLimitWarnings(ctx, userID, category, at, s.limitThresholds)
 	if err != nil {
-		var limErr *customerr.LimitError
-		if errors.As(err, &limErr) {
-			return limitExceededMessage, err
+		logger.Error("failed to fire limit warnings", zap.Int64("userID", userID), zap.Error(err))
+		return msg
+	}
+	if len(fired) > 0 {
+		highest := fired[0]
+		for _, threshold := range fired {
+			if threshold > highest {
+				highest = threshold
+			}
 		}
-		return cannotSaveExpenseMessage, errors.Wrap(err, "handle expense")
+		msg = withWarning(msg, fmt.Sprintf(limitWarningTemplate, highest))
+	}
+	if overBudget {
+		msg = withWarning(msg, fmt.Sprintf(budgetWarningTemplate, category))
+	}
+	return msg
+}
+
+func (s *HandlerService) invalidateReports(userID int64) {
+	opts := reports.ReportPeriods()
+	cacheErr := s.cache.InvalidateCache(userID, opts)
+	if cacheErr != nil {
+		logger.Error("failed to invalidate cache", zap.Error(cacheErr))
 	}
-	return okMessage, nil
 }
 
-func (s *HandlerService) handleReport(_ context.Context, arg string, userID int64) (result string, err error) {
+func (s *HandlerService) handleReport(ctx context.Context, arg string, userID int64) (result string, err error) {
 	logger.Info("handleReport - start", zap.Int64("userID", userID), zap.String("arg", arg))
 	defer logger.Info("handleReport - end")
 
-	report, err := s.cache.GetReport(userID, arg)
-	if err == nil {
-		return report, nil
+	args, tags := extractTags(strings.Fields(arg))
+	if len(tags) > 1 {
+		return incorrectUsageMessage, nil
+	}
+	args, account := extractAccount(args)
+	byAccount := false
+	periodArgs := make([]string, 0, len(args))
+	for _, a := range args {
+		if strings.EqualFold(a, byAccountArg) {
+			byAccount = true
+			continue
+		}
+		periodArgs = append(periodArgs, a)
+	}
+	// the period may be followed by a category to drill down into
+	var period, category string
+	switch len(periodArgs) {
+	case 0:
+	case 1:
+		period = periodArgs[0]
+	case reportCmdParts:
+		period, category = periodArgs[0], user.NormalizeCategory(periodArgs[1])
+		if category == "" {
+			return incorrectCategoryMessage, nil
+		}
+		// an unknown category is kept as typed, so nothing is found
+		category, _, err = s.resolveCategory(ctx, userID, category)
+		if err != nil {
+			return cannotGenReportMessage, errors.Wrap(err, "handle report")
+		}
+	default:
+		return incorrectUsageMessage, nil
+	}
+	req := &apiv1.ReportRequest{
+		UserID:    userID,
+		Period:    period,
+		Account:   account,
+		ByAccount: byAccount,
+		Category:  category,
+	}
+	if len(tags) == 1 {
+		req.Tag = tags[0]
 	}
 
-	logger.Info(
-		"failed to get report from cache, request generation",
-		zap.Int64("userID", userID),
-		zap.String("arg", arg),
-		zap.NamedError("cacheErr", err),
-	)
+	// only unfiltered named periods are cached, as they are the ones invalidated on changes
+	if isCachedReport(req) {
+		report, cacheErr := s.cache.GetReport(userID, period)
+		if cacheErr == nil {
+			return report, nil
+		}
+		logger.Info(
+			"failed to get report from cache, request generation",
+			zap.Int64("userID", userID),
+			zap.String("arg", arg),
+			zap.NamedError("cacheErr", cacheErr),
+		)
+	}
+	if msg, err := s.requestReport(ctx, req); err != nil || msg != "" {
+		return msg, errors.Wrap(err, "handle report")
+	}
+	return generatingReport, nil
+}
 
-	req, err := proto.Marshal(&apiv1.ReportRequest{
-		UserID: userID,
-		Period: arg,
-	})
-	if err != nil {
-		return cannotGenReportMessage, errors.Wrap(err, "handle report")
+// requestReport asks reporter to generate the report, a period that is not a named one is parsed as a date range.
+// It returns the message to be shown to user if the report is not requested.
+func (s *HandlerService) requestReport(ctx context.Context, req *apiv1.ReportRequest) (string, error) {
+	if !utils.Contains(reports.ReportPeriods(), req.GetPeriod()) {
+		userRec, err := s.storage.GetUserByID(ctx, req.GetUserID())
+		if err != nil {
+			return cannotGenReportMessage, err
+		}
+		rng, ok := parseDateRange(req.GetPeriod(), userRec.LocationOrDefault(s.defaultLocation))
+		if !ok {
+			return fmt.Sprintf(unsupportedPeriodTemplate, strings.Join(namedPeriods(), ", ")), nil
+		}
+		req.From = timestamppb.New(rng.From)
+		req.To = timestamppb.New(rng.To)
 	}
 
-	err = s.producer.ProduceMessage(req)
+	msg, err := proto.Marshal(req)
 	if err != nil {
-		return cannotGenReportMessage, errors.Wrap(err, "handle report")
+		return cannotGenReportMessage, err
 	}
+	err = s.producer.ProduceMessage(msg)
+	if err != nil {
+		return cannotGenReportMessage, err
+	}
+	return "", nil
+}
 
-	return generatingReport, nil
+// reportParams are the parameters both report requests and results carry.
+type reportParams interface {
+	GetPeriod() string
+	GetAccount() string
+	GetByAccount() bool
+	GetTag() string
+	GetCategory() string
+}
+
+func isCachedReport(p reportParams) bool {
+	return p.GetAccount() == "" && !p.GetByAccount() && p.GetTag() == "" && p.GetCategory() == "" &&
+		utils.Contains(reports.ReportPeriods(), p.GetPeriod())
 }
 
 func (s *HandlerService) AcceptReport(_ context.Context, report *apiv12.ReportResult) (result string, err error) {
@@ -246,7 +856,7 @@ func (s *HandlerService) AcceptReport(_ context.Context, report *apiv12.ReportRe
 
 	defer func() {
 		// cache report in case of successful generation
-		if err == nil {
+		if err == nil && isCachedReport(report) {
 			cacheErr := s.cache.CacheReport(report.GetUserID(), report.GetPeriod(), result)
 			if cacheErr != nil {
 				logger.Error("error caching report", zap.Error(cacheErr))
@@ -258,7 +868,7 @@ func (s *HandlerService) AcceptReport(_ context.Context, report *apiv12.ReportRe
 		return cannotGenReportMessage, errors.Wrap(errors.New((*report).GetStatus().GetError()), "accept report")
 	}
 
-	if len(report.GetRecords()) == 0 {
+	if len(report.GetRecords()) == 0 && len(report.GetIncomes()) == 0 {
 		return noExpensesMessage, nil
 	}
 
@@ -269,9 +879,9 @@ func (s *HandlerService) handleCurrency(ctx context.Context, arg string, userID
 	logger.Info("handleCurrency - start", zap.Int64("userID", userID), zap.String("arg", arg))
 	defer logger.Info("handleCurrency - end")
 
-	curr := arg
-	if !utils.Contains(currency.Currencies, curr) {
-		return fmt.Sprintf(invalidCurrencyTemplate, strings.Join(currency.Currencies, ", ")),
+	curr := strings.ToUpper(strings.TrimSpace(arg))
+	if !utils.Contains(s.currencies, curr) {
+		return fmt.Sprintf(invalidCurrencyTemplate, strings.Join(s.currencies, ", ")),
 			errors.New("handle currency")
 	}
 
@@ -292,7 +902,7 @@ func (s *HandlerService) handleLimit(ctx context.Context, arg string, userID int
 	logger.Info("handleLimit - start", zap.Int64("userID", userID), zap.String("arg", arg))
 	defer logger.Info("handleLimit - end")
 
-	limit, err := strconv.ParseFloat(arg, floatBitSize)
+	limit, err := money.Parse(arg)
 	if err != nil {
 		return incorrectLimitMessage, errors.Wrap(err, "handle limit")
 	}
@@ -301,15 +911,113 @@ func (s *HandlerService) handleLimit(ctx context.Context, arg string, userID int
 	if err != nil {
 		return cannotSetLimitMessage, errors.Wrap(err, "handle limit")
 	}
-	rate, err := s.storage.GetRate(ctx, u.PreferredCurrencyOrDefault(s.defaultCurrency))
+	curr := u.PreferredCurrencyOrDefault(s.defaultCurrency)
+	if msg, err := checkPrecision(limit, curr); err != nil {
+		return msg, errors.Wrap(err, "handle limit")
+	}
+	rate, rateWarning, err := s.currentRate(ctx, curr)
 	if err != nil {
-		return cannotGetRateMessage, errors.Wrap(err, "handle limit")
+		return rateErrorMessage(err), errors.Wrap(err, "handle limit")
 	}
 	u.MonthLimit = convertToBase(limit, rate.BaseRate)
 	if err = s.storage.SaveUserByID(ctx, userID, u); err != nil {
 		return cannotSetLimitMessage, errors.Wrap(err, "handle limit")
 	}
 
+	return withWarning(okMessage, rateWarning), nil
+}
+
+func (s *HandlerService) handleBudget(ctx context.Context, arg string, userID int64) (res string, err error) {
+	logger.Info("handleBudget - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleBudget - end")
+
+	args := strings.Fields(arg)
+	if len(args) != budgetCmdParts {
+		return incorrectUsageMessage, nil
+	}
+	amount, err := money.Parse(args[1])
+	if err != nil || amount < 0 {
+		return incorrectLimitMessage, errors.Wrap(err, "handle budget")
+	}
+	typed := user.NormalizeCategory(args[0])
+	if typed == "" {
+		return incorrectCategoryMessage, errors.New("handle budget: empty category")
+	}
+	category, categoryHint, err := s.resolveCategory(ctx, userID, typed)
+	if err != nil {
+		return categoryHint, errors.Wrap(err, "handle budget")
+	}
+
+	u, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotSetBudgetMessage, errors.Wrap(err, "handle budget")
+	}
+	curr := u.PreferredCurrencyOrDefault(s.defaultCurrency)
+	if msg, err := checkPrecision(amount, curr); err != nil {
+		return msg, errors.Wrap(err, "handle budget")
+	}
+	rate, rateWarning, err := s.currentRate(ctx, curr)
+	if err != nil {
+		return rateErrorMessage(err), errors.Wrap(err, "handle budget")
+	}
+	err = s.storage.SaveBudget(ctx, userID, category, convertToBase(amount, rate.BaseRate))
+	if err != nil {
+		return cannotSetBudgetMessage, errors.Wrap(err, "handle budget")
+	}
+
+	return withWarning(withWarning(okMessage, rateWarning), categoryHint), nil
+}
+
+// handleLimitMode switches between rejecting exceeding expenses (hard) and warning about them (soft).
+func (s *HandlerService) handleLimitMode(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleLimitMode - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleLimitMode - end")
+
+	var soft bool
+	switch strings.ToLower(strings.TrimSpace(arg)) {
+	case limitModeSoft:
+		soft = true
+	case limitModeHard:
+		soft = false
+	default:
+		return incorrectLimitModeMessage, nil
+	}
+
+	u, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotSetLimitMessage, errors.Wrap(err, "handle limit mode")
+	}
+	u.SoftLimit = soft
+	if err = s.storage.SaveUserByID(ctx, userID, u); err != nil {
+		return cannotSetLimitMessage, errors.Wrap(err, "handle limit mode")
+	}
+
+	return okMessage, nil
+}
+
+func (s *HandlerService) handleTimezone(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleTimezone - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleTimezone - end")
+
+	name := strings.TrimSpace(arg)
+	// empty name and "Local" are accepted by time.LoadLocation but mean nothing to the user
+	if name == "" || name == "Local" {
+		return incorrectTimezoneMessage, errors.New("handle timezone: empty timezone")
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return incorrectTimezoneMessage, errors.Wrap(err, "handle timezone")
+	}
+
+	u, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotSetTimezoneMessage, errors.Wrap(err, "handle timezone")
+	}
+	u.SetTimezone(name)
+	if err = s.storage.SaveUserByID(ctx, userID, u); err != nil {
+		return cannotSetTimezoneMessage, errors.Wrap(err, "handle timezone")
+	}
+
+	s.invalidateReports(userID)
 	return okMessage, nil
 }
 
@@ -0,0 +1,214 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/response"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+)
+
+const (
+	historyPageSize = 10
+	// historyPageParts are "<query key> <page>"
+	historyPageParts = 2
+	// historyQueryTTL is how long the keyboard of a history listing keeps working
+	historyQueryTTL = 24 * time.Hour
+)
+
+const (
+	noHistoryMessage        = "No expenses found"
+	cannotGetHistoryMessage = "Can't get your expenses history atm. Try later"
+	historyHeaderTemplate   = "Expenses, page %d:"
+	historyRecordTemplate   = "#%d %s %s: %s"
+	prevPageButton          = "« Prev"
+	nextPageButton          = "Next »"
+	historyExpiredMessage   = "This history has expired. Send /history again"
+)
+
+// historyQuery is the filter of a history listing typed by user.
+type historyQuery struct {
+	userID  int64
+	arg     string
+	expires time.Time
+}
+
+// historyQueries keeps the filters of history listings, so that keyboard buttons refer to them by a short key.
+// Filters themselves may not fit the 64 bytes Telegram allows for button data.
+type historyQueries struct {
+	mu      sync.Mutex
+	lastKey int64
+	byKey   map[int64]historyQuery
+}
+
+func newHistoryQueries() *historyQueries {
+	return &historyQueries{byKey: make(map[int64]historyQuery)}
+}
+
+// add keeps the filter of the user and returns its key.
+func (q *historyQueries) add(userID int64, arg string, at time.Time) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// expired filters are dropped here, as there is no other place to do that
+	for key, query := range q.byKey {
+		if at.After(query.expires) {
+			delete(q.byKey, key)
+		}
+	}
+	q.lastKey++
+	q.byKey[q.lastKey] = historyQuery{userID: userID, arg: arg, expires: at.Add(historyQueryTTL)}
+	return q.lastKey
+}
+
+// get returns the filter of the user by the key if it has not expired.
+func (q *historyQueries) get(userID, key int64, at time.Time) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query, ok := q.byKey[key]
+	if !ok || query.userID != userID || at.After(query.expires) {
+		return "", false
+	}
+	return query.arg, true
+}
+
+func (s *HandlerService) handleHistory(ctx context.Context, arg string, userID int64) (response.Message, error) {
+	logger.Info("handleHistory - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleHistory - end")
+
+	return s.historyPage(ctx, arg, 0, 0, userID)
+}
+
+// handleHistoryPage handles "<query key> <page>" sent by history keyboard.
+func (s *HandlerService) handleHistoryPage(ctx context.Context, arg string, userID int64) (response.Message, error) {
+	logger.Info("handleHistoryPage - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleHistoryPage - end")
+
+	split := strings.Fields(arg)
+	if len(split) != historyPageParts {
+		return response.Message{Text: incorrectUsageMessage}, nil
+	}
+	key, err := strconv.ParseInt(split[0], idBase, idBitSize)
+	if err != nil {
+		return response.Message{Text: incorrectUsageMessage}, errors.Wrap(err, "handle history page")
+	}
+	page, err := strconv.ParseUint(split[1], idBase, idBitSize)
+	if err != nil {
+		return response.Message{Text: incorrectUsageMessage}, errors.Wrap(err, "handle history page")
+	}
+	histArg, ok := s.historyQueries.get(userID, key, time.Now())
+	if !ok {
+		return response.Message{Text: historyExpiredMessage}, nil
+	}
+	return s.historyPage(ctx, histArg, key, page, userID)
+}
+
+// historyPage lists the page of expenses matching the filter. The filter is kept for the keyboard
+// under a new key unless it is already kept under the given one.
+func (s *HandlerService) historyPage(ctx context.Context, arg string, key int64, page uint64,
+	userID int64) (response.Message, error) {
+	userRec, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return response.Message{Text: cannotGetHistoryMessage}, errors.Wrap(err, "history page")
+	}
+	loc := userRec.LocationOrDefault(s.defaultLocation)
+	filter, ok := parseHistoryFilter(arg, time.Now().In(loc), s.weekStart)
+	if !ok {
+		return response.Message{Text: incorrectUsageMessage}, nil
+	}
+	if filter.Category != "" {
+		// an unknown category is kept as typed, so nothing is found
+		filter.Category, _, err = s.resolveCategory(ctx, userID, filter.Category)
+		if err != nil {
+			return response.Message{Text: cannotGetHistoryMessage}, errors.Wrap(err, "history page")
+		}
+	}
+	curr := userRec.PreferredCurrencyOrDefault(s.defaultCurrency)
+	rate, err := s.storage.GetRate(ctx, curr)
+	if err != nil {
+		return response.Message{Text: cannotGetRateMessage}, errors.Wrap(err, "history page")
+	}
+
+	// one extra record shows if there is a next page
+	exps, err := s.storage.GetExpensesPage(ctx, userID, filter, page*historyPageSize, historyPageSize+1)
+	if err != nil {
+		return response.Message{Text: cannotGetHistoryMessage}, errors.Wrap(err, "history page")
+	}
+	if len(exps) == 0 {
+		return response.Message{Text: noHistoryMessage}, nil
+	}
+	hasNext := len(exps) > historyPageSize
+	if hasNext {
+		exps = exps[:historyPageSize]
+	}
+
+	if key == 0 && (page > 0 || hasNext) {
+		key = s.historyQueries.add(userID, arg, time.Now())
+	}
+	var buttons []response.Button
+	if page > 0 {
+		buttons = append(buttons, response.Button{Text: prevPageButton, Data: historyPageData(key, page-1)})
+	}
+	if hasNext {
+		buttons = append(buttons, response.Button{Text: nextPageButton, Data: historyPageData(key, page+1)})
+	}
+
+	return response.Message{
+		Text:    formatHistory(exps, page, rate.BaseRate, curr, loc),
+		Buttons: buttons,
+	}, nil
+}
+
+// parseHistoryFilter parses "[period] [category] [#tag]" arguments.
+// Period is either a named one resolved relative to the given moment or a date range in its location.
+func parseHistoryFilter(arg string, at time.Time, weekStart time.Weekday) (user.ExpenseFilter, bool) {
+	var filter user.ExpenseFilter
+	args, tags := extractTags(strings.Fields(arg))
+	switch len(tags) {
+	case 0:
+	case 1:
+		filter.Tag = tags[0]
+	default:
+		return user.ExpenseFilter{}, false
+	}
+	if len(args) > 0 {
+		if rng, ok := parsePeriod(args[0], at, weekStart); ok {
+			filter.From, filter.To = rng.From, rng.To
+			args = args[1:]
+		}
+	}
+	switch len(args) {
+	case 0:
+	case 1:
+		filter.Category = args[0]
+	default:
+		return user.ExpenseFilter{}, false
+	}
+	return filter, true
+}
+
+func historyPageData(key int64, page uint64) string {
+	return fmt.Sprintf("%s %d %d", historyPageCmd, key, page)
+}
+
+func formatHistory(exps []user.ExpenseRecord, page uint64, rate float64, curr string, loc *time.Location) string {
+	res := make([]string, 0, len(exps)+1)
+	res = append(res, fmt.Sprintf(historyHeaderTemplate, page+1))
+	for _, exp := range exps {
+		res = append(res, fmt.Sprintf(historyRecordTemplate,
+			exp.ID,
+			exp.Created.In(loc).Format(dateLayout),
+			exp.Category,
+			formatMoney(exp.AmountIn(curr, rate), curr),
+		)+formatTagsAndNote(exp.Tags, exp.Note))
+	}
+	return strings.Join(res, "\n")
+}
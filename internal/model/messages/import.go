@@ -0,0 +1,501 @@
+package messages
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/currency"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/response"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/rates"
+	"max.ks1230/finances-bot/internal/utils"
+)
+
+// Import columns
+const (
+	importDateColumn     = "date"
+	importCategoryColumn = "category"
+	importAmountColumn   = "amount"
+	importCurrencyColumn = "currency"
+	importNoteColumn     = "note"
+)
+
+const (
+	importConfirmCmd = "confirm"
+	importCancelCmd  = "cancel"
+)
+
+// importActionParts are "<confirm|cancel> <import id>"
+const importActionParts = 2
+
+const (
+	// pendingImportTTL is how long a previewed import waits to be confirmed
+	pendingImportTTL = 30 * time.Minute
+	// maxImportRows bounds the rows of one file not counting the header
+	maxImportRows = 10000
+	// maxPreviewErrors is how many row errors are listed in the preview
+	maxPreviewErrors = 5
+)
+
+// importDateLayouts are the accepted dates, the exported ones among them
+var importDateLayouts = []string{dateLayout, "2006-01-02"}
+
+// importDelimiters are the ones spreadsheets save CSV with
+var importDelimiters = []rune{',', ';', '\t'}
+
+// defaultImportHeaders are the header names of columns matched when no mapping is given,
+// the exported files are imported with their original amounts.
+var defaultImportHeaders = map[string][]string{
+	importDateColumn:     {"date"},
+	importCategoryColumn: {"category"},
+	importAmountColumn:   {"original_amount", "amount"},
+	importCurrencyColumn: {"currency"},
+	importNoteColumn:     {"note"},
+}
+
+var requiredImportColumns = []string{importDateColumn, importCategoryColumn, importAmountColumn}
+
+const (
+	importButton       = "Import"
+	cancelImportButton = "Cancel"
+)
+
+const (
+	importUsageMessage             = "Send me a CSV file with date, category and amount columns to import expenses"
+	cannotReadImportMessage        = "Can't read your file. Send a CSV file up to 1 MB"
+	emptyImportMessage             = "Your file has no rows to import"
+	importMappingTemplate          = "Columns are mapped like date=Date amount=3, the columns are: %s"
+	importColumnTemplate           = "I can't find the %s column. Map it like %s=<header or column number>"
+	tooManyImportRowsTemplate      = "Your file has too many rows. Import up to %d at once"
+	importPreviewTemplate          = "Rows: %d\nReady to import: %d\nWith errors: %d"
+	importRowErrorTemplate         = "Row %d: %s"
+	moreImportErrorsTemplate       = "...and %d more"
+	nothingToImportMessage         = "Nothing to import. Fix the rows and send the file again"
+	importExpiredMessage           = "This import has expired. Send the file again"
+	importCanceledMessage          = "Import canceled"
+	importedTemplate               = "Gotcha! Imported expenses: %d, skipped duplicates: %d"
+	cannotImportTemplate           = "Can't import your expenses atm. Try later. Imported before the failure: %d"
+	incorrectImportDateMessage     = "The date is incorrect. Should be dd.mm.yyyy or yyyy-mm-dd"
+	incorrectImportCategoryMessage = "The category is empty"
+	unknownImportCurrencyTemplate  = "I don't know currency %s"
+	missingImportFieldTemplate     = "There is no %s column"
+)
+
+// pendingImport is a previewed import waiting to be confirmed.
+type pendingImport struct {
+	id       int64
+	expenses []user.ExpenseRecord
+	expires  time.Time
+}
+
+// pendingImports keeps the last previewed import of every user.
+type pendingImports struct {
+	mu     sync.Mutex
+	lastID int64
+	byUser map[int64]pendingImport
+}
+
+func newPendingImports() *pendingImports {
+	return &pendingImports{byUser: make(map[int64]pendingImport)}
+}
+
+// add replaces the pending import of the user and returns its id.
+func (p *pendingImports) add(userID int64, expenses []user.ExpenseRecord, at time.Time) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// expired imports of other users are dropped here, as there is no other place to do that
+	for id, imp := range p.byUser {
+		if at.After(imp.expires) {
+			delete(p.byUser, id)
+		}
+	}
+	p.lastID++
+	p.byUser[userID] = pendingImport{id: p.lastID, expenses: expenses, expires: at.Add(pendingImportTTL)}
+	return p.lastID
+}
+
+// get returns the pending import of the user if it's the one with the id and it has not expired.
+func (p *pendingImports) get(userID, id int64, at time.Time) (pendingImport, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	imp, ok := p.byUser[userID]
+	if !ok || imp.id != id || at.After(imp.expires) {
+		return pendingImport{}, false
+	}
+	return imp, true
+}
+
+func (p *pendingImports) remove(userID, id int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if imp, ok := p.byUser[userID]; ok && imp.id == id {
+		delete(p.byUser, userID)
+	}
+}
+
+// importRowError is a row of the file which can't be imported.
+type importRowError struct {
+	row int
+	msg string
+}
+
+// HandleDocument previews the import of expenses from the CSV file. The first row of the file is the header.
+// The caption may map columns to the headers or numbers of the file, like "/import date=Дата amount=3".
+// Expenses are imported when the preview is confirmed.
+func (s *HandlerService) HandleDocument(ctx context.Context, doc response.Document, caption string,
+	userID int64) (response.Message, error) {
+	logger.Info("handleDocument - start", zap.Int64("userID", userID), zap.String("name", doc.Name))
+	defer logger.Info("handleDocument - end")
+
+	if doc.Content == nil {
+		return response.Message{Text: cannotReadImportMessage}, nil
+	}
+	cmd, arg := parseCommand(caption)
+	if cmd != "" && cmd != importCmd {
+		return response.Message{Text: importUsageMessage}, nil
+	}
+	mapping, ok := parseImportMapping(arg)
+	if !ok {
+		return response.Message{Text: fmt.Sprintf(importMappingTemplate, strings.Join(importColumns(), ", "))}, nil
+	}
+
+	rows, err := readImportRows(doc.Content)
+	if err != nil {
+		return response.Message{Text: cannotReadImportMessage}, errors.Wrap(err, "handle document")
+	}
+	if len(rows) < 2 {
+		return response.Message{Text: emptyImportMessage}, nil
+	}
+	if len(rows)-1 > maxImportRows {
+		return response.Message{Text: fmt.Sprintf(tooManyImportRowsTemplate, maxImportRows)}, nil
+	}
+	columns, msg := resolveImportColumns(rows[0], mapping)
+	if msg != "" {
+		return response.Message{Text: msg}, nil
+	}
+
+	userRec, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return response.Message{Text: cannotGetExpensesMessage}, errors.Wrap(err, "handle document")
+	}
+	expenses, rowErrors := s.parseImportRows(rows[1:], columns, userRec)
+	if msg, err = s.prepareImport(ctx, userID, expenses); err != nil {
+		return response.Message{Text: msg}, errors.Wrap(err, "handle document")
+	}
+
+	text := formatImportPreview(len(rows)-1, len(expenses), rowErrors)
+	if len(expenses) == 0 {
+		return response.Message{Text: withWarning(text, nothingToImportMessage)}, nil
+	}
+	id := s.imports.add(userID, expenses, time.Now())
+	return response.Message{
+		Text: text,
+		Buttons: []response.Button{
+			{Text: importButton, Data: importActionData(importConfirmCmd, id)},
+			{Text: cancelImportButton, Data: importActionData(importCancelCmd, id)},
+		},
+	}, nil
+}
+
+// handleImport handles "confirm <id>" and "cancel <id>" sent by the preview buttons.
+func (s *HandlerService) handleImport(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleImport - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleImport - end")
+
+	args := strings.Fields(arg)
+	if len(args) == 0 {
+		return importUsageMessage, nil
+	}
+	if len(args) != importActionParts {
+		return incorrectUsageMessage, nil
+	}
+	id, err := strconv.ParseInt(args[1], idBase, idBitSize)
+	if err != nil {
+		return incorrectUsageMessage, nil
+	}
+	imp, ok := s.imports.get(userID, id, time.Now())
+	if !ok {
+		return importExpiredMessage, nil
+	}
+
+	switch strings.ToLower(args[0]) {
+	case importConfirmCmd:
+		imported, err := s.storage.ImportExpenses(ctx, userID, imp.expenses)
+		if imported > 0 {
+			s.invalidateReports(userID)
+		}
+		if err != nil {
+			// the import is kept to be retried, the saved expenses are skipped as duplicates then
+			return fmt.Sprintf(cannotImportTemplate, imported), errors.Wrap(err, "handle import")
+		}
+		s.imports.remove(userID, id)
+		return fmt.Sprintf(importedTemplate, imported, len(imp.expenses)-imported), nil
+	case importCancelCmd:
+		s.imports.remove(userID, id)
+		return importCanceledMessage, nil
+	default:
+		return incorrectUsageMessage, nil
+	}
+}
+
+func importActionData(action string, id int64) string {
+	return fmt.Sprintf("%s %s %d", importCmd, action, id)
+}
+
+// importColumns returns the columns of an import, the required ones first.
+func importColumns() []string {
+	return []string{importDateColumn, importCategoryColumn, importAmountColumn, importCurrencyColumn, importNoteColumn}
+}
+
+// parseImportMapping parses "<column>=<header or number>" arguments.
+func parseImportMapping(arg string) (map[string]string, bool) {
+	mapping := make(map[string]string)
+	for _, a := range strings.Fields(arg) {
+		column, source, ok := strings.Cut(a, "=")
+		column = strings.ToLower(column)
+		if !ok || source == "" || !utils.Contains(importColumns(), column) {
+			return nil, false
+		}
+		mapping[column] = source
+	}
+	return mapping, true
+}
+
+// readImportRows reads the CSV records, the delimiter is guessed from the header.
+func readImportRows(content []byte) ([][]string, error) {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	header, _, _ := bytes.Cut(content, []byte("\n"))
+
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma = guessDelimiter(string(header))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+
+	rows := make([][]string, 0)
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, rec)
+		if len(rows) > maxImportRows+1 {
+			return rows, nil
+		}
+	}
+}
+
+func guessDelimiter(header string) rune {
+	res, best := importDelimiters[0], 0
+	for _, d := range importDelimiters {
+		if n := strings.Count(header, string(d)); n > best {
+			res, best = d, n
+		}
+	}
+	return res
+}
+
+// resolveImportColumns returns the indexes of the mapped columns, unmapped ones are looked up by default headers.
+// Optional columns missing in the file are left out. In case of an error it returns the message to be shown to user.
+func resolveImportColumns(header []string, mapping map[string]string) (map[string]int, string) {
+	headerIndex := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if _, ok := headerIndex[h]; !ok {
+			headerIndex[h] = i
+		}
+	}
+
+	columns := make(map[string]int)
+	for _, column := range importColumns() {
+		if source, ok := mapping[column]; ok {
+			i, found := headerIndex[strings.ToLower(source)]
+			if n, err := strconv.Atoi(source); !found && err == nil && n >= 1 && n <= len(header) {
+				i, found = n-1, true
+			}
+			if !found {
+				return nil, fmt.Sprintf(importColumnTemplate, column, column)
+			}
+			columns[column] = i
+			continue
+		}
+		for _, h := range defaultImportHeaders[column] {
+			if i, ok := headerIndex[h]; ok {
+				columns[column] = i
+				break
+			}
+		}
+	}
+	for _, column := range requiredImportColumns {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Sprintf(importColumnTemplate, column, column)
+		}
+	}
+	return columns, ""
+}
+
+// parseImportRows parses expenses of the rows, the dates are taken in the user location and the amounts
+// are in the currency of the row or the user preferred one. Rows are numbered as in the file, the header is the first.
+func (s *HandlerService) parseImportRows(rows [][]string, columns map[string]int,
+	userRec user.Record) ([]user.ExpenseRecord, []importRowError) {
+	loc := userRec.LocationOrDefault(s.defaultLocation)
+	defaultCurr := userRec.PreferredCurrencyOrDefault(s.defaultCurrency)
+
+	expenses := make([]user.ExpenseRecord, 0, len(rows))
+	var rowErrors []importRowError
+	for i, row := range rows {
+		exp, msg := s.parseImportRow(row, columns, loc, defaultCurr)
+		if msg != "" {
+			rowErrors = append(rowErrors, importRowError{row: i + 2, msg: msg})
+			continue
+		}
+		expenses = append(expenses, exp)
+	}
+	return expenses, rowErrors
+}
+
+// parseImportRow returns the expense of the row with the amount not converted yet
+// or the message to be shown to user.
+func (s *HandlerService) parseImportRow(row []string, columns map[string]int, loc *time.Location,
+	defaultCurr string) (user.ExpenseRecord, string) {
+	// a field is missing if the row is shorter than the header, unmapped optional fields are empty
+	field := func(column string) (string, bool) {
+		i, ok := columns[column]
+		if !ok {
+			return "", true
+		}
+		if i >= len(row) {
+			return "", false
+		}
+		return strings.TrimSpace(row[i]), true
+	}
+
+	var exp user.ExpenseRecord
+	for _, column := range requiredImportColumns {
+		if _, ok := field(column); !ok {
+			return exp, fmt.Sprintf(missingImportFieldTemplate, column)
+		}
+	}
+
+	date, _ := field(importDateColumn)
+	created, ok := parseImportDate(date, loc)
+	if !ok {
+		return exp, incorrectImportDateMessage
+	}
+	category, _ := field(importCategoryColumn)
+	if exp.Category = user.NormalizeCategory(category); exp.Category == "" {
+		return exp, incorrectImportCategoryMessage
+	}
+	amount, _ := field(importAmountColumn)
+	exp.Amount, ok = parsePositiveAmount(amount)
+	if !ok {
+		return exp, incorrectAmountMessage
+	}
+	curr, _ := field(importCurrencyColumn)
+	curr = strings.ToUpper(curr)
+	if curr == "" {
+		curr = defaultCurr
+	}
+	if !utils.Contains(s.currencies, curr) {
+		return exp, fmt.Sprintf(unknownImportCurrencyTemplate, curr)
+	}
+	if msg, err := checkPrecision(exp.Amount, curr); err != nil {
+		return exp, msg
+	}
+	exp.Note, _ = field(importNoteColumn)
+	exp.Created, exp.Currency = created, curr
+	return exp, ""
+}
+
+func parseImportDate(text string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parsePositiveAmount(text string) (money.Amount, bool) {
+	amount, err := money.Parse(text)
+	return amount, err == nil && amount > 0
+}
+
+// prepareImport resolves categories of the expenses, binds the ones in the currency of the default account
+// to it and converts them to base currency at the rates of their days, the rates of a currency are got at once.
+// In case of an error it returns the message to be shown to user.
+func (s *HandlerService) prepareImport(ctx context.Context, userID int64, expenses []user.ExpenseRecord) (string, error) {
+	acc, msg, err := s.accountOf(ctx, userID, "")
+	if err != nil {
+		return msg, err
+	}
+
+	categories := make(map[string]string)
+	days := make(map[string][]time.Time)
+	for i := range expenses {
+		exp := &expenses[i]
+
+		name, ok := categories[exp.Category]
+		if !ok {
+			var err error
+			// unknown categories become new ones, no hints are given for a file
+			if name, _, err = s.resolveCategory(ctx, userID, exp.Category); err != nil {
+				return cannotGetCategoriesMessage, err
+			}
+			categories[exp.Category] = name
+		}
+		exp.Category = name
+		if acc.ID != 0 && exp.Currency == acc.Currency {
+			exp.AccountID, exp.Account = acc.ID, acc.Name
+		}
+		days[exp.Currency] = append(days[exp.Currency], exp.Created)
+	}
+
+	dayRates := make(map[string]map[string]currency.Rate, len(days))
+	for curr, currDays := range days {
+		currRates, err := s.rates.DailyRates(ctx, curr, currDays)
+		if err != nil {
+			return cannotGetRateMessage, err
+		}
+		dayRates[curr] = currRates
+	}
+	for i := range expenses {
+		exp := &expenses[i]
+		rate, ok := dayRates[exp.Currency][exp.Created.Format(rates.DayLayout)]
+		if !ok {
+			return cannotGetRateMessage, errors.Errorf("rate %s of %s is unknown", exp.Currency,
+				exp.Created.Format(rates.DayLayout))
+		}
+		convertExpenseToBase(exp, exp.Currency, rate.BaseRate)
+	}
+	return "", nil
+}
+
+func formatImportPreview(rows, ready int, rowErrors []importRowError) string {
+	res := []string{fmt.Sprintf(importPreviewTemplate, rows, ready, len(rowErrors))}
+	for i, e := range rowErrors {
+		if i == maxPreviewErrors {
+			res = append(res, fmt.Sprintf(moreImportErrorsTemplate, len(rowErrors)-maxPreviewErrors))
+			break
+		}
+		res = append(res, fmt.Sprintf(importRowErrorTemplate, e.row, e.msg))
+	}
+	return strings.Join(res, "\n")
+}
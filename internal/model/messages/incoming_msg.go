@@ -6,6 +6,7 @@ import (
 
 	"go.uber.org/zap"
 	apiv1 "max.ks1230/finances-bot/api/grpc"
+	"max.ks1230/finances-bot/internal/entity/response"
 	"max.ks1230/finances-bot/internal/logger"
 
 	"github.com/opentracing/opentracing-go"
@@ -18,11 +19,17 @@ const (
 
 type messageSender interface {
 	SendMessage(text string, userID int64) error
+	SendKeyboardMessage(text string, buttons []response.Button, userID int64) error
+	EditMessage(text string, buttons []response.Button, chatID int64, messageID int) error
+	SendDocument(doc response.Document, caption string, userID int64) error
 }
 
 type MessageHandler interface {
-	HandleMessage(ctx context.Context, text string, userID int64) (string, error)
+	HandleMessage(ctx context.Context, text string, userID int64) (response.Message, error)
+	HandleDocument(ctx context.Context, doc response.Document, caption string, userID int64) (response.Message, error)
 	AcceptReport(ctx context.Context, report *apiv1.ReportResult) (result string, err error)
+	AcceptExport(ctx context.Context, report *apiv1.ReportResult) (response.Message, error)
+	SaveDueRecurring(ctx context.Context, at time.Time) ([]response.Notification, error)
 }
 
 type Service struct {
@@ -33,17 +40,25 @@ type Service struct {
 func NewService(config config,
 	tgClient messageSender,
 	storage userStorage,
+	rates historicalRates,
 	cache reportCache,
 	producer reportRequestProducer) *Service {
 	return &Service{
 		tgClient: tgClient,
-		handler:  newHandler(config, storage, cache, producer),
+		handler:  newHandler(config, storage, rates, cache, producer),
 	}
 }
 
 type Message struct {
 	Text   string
 	UserID int64
+	// EditMessageID is set when the message comes from an inline keyboard button.
+	// The response then replaces the message that holds the keyboard in the chat of ChatID.
+	EditMessageID int
+	ChatID        int64
+	// Document is set when user sends a file, the text is its caption then.
+	// The content is nil if the file can't be downloaded.
+	Document *response.Document
 }
 
 func (s *Service) HandleIncomingMessage(ctx context.Context, msg Message) error {
@@ -62,22 +77,75 @@ func (s *Service) HandleIncomingMessage(ctx context.Context, msg Message) error
 }
 
 func (s *Service) handle(ctx context.Context, msg Message) error {
+	if msg.Document != nil {
+		resp, err := s.handler.HandleDocument(ctx, *msg.Document, msg.Text, msg.UserID)
+		return s.sendResponse(resp, err, msg.UserID)
+	}
 	resp, err := s.handler.HandleMessage(ctx, msg.Text, msg.UserID)
+	if err == nil && msg.EditMessageID != 0 {
+		return s.tgClient.EditMessage(resp.Text, resp.Buttons, msg.ChatID, msg.EditMessageID)
+	}
 	return s.sendResponse(resp, err, msg.UserID)
 }
 
 func (s *Service) AcceptReport(ctx context.Context, report *apiv1.ReportResult) error {
+	// exports are the results of requests asking for a document format
+	if report.GetFormat() != "" {
+		resp, err := s.handler.AcceptExport(ctx, report)
+		return s.sendResponse(resp, err, report.GetUserID())
+	}
 	resp, err := s.handler.AcceptReport(ctx, report)
-	return s.sendResponse(resp, err, report.GetUserID())
+	return s.sendResponse(response.Message{Text: resp}, err, report.GetUserID())
 }
 
-func (s *Service) sendResponse(response string, err error, userID int64) error {
+func (s *Service) sendResponse(resp response.Message, err error, userID int64) error {
 	if err != nil {
-		senderErr := s.tgClient.SendMessage(errorPrefix+response, userID)
+		senderErr := s.tgClient.SendMessage(errorPrefix+resp.Text, userID)
 		if senderErr != nil {
 			logger.Error("failed to send error message", zap.NamedError("senderErr", senderErr))
 		}
 		return err
 	}
-	return s.tgClient.SendMessage(response, userID)
+	if resp.Document != nil {
+		return s.tgClient.SendDocument(*resp.Document, resp.Text, userID)
+	}
+	if len(resp.Buttons) > 0 {
+		return s.tgClient.SendKeyboardMessage(resp.Text, resp.Buttons, userID)
+	}
+	return s.tgClient.SendMessage(resp.Text, userID)
+}
+
+// RunRecurring saves due recurring expenses and notifies their users until the context is done.
+func (s *Service) RunRecurring(ctx context.Context) {
+	ticker := time.NewTicker(recurringInterval)
+	defer ticker.Stop()
+	firstTick := make(chan struct{}, 1)
+	firstTick <- struct{}{}
+
+	logger.Info("Start saving recurring expenses")
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stop saving recurring expenses")
+			return
+		// fake first tick to catch up runs missed while the bot was down
+		case <-firstTick:
+			s.saveDueRecurring(ctx)
+		case <-ticker.C:
+			s.saveDueRecurring(ctx)
+		}
+	}
+}
+
+func (s *Service) saveDueRecurring(ctx context.Context) {
+	notifications, err := s.handler.SaveDueRecurring(ctx, time.Now())
+	if err != nil {
+		logger.Error("cannot save due recurring expenses", zap.Error(err))
+		return
+	}
+	for _, n := range notifications {
+		if err = s.tgClient.SendMessage(n.Text, n.UserID); err != nil {
+			logger.Error("failed to send notification", zap.Int64("userID", n.UserID), zap.Error(err))
+		}
+	}
 }
@@ -2,20 +2,43 @@ package messages
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	apiv12 "max.ks1230/finances-bot/api/grpc"
 	apiv1 "max.ks1230/finances-bot/api/kafka"
 
 	"github.com/bradfitz/gomemcache/memcache"
 
 	"github.com/gojuno/minimock/v3"
+	"github.com/jinzhu/now"
 	"github.com/stretchr/testify/assert"
 	"max.ks1230/finances-bot/internal/entity/currency"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/response"
 	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/model/customerr"
 	"max.ks1230/finances-bot/internal/model/messages/mock"
 )
 
+// newTestConfig returns the config most of the tests run with, tests override what they need.
+func newTestConfig(m *minimock.Controller) *mock.ConfigMock {
+	cfg := mock.NewConfigMock(m)
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+	cfg.LimitThresholdsMock.Return([]int{50, 80, 100})
+	cfg.CurrenciesMock.Return([]string{"RUB", "USD", "EUR", "CNY"})
+	cfg.MaxRateAgeMock.Return(24 * time.Hour)
+	cfg.RefuseStaleRatesMock.Return(false)
+	return cfg
+}
+
 func Test_OnStartCommand_ShouldAnswerWithIntroMessage(t *testing.T) {
 	ctx := context.Background()
 
@@ -23,11 +46,10 @@ func Test_OnStartCommand_ShouldAnswerWithIntroMessage(t *testing.T) {
 	defer m.Finish()
 	sender := mock.NewMessageSenderMock(m)
 	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
 	cache := mock.NewReportCacheMock(m)
 	producer := mock.NewReportRequestProducerMock(m)
-	cfg := mock.NewConfigMock(m)
-
-	cfg.BaseCurrencyMock.Return("RUB")
+	cfg := newTestConfig(m)
 
 	sender.SendMessageMock.
 		Expect("Hello! I am FinancesRoute bot 🤖", int64(123)).
@@ -40,7 +62,7 @@ func Test_OnStartCommand_ShouldAnswerWithIntroMessage(t *testing.T) {
 		}).
 		Return(nil)
 
-	model := NewService(cfg, sender, storage, cache, producer)
+	model := NewService(cfg, sender, storage, rates, cache, producer)
 	err := model.HandleIncomingMessage(ctx, Message{
 		Text:   "/start",
 		UserID: 123,
@@ -56,17 +78,16 @@ func Test_OnUnknownCommand_ShouldAnswerWithHelpMessage(t *testing.T) {
 	defer m.Finish()
 	sender := mock.NewMessageSenderMock(m)
 	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
 	cache := mock.NewReportCacheMock(m)
 	producer := mock.NewReportRequestProducerMock(m)
-	cfg := mock.NewConfigMock(m)
-
-	cfg.BaseCurrencyMock.Return("RUB")
+	cfg := newTestConfig(m)
 
 	sender.SendMessageMock.
 		Expect("I don't understand you :(", int64(123)).
 		Return(nil)
 
-	model := NewService(cfg, sender, storage, cache, producer)
+	model := NewService(cfg, sender, storage, rates, cache, producer)
 	err := model.HandleIncomingMessage(ctx, Message{
 		Text:   "/none",
 		UserID: 123,
@@ -82,11 +103,10 @@ func Test_OnCurrencyCommand_ShouldAnswerOkMessage(t *testing.T) {
 	defer m.Finish()
 	sender := mock.NewMessageSenderMock(m)
 	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
 	cache := mock.NewReportCacheMock(m)
 	producer := mock.NewReportRequestProducerMock(m)
-	cfg := mock.NewConfigMock(m)
-
-	cfg.BaseCurrencyMock.Return("RUB")
+	cfg := newTestConfig(m)
 
 	u := user.Record{}
 	u.SetPreferredCurrency("USD")
@@ -107,7 +127,7 @@ func Test_OnCurrencyCommand_ShouldAnswerOkMessage(t *testing.T) {
 		Expect("Gotcha!", int64(123)).
 		Return(nil)
 
-	model := NewService(cfg, sender, storage, cache, producer)
+	model := NewService(cfg, sender, storage, rates, cache, producer)
 	err := model.HandleIncomingMessage(ctx, Message{
 		Text:   "/currency USD",
 		UserID: 123,
@@ -123,11 +143,10 @@ func Test_OnLimitCommand_ShouldAnswerOkMessage(t *testing.T) {
 	defer m.Finish()
 	sender := mock.NewMessageSenderMock(m)
 	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
 	cache := mock.NewReportCacheMock(m)
 	producer := mock.NewReportRequestProducerMock(m)
-	cfg := mock.NewConfigMock(m)
-
-	cfg.BaseCurrencyMock.Return("RUB")
+	cfg := newTestConfig(m)
 
 	storage.
 		GetUserByIDMock.
@@ -138,7 +157,7 @@ func Test_OnLimitCommand_ShouldAnswerOkMessage(t *testing.T) {
 		SaveUserByIDMock.
 		Inspect(func(_ context.Context, userID int64, rec user.Record) {
 			assert.Equal(m, int64(123), userID)
-			assert.Equal(m, user.Record{MonthLimit: 1000}, rec)
+			assert.Equal(m, user.Record{MonthLimit: 10000000}, rec)
 		}).
 		Return(nil).
 		GetRateMock.
@@ -151,7 +170,7 @@ func Test_OnLimitCommand_ShouldAnswerOkMessage(t *testing.T) {
 		Expect("Gotcha!", int64(123)).
 		Return(nil)
 
-	model := NewService(cfg, sender, storage, cache, producer)
+	model := NewService(cfg, sender, storage, rates, cache, producer)
 	err := model.HandleIncomingMessage(ctx, Message{
 		Text:   "/limit 1000",
 		UserID: 123,
@@ -160,31 +179,99 @@ func Test_OnLimitCommand_ShouldAnswerOkMessage(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func Test_OnExpenseCommand_ShouldAnswerWithOkMessage(t *testing.T) {
+func Test_OnTimezoneCommand_ShouldAnswerOkMessage(t *testing.T) {
 	ctx := context.Background()
 
 	m := minimock.NewController(t)
 	defer m.Finish()
 	sender := mock.NewMessageSenderMock(m)
 	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
 	cache := mock.NewReportCacheMock(m)
 	producer := mock.NewReportRequestProducerMock(m)
-	cfg := mock.NewConfigMock(m)
+	cfg := newTestConfig(m)
 
-	cfg.BaseCurrencyMock.Return("RUB")
+	expected := user.Record{}
+	expected.SetTimezone("Asia/Tokyo")
+	storage.
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		SaveUserByIDMock.
+		Inspect(func(_ context.Context, userID int64, rec user.Record) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, expected, rec)
+		}).
+		Return(nil)
+
+	cache.InvalidateCacheMock.Return(nil)
 
 	sender.SendMessageMock.
 		Expect("Gotcha!", int64(123)).
 		Return(nil)
 
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/timezone Asia/Tokyo",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnTimezoneCommand_ShouldRejectUnknownTimezone(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\nI don't know that timezone. Try one like Europe/Moscow", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/timezone Mars/Olympus",
+		UserID: 123,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_OnExpenseCommand_ShouldAnswerWithOkMessage(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	storage.FindAccountMock.Return(user.Account{}, &customerr.NotFoundError{})
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Expense ID: 42", int64(123)).
+		Return(nil)
+
 	storage.
 		SaveExpenseMock.
 		Inspect(func(_ context.Context, id int64, rec user.ExpenseRecord) {
 			assert.Equal(m, int64(123), id)
-			assert.Equal(m, float64(500), rec.Amount)
+			assert.Equal(m, money.Amount(5000000), rec.Amount)
 			assert.Equal(m, "Internet", rec.Category)
+			assert.Equal(m, money.Amount(5000000), rec.OriginalAmount)
+			assert.Equal(m, "RUB", rec.Currency)
+			assert.Equal(m, float64(1), rec.Rate)
 		}).
-		Return(nil).
+		Return(42, nil).
 		GetUserByIDMock.
 		Inspect(func(_ context.Context, userID int64) {
 			assert.Equal(m, int64(123), userID)
@@ -207,7 +294,7 @@ func Test_OnExpenseCommand_ShouldAnswerWithOkMessage(t *testing.T) {
 		}).
 		Return(nil)
 
-	model := NewService(cfg, sender, storage, cache, producer)
+	model := NewService(cfg, sender, storage, rates, cache, producer)
 	err := model.HandleIncomingMessage(ctx, Message{
 		Text:   "/expense Internet 500",
 		UserID: 123,
@@ -216,146 +303,2225 @@ func Test_OnExpenseCommand_ShouldAnswerWithOkMessage(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func Test_OnReportCommand_ShouldShowGeneratingMessage(t *testing.T) {
+func Test_OnExpenseCommand_ShouldWarnAboutStaleRate(t *testing.T) {
 	ctx := context.Background()
 
 	m := minimock.NewController(t)
 	defer m.Finish()
 	sender := mock.NewMessageSenderMock(m)
 	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	storage.FindAccountMock.Return(user.Account{}, &customerr.NotFoundError{})
+	rates := mock.NewHistoricalRatesMock(m)
 	cache := mock.NewReportCacheMock(m)
 	producer := mock.NewReportRequestProducerMock(m)
-	cfg := mock.NewConfigMock(m)
+	cfg := newTestConfig(m)
 
-	cfg.BaseCurrencyMock.Return("RUB")
+	sender.SendMessageMock.
+		Expect("Gotcha! Expense ID: 42\nHeads up! The USD rate was updated 2d 3h ago, the conversion may be off", int64(123)).
+		Return(nil)
 
-	producerMessage, _ := proto.Marshal(&apiv1.ReportRequest{
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		SaveExpenseMock.
+		Inspect(func(_ context.Context, _ int64, rec user.ExpenseRecord) {
+			assert.Equal(m, money.Amount(50000000), rec.Amount)
+		}).
+		Return(42, nil).
+		GetUserByIDMock.
+		Return(u, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 0.01, UpdatedAt: time.Now().Add(-51 * time.Hour)}, nil)
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense Internet 50",
 		UserID: 123,
-		Period: "",
 	})
 
-	producer.
-		ProduceMessageMock.
-		Expect(producerMessage).
-		Return(nil)
+	assert.NoError(t, err)
+}
 
-	cache.
-		GetReportMock.
-		Expect(int64(123), "").
-		Return("", memcache.ErrCacheMiss)
+func Test_OnExpenseCommand_ShouldRefuseStaleRate(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	storage.FindAccountMock.Return(user.Account{}, &customerr.NotFoundError{})
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	cfg.MaxRateAgeMock.Return(time.Hour)
+	cfg.RefuseStaleRatesMock.Return(true)
 
 	sender.SendMessageMock.
-		Expect("Generating report...", int64(123)).
+		Expect("Sorry, something wrong happened...\nThe USD rate was updated 3h 0m ago, it's too old to convert with. Try later", int64(123)).
 		Return(nil)
 
-	model := NewService(cfg, sender, storage, cache, producer)
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		GetUserByIDMock.
+		Return(u, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 0.01, UpdatedAt: time.Now().Add(-3 * time.Hour)}, nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
 	err := model.HandleIncomingMessage(ctx, Message{
-		Text:   "/report",
+		Text:   "/expense Internet 50",
 		UserID: 123,
 	})
 
-	assert.NoError(t, err)
+	var staleErr *customerr.StaleRateError
+	assert.ErrorAs(t, err, &staleErr)
 }
 
-func Test_OnReportCommand_ShouldShowCachedReport(t *testing.T) {
+func Test_OnExpenseCommand_ShouldWarnAboutReachedThreshold(t *testing.T) {
 	ctx := context.Background()
 
 	m := minimock.NewController(t)
 	defer m.Finish()
 	sender := mock.NewMessageSenderMock(m)
 	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	storage.FindAccountMock.Return(user.Account{}, &customerr.NotFoundError{})
+	rates := mock.NewHistoricalRatesMock(m)
 	cache := mock.NewReportCacheMock(m)
 	producer := mock.NewReportRequestProducerMock(m)
-	cfg := mock.NewConfigMock(m)
+	cfg := newTestConfig(m)
 
-	cfg.BaseCurrencyMock.Return("RUB")
+	sender.SendMessageMock.
+		Expect("Gotcha! Expense ID: 42\nHeads up! You've spent 80% of your month limit", int64(123)).
+		Return(nil)
 
-	cachedReport := "Shopping: 1600.00\nInternet: 1000.00\n\nTotal: 2600.00"
-	cache.
-		GetReportMock.
-		Expect(int64(123), "").
-		Return(cachedReport, nil)
+	storage.
+		SaveExpenseMock.
+		Return(42, nil).
+		GetUserByIDMock.
+		Return(user.Record{MonthLimit: 10000000, SoftLimit: true}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil).
+		FireLimitWarningsMock.
+		Inspect(func(_ context.Context, userID int64, category string, at time.Time, thresholds []int) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "Food", category)
+			assert.Equal(m, []int{50, 80, 100}, thresholds)
+			assert.WithinDuration(m, time.Now(), at, time.Minute)
+		}).
+		Return([]int{50, 80}, false, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense Food 900",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnExpenseCommand_ShouldWarnAboutExceededBudgetInSoftMode(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	storage.FindAccountMock.Return(user.Account{}, &customerr.NotFoundError{})
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
 
 	sender.SendMessageMock.
-		Expect(cachedReport, int64(123)).
+		Expect("Gotcha! Expense ID: 42\nHeads up! You've exceeded your Food budget", int64(123)).
 		Return(nil)
 
-	model := NewService(cfg, sender, storage, cache, producer)
+	// no month limit, only the budget of the category
+	storage.
+		SaveExpenseMock.
+		Return(42, nil).
+		GetUserByIDMock.
+		Return(user.Record{SoftLimit: true}, nil).
+		FireLimitWarningsMock.
+		Inspect(func(_ context.Context, _ int64, category string, at time.Time, _ []int) {
+			assert.Equal(m, "Food", category)
+			// the budget of the month of a backdated expense is checked
+			assert.Equal(m, time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC), at)
+		}).
+		Return(nil, true, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+	rates.RateAtMock.Return(currency.Rate{BaseRate: 1}, nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
 	err := model.HandleIncomingMessage(ctx, Message{
-		Text:   "/report",
+		Text:   "/expense Food 900 15.03.2022",
 		UserID: 123,
 	})
 
 	assert.NoError(t, err)
 }
 
-func Test_OnReportCommand_ShouldShowReportInPreferredCurrency(t *testing.T) {
-	t.Skip()
+func Test_OnExpenseCommand_ShouldNameExceededBudget(t *testing.T) {
 	ctx := context.Background()
 
 	m := minimock.NewController(t)
 	defer m.Finish()
 	sender := mock.NewMessageSenderMock(m)
 	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	storage.FindAccountMock.Return(user.Account{}, &customerr.NotFoundError{})
+	rates := mock.NewHistoricalRatesMock(m)
 	cache := mock.NewReportCacheMock(m)
 	producer := mock.NewReportRequestProducerMock(m)
-	cfg := mock.NewConfigMock(m)
+	cfg := newTestConfig(m)
 
-	cfg.BaseCurrencyMock.Return("RUB")
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\nYou exceeded your Food budget and I'm not writing that down!", int64(123)).
+		Return(nil)
+
+	storage.
+		SaveExpenseMock.
+		Return(0, &customerr.BudgetError{Category: "Food"}).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense Food 500",
+		UserID: 123,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_OnBudgetCommand_ShouldSaveBudgetInBaseCurrency(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
 
 	u := user.Record{}
 	u.SetPreferredCurrency("USD")
 	storage.
-		/*GetUserExpensesMock.
-		Inspect(func(_ context.Context, userID int64) {
-			assert.Equal(m, int64(123), userID)
-		}).
-		Return([]user.ExpenseRecord{
-			{
-				Amount:   1000,
-				Category: "Internet",
-				Created:  time.Now(),
-			},
-			{
-				Amount:   1500,
-				Category: "Shopping",
-				Created:  time.Now(),
-			},
-			{
-				Amount:   100,
-				Category: "Shopping",
-				Created:  time.Now(),
-			},
-		}, nil).*/
 		GetUserByIDMock.
-		Inspect(func(_ context.Context, userID int64) {
-			assert.Equal(m, int64(123), userID)
-		}).
 		Return(u, nil).
 		GetRateMock.
 		Inspect(func(_ context.Context, name string) {
 			assert.Equal(m, "USD", name)
 		}).
-		Return(currency.Rate{BaseRate: 0.1}, nil)
+		Return(currency.Rate{BaseRate: 0.01, UpdatedAt: time.Now()}, nil).
+		SaveBudgetMock.
+		Inspect(func(_ context.Context, userID int64, category string, amount money.Amount) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "Food", category)
+			assert.Equal(m, money.Amount(100000000), amount)
+		}).
+		Return(nil)
 
-	expectedReport := "Shopping: 160.00\nInternet: 100.00\n\nTotal: 260.00"
-	cache.
-		GetReportMock.
-		Expect(int64(123), "").
-		Return("", memcache.ErrCacheMiss).
-		CacheReportMock.
-		Expect(int64(123), "", expectedReport).
+	sender.SendMessageMock.
+		Expect("Gotcha!", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/budget Food 100",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnBudgetCommand_ShouldNormalizeCategory(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.
+		ResolveCategoryMock.
+		Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil }).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1, UpdatedAt: time.Now()}, nil).
+		SaveBudgetMock.
+		Inspect(func(_ context.Context, _ int64, category string, _ money.Amount) {
+			assert.Equal(m, "food/groceries", category)
+		}).
 		Return(nil)
 
 	sender.SendMessageMock.
-		Expect(expectedReport, int64(123)).
+		Expect("Gotcha!", int64(123)).
 		Return(nil)
 
-	model := NewService(cfg, sender, storage, cache, producer)
+	model := NewService(cfg, sender, storage, rates, cache, producer)
 	err := model.HandleIncomingMessage(ctx, Message{
-		Text:   "/report",
+		Text:   "/budget food//groceries/ 100",
 		UserID: 123,
 	})
 
 	assert.NoError(t, err)
 }
+
+func Test_OnBudgetCommand_ShouldRejectEmptyCategory(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\n"+
+			"The category is incorrect. Subcategories are separated with /, like food/groceries", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/budget // 100",
+		UserID: 123,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_OnIncomeCommand_ShouldAnswerWithIncomeAmountError(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\nYour income amount is incorrect", int64(123)).
+		Return(nil)
+
+	storage.GetUserByIDMock.Return(user.Record{}, nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/income Salary -100",
+		UserID: 123,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_OnIncomeCommand_ShouldSaveIncomeInBaseCurrency(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.FindAccountMock.Return(user.Account{}, &customerr.NotFoundError{})
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Income ID: 7", int64(123)).
+		Return(nil)
+
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		GetUserByIDMock.
+		Return(u, nil).
+		SaveIncomeMock.
+		Inspect(func(_ context.Context, userID int64, rec user.IncomeRecord) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "Salary", rec.Source)
+			assert.Equal(m, money.Amount(1000000000), rec.Amount)
+			assert.Equal(m, time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC), rec.Created)
+		}).
+		Return(7, nil)
+
+	rates.
+		RateAtMock.
+		Inspect(func(_ context.Context, name string, at time.Time) {
+			assert.Equal(m, "USD", name)
+		}).
+		Return(currency.Rate{BaseRate: 0.01}, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/income Salary 1000 01.09.2022",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnBalanceCommand_ShouldShowIncomeMinusExpenses(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Income: 1000.00 ₽\nExpenses: 400.00 ₽\nBalance: 600.00 ₽", int64(123)).
+		Return(nil)
+
+	storage.
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil).
+		GetBalanceMock.
+		Inspect(func(_ context.Context, userID int64, from, to time.Time) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC), from)
+			assert.Equal(m, time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC), to)
+		}).
+		Return(10000000, 4000000, nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/balance 01.09.2022-30.09.2022",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnEditCommand_ShouldAnswerWithOkMessage(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	storage.GetExpenseMock.Return(user.ExpenseRecord{ID: 42, Currency: "USD"}, nil)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha!", int64(123)).
+		Return(nil)
+
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		UpdateExpenseMock.
+		Inspect(func(_ context.Context, id int64, rec user.ExpenseRecord) {
+			assert.Equal(m, int64(123), id)
+			assert.Equal(m, int64(42), rec.ID)
+			assert.Equal(m, money.Amount(50000000), rec.Amount)
+			assert.Equal(m, "Taxi", rec.Category)
+			assert.Equal(m, "01.09.2022", rec.Created.Format("02.01.2006"))
+		}).
+		Return(nil).
+		GetUserByIDMock.
+		Inspect(func(_ context.Context, userID int64) {
+			assert.Equal(m, int64(123), userID)
+		}).
+		Return(u, nil)
+
+	// the expense is backdated, so it is converted at the rate of its day
+	rates.
+		RateAtMock.
+		Inspect(func(_ context.Context, name string, at time.Time) {
+			assert.Equal(m, "USD", name)
+			assert.Equal(m, "01.09.2022", at.Format("02.01.2006"))
+		}).
+		Return(currency.Rate{BaseRate: 0.1}, nil)
+
+	cache.
+		InvalidateCacheMock.
+		Inspect(func(id int64, options []string) {
+			assert.Equal(m, int64(123), id)
+		}).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/edit 42 Taxi 500 01.09.2022",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnEditCommand_ShouldKeepAccountAndCurrencyOfExpense(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha!", int64(123)).
+		Return(nil)
+
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		GetExpenseMock.
+		Inspect(func(_ context.Context, userID int64, expenseID int64) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, int64(42), expenseID)
+		}).
+		Return(user.ExpenseRecord{ID: 42, Currency: "EUR", AccountID: 7, Account: "card"}, nil).
+		UpdateExpenseMock.
+		Inspect(func(_ context.Context, id int64, rec user.ExpenseRecord) {
+			assert.Equal(m, money.Amount(4000000), rec.Amount)
+			assert.Equal(m, money.Amount(50000), rec.OriginalAmount)
+			assert.Equal(m, "EUR", rec.Currency)
+			assert.Equal(m, int64(7), rec.AccountID)
+			assert.Equal(m, "card", rec.Account)
+		}).
+		Return(nil).
+		GetUserByIDMock.
+		Return(u, nil).
+		GetRateMock.
+		Inspect(func(_ context.Context, name string) {
+			assert.Equal(m, "EUR", name)
+		}).
+		Return(currency.Rate{Name: "EUR", BaseRate: 0.0125, UpdatedAt: time.Now()}, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/edit 42 Taxi 5",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnDeleteCommand_ShouldAnswerWithNotFoundMessage(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\nI can't find an expense with that ID", int64(123)).
+		Return(nil)
+
+	storage.
+		DeleteExpenseMock.
+		Inspect(func(_ context.Context, userID int64, expenseID int64) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, int64(42), expenseID)
+		}).
+		Return(&customerr.NotFoundError{Err: "expense 42 not found"})
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/delete 42",
+		UserID: 123,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_OnUndoCommand_ShouldAnswerWithUndoneCount(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Undone actions: 2", int64(123)).
+		Return(nil)
+
+	storage.
+		UndoActionsMock.
+		Inspect(func(_ context.Context, userID int64, n int) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, 3, n)
+		}).
+		Return(2, nil)
+
+	cache.
+		InvalidateCacheMock.
+		Inspect(func(id int64, options []string) {
+			assert.Equal(m, int64(123), id)
+		}).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/undo 3",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnHistoryCommand_ShouldShowPageWithNextButton(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	created := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	exps := make([]user.ExpenseRecord, 0, 11)
+	for i := 11; i > 0; i-- {
+		exps = append(exps, user.ExpenseRecord{ID: int64(i), Amount: 1000000, Category: "Food", Created: created})
+	}
+
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		GetUserByIDMock.
+		Return(u, nil).
+		GetRateMock.
+		Inspect(func(_ context.Context, name string) {
+			assert.Equal(m, "USD", name)
+		}).
+		Return(currency.Rate{BaseRate: 0.1}, nil).
+		GetExpensesPageMock.
+		Inspect(func(_ context.Context, userID int64, filter user.ExpenseFilter, offset, limit uint64) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "Food", filter.Category)
+			assert.False(m, filter.From.IsZero())
+			assert.Equal(m, uint64(0), offset)
+			assert.Equal(m, uint64(11), limit)
+		}).
+		Return(exps, nil)
+
+	sender.SendKeyboardMessageMock.
+		Inspect(func(text string, buttons []response.Button, userID int64) {
+			lines := strings.Split(text, "\n")
+			assert.Equal(m, 11, len(lines))
+			assert.Equal(m, "#11 01.09.2022 Food: 10.00 $", lines[1])
+			assert.Equal(m, []response.Button{{Text: "Next »", Data: "/history_page 1 1"}}, buttons)
+			assert.Equal(m, int64(123), userID)
+		}).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/history month Food",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnHistoryPageButton_ShouldKeepFilterAndEditMessageInChat(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	created := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	exps := make([]user.ExpenseRecord, 0, 11)
+	for i := 11; i > 0; i-- {
+		exps = append(exps, user.ExpenseRecord{ID: int64(i), Amount: 1000000, Category: "Entertainment", Created: created})
+	}
+
+	storage.
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil).
+		GetExpensesPageMock.
+		Inspect(func(_ context.Context, userID int64, filter user.ExpenseFilter, offset, limit uint64) {
+			assert.Equal(m, "Entertainment", filter.Category)
+			assert.Equal(m, "summer-vacation-with-friends", filter.Tag)
+			assert.Equal(m, time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC), filter.From)
+		}).
+		Return(exps, nil)
+
+	var nextData string
+	sender.SendKeyboardMessageMock.
+		Inspect(func(_ string, buttons []response.Button, _ int64) {
+			assert.Equal(m, 1, len(buttons))
+			nextData = buttons[0].Data
+		}).
+		Return(nil)
+
+	sender.EditMessageMock.
+		Inspect(func(text string, buttons []response.Button, chatID int64, messageID int) {
+			assert.True(m, strings.HasPrefix(text, "Expenses, page 2:"))
+			assert.Equal(m, []response.Button{
+				{Text: "« Prev", Data: "/history_page 1 0"},
+				{Text: "Next »", Data: "/history_page 1 2"},
+			}, buttons)
+			assert.Equal(m, int64(-100500), chatID)
+			assert.Equal(m, 7, messageID)
+		}).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/history 01.06.2022-31.08.2022 Entertainment #summer-vacation-with-friends",
+		UserID: 123,
+	})
+	assert.NoError(t, err)
+	// button data is limited to 64 bytes by Telegram
+	assert.LessOrEqual(t, len(nextData), 64)
+
+	err = model.HandleIncomingMessage(ctx, Message{
+		Text:          nextData,
+		UserID:        123,
+		EditMessageID: 7,
+		ChatID:        -100500,
+	})
+	assert.NoError(t, err)
+}
+
+func Test_OnReportCommand_ShouldShowGeneratingMessage(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	producerMessage, _ := proto.Marshal(&apiv1.ReportRequest{
+		UserID: 123,
+		Period: "",
+	})
+
+	producer.
+		ProduceMessageMock.
+		Expect(producerMessage).
+		Return(nil)
+
+	cache.
+		GetReportMock.
+		Expect(int64(123), "").
+		Return("", memcache.ErrCacheMiss)
+
+	sender.SendMessageMock.
+		Expect("Generating report...", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/report",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnReportCommand_ShouldRequestDateRangeReport(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+
+	producerMessage, _ := proto.Marshal(&apiv1.ReportRequest{
+		UserID: 123,
+		Period: "01.09.2022-15.09.2022",
+		From:   timestamppb.New(time.Date(2022, 9, 1, 0, 0, 0, 0, tokyo)),
+		To:     timestamppb.New(time.Date(2022, 9, 16, 0, 0, 0, 0, tokyo)),
+	})
+
+	u := user.Record{}
+	u.SetTimezone("Asia/Tokyo")
+	storage.
+		GetUserByIDMock.
+		Return(u, nil)
+
+	producer.
+		ProduceMessageMock.
+		Expect(producerMessage).
+		Return(nil)
+
+	sender.SendMessageMock.
+		Expect("Generating report...", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err = model.HandleIncomingMessage(ctx, Message{
+		Text:   "/report 01.09.2022-15.09.2022",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnReportCommand_ShouldShowCachedReport(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	cachedReport := "Shopping: 1600.00\nInternet: 1000.00\n\nTotal: 2600.00"
+	cache.
+		GetReportMock.
+		Expect(int64(123), "").
+		Return(cachedReport, nil)
+
+	sender.SendMessageMock.
+		Expect(cachedReport, int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/report",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnReportCommand_ShouldShowReportInPreferredCurrency(t *testing.T) {
+	t.Skip()
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		/*GetUserExpensesMock.
+		Inspect(func(_ context.Context, userID int64) {
+			assert.Equal(m, int64(123), userID)
+		}).
+		Return([]user.ExpenseRecord{
+			{
+				Amount:   10000000,
+				Category: "Internet",
+				Created:  time.Now(),
+			},
+			{
+				Amount:   15000000,
+				Category: "Shopping",
+				Created:  time.Now(),
+			},
+			{
+				Amount:   1000000,
+				Category: "Shopping",
+				Created:  time.Now(),
+			},
+		}, nil).*/
+		GetUserByIDMock.
+		Inspect(func(_ context.Context, userID int64) {
+			assert.Equal(m, int64(123), userID)
+		}).
+		Return(u, nil).
+		GetRateMock.
+		Inspect(func(_ context.Context, name string) {
+			assert.Equal(m, "USD", name)
+		}).
+		Return(currency.Rate{BaseRate: 0.1}, nil)
+
+	expectedReport := "Shopping: 160.00\nInternet: 100.00\n\nTotal: 260.00"
+	cache.
+		GetReportMock.
+		Expect(int64(123), "").
+		Return("", memcache.ErrCacheMiss).
+		CacheReportMock.
+		Expect(int64(123), "", expectedReport).
+		Return(nil)
+
+	sender.SendMessageMock.
+		Expect(expectedReport, int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/report",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnAcceptReport_ShouldFormatAmountsWithCurrencyDigits(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	cfg.CurrenciesMock.Return([]string{"RUB", "JPY"})
+
+	expectedReport := "Food: 1235 ¥\n\nTotal: 1235 ¥"
+	cache.CacheReportMock.
+		Expect(int64(123), "month", expectedReport).
+		Return(nil)
+	sender.SendMessageMock.
+		Expect(expectedReport, int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.AcceptReport(ctx, &apiv12.ReportResult{
+		Status:      &apiv12.OperationStatus{Success: true},
+		UserID:      123,
+		Period:      "month",
+		Records:     []*apiv12.ReportRecord{{Category: "Food", Amount: 12345000}},
+		TotalAmount: 12345000,
+		Currency:    "JPY",
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnConvertCommand_ShouldConvertToPreferredCurrency(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		GetUserByIDMock.
+		Return(u, nil).
+		GetRateMock.
+		Set(func(_ context.Context, name string) (currency.Rate, error) {
+			switch name {
+			case "EUR":
+				return currency.Rate{Name: name, BaseRate: 0.0125, UpdatedAt: time.Now()}, nil
+			case "USD":
+				return currency.Rate{Name: name, BaseRate: 0.015, UpdatedAt: time.Now()}, nil
+			}
+			t.Fatalf("unexpected rate %s", name)
+			return currency.Rate{}, nil
+		})
+
+	sender.SendMessageMock.
+		Expect("50.00 € = 60.00 $", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/convert 50 eur",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnConvertCommand_ShouldRejectNonPositiveAmount(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\nThe amount is incorrect", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	for _, amount := range []string{"0", "-50"} {
+		err := model.HandleIncomingMessage(ctx, Message{
+			Text:   "/convert " + amount + " eur usd",
+			UserID: 123,
+		})
+		assert.Error(t, err)
+	}
+}
+
+func Test_OnRatesCommand_ShouldShowRatesWithAge(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	cfg.CurrenciesMock.Return([]string{"RUB", "USD", "EUR"})
+
+	storage.
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Set(func(_ context.Context, name string) (currency.Rate, error) {
+			switch name {
+			case "RUB":
+				return currency.Rate{Name: name, BaseRate: 1, UpdatedAt: time.Now().Add(-100 * time.Hour)}, nil
+			case "USD":
+				return currency.Rate{Name: name, BaseRate: 0.016, UpdatedAt: time.Now().Add(-90 * time.Minute)}, nil
+			}
+			return currency.Rate{}, errors.New("rate is not set yet")
+		})
+
+	sender.SendMessageMock.
+		Expect("Rates in RUB:\n1 USD = 62.5000 RUB, updated 1h 30m ago\nEUR: unknown yet", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/rates",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnExpenseCommand_ShouldConvertFromAccountCurrency(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Expense ID: 42", int64(123)).
+		Return(nil)
+
+	storage.
+		FindAccountMock.
+		Inspect(func(_ context.Context, userID int64, name string) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "card", name)
+		}).
+		Return(user.Account{ID: 7, Name: "card", Currency: "USD"}, nil).
+		SaveExpenseMock.
+		Inspect(func(_ context.Context, id int64, rec user.ExpenseRecord) {
+			assert.Equal(m, money.Amount(6250000), rec.Amount)
+			assert.Equal(m, money.Amount(100000), rec.OriginalAmount)
+			assert.Equal(m, "USD", rec.Currency)
+			assert.Equal(m, int64(7), rec.AccountID)
+		}).
+		Return(42, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Inspect(func(_ context.Context, name string) {
+			assert.Equal(m, "USD", name)
+		}).
+		Return(currency.Rate{Name: "USD", BaseRate: 0.016, UpdatedAt: time.Now()}, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense Taxi 10 @card",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnExpenseCommand_ShouldKeepThreeDigitsOfKWD(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Expense ID: 42", int64(123)).
+		Return(nil)
+
+	storage.
+		FindAccountMock.
+		Return(user.Account{ID: 7, Name: "wallet", Currency: "KWD"}, nil).
+		SaveExpenseMock.
+		Inspect(func(_ context.Context, id int64, rec user.ExpenseRecord) {
+			assert.Equal(m, money.Amount(12340), rec.OriginalAmount)
+			assert.Equal(m, money.Amount(3085000), rec.Amount)
+			assert.Equal(m, "KWD", rec.Currency)
+		}).
+		Return(42, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{Name: "KWD", BaseRate: 0.004, UpdatedAt: time.Now()}, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense Taxi 1.234 @wallet",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnExpenseCommand_ShouldRejectFractionOfJPY(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\nJPY amounts can't have a fraction part", int64(123)).
+		Return(nil)
+
+	storage.
+		FindAccountMock.
+		Return(user.Account{ID: 8, Name: "yen", Currency: "JPY"}, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense Sushi 100.50 @yen",
+		UserID: 123,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_OnAccountAddCommand_ShouldSaveAccount(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.
+		SaveAccountMock.
+		Inspect(func(_ context.Context, userID int64, acc user.Account) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, user.Account{Name: "card", Currency: "USD", StartingBalance: money.Amount(1505000)}, acc)
+		}).
+		Return(1, nil)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Account card is added", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/account add card usd 150.50",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnAccountListCommand_ShouldShowBalances(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.
+		GetAccountsMock.
+		Inspect(func(_ context.Context, userID int64) {
+			assert.Equal(m, int64(123), userID)
+		}).
+		Return([]user.Account{
+			{ID: 1, Name: "cash", Currency: "RUB", Balance: money.Amount(10000000), Default: true},
+			{ID: 2, Name: "card", Currency: "USD", Balance: money.Amount(-205000)},
+		}, nil)
+
+	sender.SendMessageMock.
+		Expect("Accounts:\ncash: 1000.00 ₽ (default)\ncard: -20.50 $", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/account list",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnTransferCommand_ShouldCaptureEffectiveRate(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.
+		FindAccountMock.
+		Set(func(_ context.Context, _ int64, name string) (user.Account, error) {
+			if name == "cash" {
+				return user.Account{ID: 1, Name: "cash", Currency: "RUB"}, nil
+			}
+			return user.Account{ID: 2, Name: "card", Currency: "USD"}, nil
+		}).
+		SaveTransferMock.
+		Inspect(func(_ context.Context, userID int64, tr user.Transfer) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, int64(1), tr.FromAccountID)
+			assert.Equal(m, money.Amount(64000000), tr.Amount)
+			assert.Equal(m, int64(2), tr.ToAccountID)
+			assert.Equal(m, money.Amount(1000000), tr.Received)
+			assert.InDelta(m, 0.015625, tr.Rate, 1e-9)
+		}).
+		Return(5, nil)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Transfer ID: 5\ncash → card: 6400.00 ₽ = 100.00 $\nRate: 1 RUB = 0.0156 USD", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/transfer cash card 6400 100",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnTransferCommand_ShouldExchangeAtCurrentRate(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.
+		FindAccountMock.
+		Set(func(_ context.Context, _ int64, name string) (user.Account, error) {
+			if name == "card" {
+				return user.Account{ID: 2, Name: "card", Currency: "USD"}, nil
+			}
+			return user.Account{ID: 1, Name: "cash", Currency: "RUB"}, nil
+		}).
+		GetRateMock.
+		Set(func(_ context.Context, name string) (currency.Rate, error) {
+			if name == "USD" {
+				return currency.Rate{Name: name, BaseRate: 0.016, UpdatedAt: time.Now()}, nil
+			}
+			return currency.Rate{Name: name, BaseRate: 1, UpdatedAt: time.Now()}, nil
+		}).
+		SaveTransferMock.
+		Inspect(func(_ context.Context, _ int64, tr user.Transfer) {
+			assert.Equal(m, money.Amount(1000000), tr.Amount)
+			assert.Equal(m, money.Amount(62500000), tr.Received)
+			assert.InDelta(m, 62.5, tr.Rate, 1e-9)
+		}).
+		Return(6, nil)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Transfer ID: 6\ncard → cash: 100.00 $ = 6250.00 ₽\nRate: 1 USD = 62.5000 RUB", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/transfer @card @cash 100",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnTransferCommand_ShouldKeepCurrentRateOfRoundedAmount(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.
+		FindAccountMock.
+		Set(func(_ context.Context, _ int64, name string) (user.Account, error) {
+			if name == "yen" {
+				return user.Account{ID: 3, Name: "yen", Currency: "JPY"}, nil
+			}
+			return user.Account{ID: 1, Name: "cash", Currency: "RUB"}, nil
+		}).
+		GetRateMock.
+		Set(func(_ context.Context, name string) (currency.Rate, error) {
+			if name == "JPY" {
+				return currency.Rate{Name: name, BaseRate: 1.55, UpdatedAt: time.Now()}, nil
+			}
+			return currency.Rate{Name: name, BaseRate: 1, UpdatedAt: time.Now()}, nil
+		}).
+		SaveTransferMock.
+		Inspect(func(_ context.Context, _ int64, tr user.Transfer) {
+			// yens have no minor units, so the received amount is rounded while the rate is not
+			assert.Equal(m, money.Amount(10000), tr.Amount)
+			assert.Equal(m, money.Amount(20000), tr.Received)
+			assert.InDelta(m, 1.55, tr.Rate, 1e-9)
+		}).
+		Return(7, nil)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Transfer ID: 7\ncash → yen: 1.00 ₽ = 2 ¥\nRate: 1 RUB = 1.5500 JPY", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/transfer @cash @yen 1",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnExpenseCommand_ShouldSaveTagsAndNote(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Expense ID: 42", int64(123)).
+		Return(nil)
+
+	storage.
+		FindAccountMock.
+		Return(user.Account{}, &customerr.NotFoundError{}).
+		SaveExpenseMock.
+		Inspect(func(_ context.Context, _ int64, rec user.ExpenseRecord) {
+			assert.Equal(m, "Food", rec.Category)
+			assert.Equal(m, money.Amount(15000000), rec.Amount)
+			assert.Equal(m, []string{"vacation", "rome"}, rec.Tags)
+			assert.Equal(m, "dinner at the #1 place", rec.Note)
+		}).
+		Return(42, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense Food 1500 #Vacation “dinner at the #1 place” #rome #vacation",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnHistoryCommand_ShouldFilterByTag(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	created := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	storage.
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil).
+		GetExpensesPageMock.
+		Inspect(func(_ context.Context, _ int64, filter user.ExpenseFilter, _, _ uint64) {
+			assert.Equal(m, "vacation", filter.Tag)
+			assert.Equal(m, "", filter.Category)
+			assert.True(m, filter.From.IsZero())
+		}).
+		Return([]user.ExpenseRecord{
+			{ID: 3, Amount: 15000000, Category: "Food", Created: created, Tags: []string{"rome", "vacation"}, Note: "dinner"},
+		}, nil)
+
+	sender.SendMessageMock.
+		Expect("Expenses, page 1:\n#3 01.09.2022 Food: 1500.00 ₽ #rome #vacation \"dinner\"", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/history #Vacation",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnReportCommand_ShouldRequestTaggedReportBypassingCache(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	producerMessage, _ := proto.Marshal(&apiv1.ReportRequest{
+		UserID: 123,
+		Period: "month",
+		Tag:    "vacation",
+	})
+
+	producer.
+		ProduceMessageMock.
+		Expect(producerMessage).
+		Return(nil)
+
+	sender.SendMessageMock.
+		Expect("Generating report...", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/report month #Vacation",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnRecurringAddCommand_ShouldScheduleFirstRun(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) { return name, nil })
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	firstRun := now.With(time.Now().UTC()).EndOfMonth().Add(time.Nanosecond)
+	storage.
+		GetUserByIDMock.
+		Return(u, nil).
+		SaveRecurringMock.
+		Inspect(func(_ context.Context, userID int64, rec user.RecurringExpense) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "Rent", rec.Category)
+			assert.Equal(m, money.Amount(5000000), rec.Amount)
+			assert.Equal(m, "USD", rec.Currency)
+			assert.Equal(m, "0 0 1 * *", rec.Schedule)
+			assert.Equal(m, firstRun, rec.NextRun)
+		}).
+		Return(7, nil)
+
+	sender.SendMessageMock.
+		Expect(fmt.Sprintf("Gotcha! Recurring expense ID: 7, the first one is on %s", firstRun.Format("02.01.2006 15:04")),
+			int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/recurring add Rent 500 0 0 1 * *",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnDueRecurring_ShouldSaveExpenseAndScheduleNextRun(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	due := now.With(time.Now().UTC()).BeginningOfDay()
+	storage.
+		GetDueRecurringMock.
+		Return([]user.RecurringExpense{
+			{ID: 7, UserID: 123, Category: "Internet", Amount: 5000000, Currency: "RUB", Schedule: "daily", NextRun: due},
+		}, nil).
+		GetUserByIDMock.
+		Return(user.Record{MonthLimit: 10000000, SoftLimit: true}, nil).
+		FindAccountMock.
+		Return(user.Account{ID: 5, Name: "card", Currency: "RUB", Default: true}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil).
+		SaveExpenseMock.
+		Inspect(func(_ context.Context, userID int64, rec user.ExpenseRecord) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, int64(7), rec.RecurringID)
+			assert.Equal(m, due, rec.Created)
+			assert.Equal(m, money.Amount(5000000), rec.Amount)
+			assert.Equal(m, int64(5), rec.AccountID)
+		}).
+		Return(42, nil).
+		ScheduleRecurringMock.
+		Inspect(func(_ context.Context, id int64, prev, next time.Time) {
+			assert.Equal(m, int64(7), id)
+			assert.Equal(m, due, prev)
+			assert.Equal(m, due.AddDate(0, 0, 1), next)
+		}).
+		Return(nil)
+
+	storage.FireLimitWarningsMock.Return([]int{80}, false, nil)
+	cache.InvalidateCacheMock.Return(nil)
+
+	sender.SendMessageMock.
+		Expect("Recurring expense #7 Internet 500.00 ₽ is saved. Expense ID: 42\nHeads up! You've spent 80% of your month limit",
+			int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	model.saveDueRecurring(ctx)
+}
+
+func Test_OnDueRecurring_ShouldNotSaveRunTwice(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	due := now.With(time.Now().UTC()).BeginningOfDay()
+	storage.
+		GetDueRecurringMock.
+		Return([]user.RecurringExpense{
+			{ID: 7, UserID: 123, Category: "Internet", Amount: 5000000, Currency: "RUB", Schedule: "daily", NextRun: due},
+		}, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		FindAccountMock.
+		Return(user.Account{}, &customerr.NotFoundError{}).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil).
+		SaveExpenseMock.
+		Return(0, fmt.Errorf("save expense: %w", &customerr.AlreadyExistsError{Err: "already saved"})).
+		ScheduleRecurringMock.
+		Inspect(func(_ context.Context, id int64, prev, next time.Time) {
+			assert.Equal(m, int64(7), id)
+			assert.Equal(m, due, prev)
+			assert.Equal(m, due.AddDate(0, 0, 1), next)
+		}).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	model.saveDueRecurring(ctx)
+}
+
+func Test_OnDueRecurring_ShouldNotifyAboutMissedRunsOnce(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	today := now.With(time.Now().UTC()).BeginningOfDay()
+	var saved []time.Time
+	storage.
+		GetDueRecurringMock.
+		Return([]user.RecurringExpense{
+			{ID: 7, UserID: 123, Category: "Internet", Amount: 5000000, Currency: "RUB", Schedule: "daily",
+				NextRun: today.AddDate(0, 0, -2)},
+		}, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		FindAccountMock.
+		Return(user.Account{}, &customerr.NotFoundError{}).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil).
+		SaveExpenseMock.
+		Set(func(_ context.Context, _ int64, rec user.ExpenseRecord) (int64, error) {
+			saved = append(saved, rec.Created)
+			return int64(40 + len(saved)), nil
+		}).
+		ScheduleRecurringMock.
+		Inspect(func(_ context.Context, _ int64, prev, next time.Time) {
+			assert.Equal(m, prev.AddDate(0, 0, 1), next)
+		}).
+		Return(nil)
+
+	rates.RateAtMock.Return(currency.Rate{BaseRate: 1}, nil)
+	cache.InvalidateCacheMock.Return(nil)
+
+	sender.SendMessageMock.
+		Expect("Recurring expense #7 Internet 500.00 ₽ is saved for 3 missed runs. Expense IDs: 41, 42, 43",
+			int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	model.saveDueRecurring(ctx)
+
+	assert.Equal(t, []time.Time{today.AddDate(0, 0, -2), today.AddDate(0, 0, -1), today}, saved)
+}
+
+func Test_OnRecurringAddCommand_ShouldRejectTooFrequentSchedule(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.GetUserByIDMock.Return(user.Record{}, nil)
+
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\nRecurring expenses can't be saved more often than hourly",
+			int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/recurring add Coffee 3 * * * * *",
+		UserID: 123,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_OnExpenseCommand_ShouldSaveToCategoryOfAlias(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Expense ID: 42", int64(123)).
+		Return(nil)
+
+	storage.
+		ResolveCategoryMock.
+		Inspect(func(_ context.Context, userID int64, name string) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "еда", name)
+		}).
+		Return("Food", nil).
+		SaveExpenseMock.
+		Inspect(func(_ context.Context, _ int64, rec user.ExpenseRecord) {
+			assert.Equal(m, "Food", rec.Category)
+		}).
+		Return(42, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		FindAccountMock.
+		Return(user.Account{}, &customerr.NotFoundError{}).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense еда 500",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnExpenseCommand_ShouldSuggestSimilarCategory(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Expense ID: 42\nNew category Grocries. Did you mean Food? Fix it with /category merge Grocries Food",
+			int64(123)).
+		Return(nil)
+
+	storage.
+		ResolveCategoryMock.
+		Return("", &customerr.NotFoundError{Err: "category Grocries not found"}).
+		GetCategoriesMock.
+		Return([]user.Category{
+			{Name: "Food", Aliases: []string{"groceries"}},
+			{Name: "Internet"},
+		}, nil).
+		SaveExpenseMock.
+		Inspect(func(_ context.Context, _ int64, rec user.ExpenseRecord) {
+			assert.Equal(m, "Grocries", rec.Category)
+		}).
+		Return(42, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		FindAccountMock.
+		Return(user.Account{}, &customerr.NotFoundError{}).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/expense Grocries 500",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnCategoryMergeCommand_ShouldMergeResolvedCategories(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha! Moved expenses: 12", int64(123)).
+		Return(nil)
+
+	storage.
+		ResolveCategoryMock.
+		Set(func(_ context.Context, _ int64, name string) (string, error) {
+			return map[string]string{"groceries": "Groceries", "food": "Food"}[name], nil
+		}).
+		MergeCategoriesMock.
+		Inspect(func(_ context.Context, userID int64, from, into string) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "Groceries", from)
+			assert.Equal(m, "Food", into)
+		}).
+		Return(12, nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/category merge groceries food",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnCategoryMergeCommand_ShouldRejectMergeIntoSubcategory(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Sorry, something wrong happened...\nCan't merge Food into its own subcategory Food/Groceries",
+			int64(123)).
+		Return(nil)
+
+	storage.ResolveCategoryMock.
+		Set(func(_ context.Context, _ int64, name string) (string, error) {
+			return map[string]string{"food": "Food", "food/groceries": "Food/Groceries"}[name], nil
+		})
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/category merge food food/groceries",
+		UserID: 123,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_OnCategoryRenameCommand_ShouldRenameCategoryOfAlias(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Gotcha!", int64(123)).
+		Return(nil)
+
+	storage.
+		ResolveCategoryMock.
+		Set(func(_ context.Context, _ int64, name string) (string, error) {
+			return map[string]string{"food": "Groceries"}[name], nil
+		}).
+		RenameCategoryMock.
+		Inspect(func(_ context.Context, userID int64, from, to string) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, "Groceries", from)
+			assert.Equal(m, "Supermarket", to)
+		}).
+		Return(nil)
+
+	cache.InvalidateCacheMock.Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/category rename food Supermarket",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnReportCommand_ShouldRequestCategoryDrillDown(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	producerMessage, _ := proto.Marshal(&apiv1.ReportRequest{
+		UserID:   123,
+		Period:   "month",
+		Category: "Food/Restaurants",
+	})
+
+	storage.ResolveCategoryMock.
+		Set(func(_ context.Context, _ int64, name string) (string, error) {
+			assert.Equal(m, "food/restaurants", name)
+			return "Food/Restaurants", nil
+		})
+
+	producer.
+		ProduceMessageMock.
+		Expect(producerMessage).
+		Return(nil)
+
+	sender.SendMessageMock.
+		Expect("Generating report...", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/report month food/restaurants/",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnAcceptReport_ShouldIndentSubcategoriesWithSubtotals(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	sender.SendMessageMock.
+		Expect("Category: food\n\n"+
+			"food: 550.00 ₽\n"+
+			"    groceries: 300.00 ₽\n"+
+			"        fruits: 100.00 ₽\n"+
+			"    restaurants: 200.00 ₽\n"+
+			"\nTotal: 550.00 ₽",
+			int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.AcceptReport(ctx, &apiv12.ReportResult{
+		Status:   &apiv12.OperationStatus{Success: true},
+		UserID:   123,
+		Period:   "month",
+		Category: "food",
+		Records: []*apiv12.ReportRecord{{
+			Category: "food",
+			Amount:   5500000,
+			Children: []*apiv12.ReportRecord{
+				{Category: "groceries", Amount: 3000000, Children: []*apiv12.ReportRecord{
+					{Category: "fruits", Amount: 1000000},
+				}},
+				{Category: "restaurants", Amount: 2000000},
+			},
+		}},
+		TotalAmount: 5500000,
+		Currency:    "RUB",
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnExportCommand_ShouldRequestDocumentOfFormat(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	producerMessage, _ := proto.Marshal(&apiv1.ReportRequest{
+		UserID: 123,
+		Period: "last-month",
+		Format: "json",
+	})
+
+	producer.
+		ProduceMessageMock.
+		Expect(producerMessage).
+		Return(nil)
+
+	sender.SendMessageMock.
+		Expect("Preparing your export...", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:   "/export JSON last-month",
+		UserID: 123,
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnAcceptExport_ShouldSendDocument(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	content := []byte("date,category,base_amount,original_amount,currency\n2023-01-01,Food,200.00,200.00,RUB\n")
+	sender.SendDocumentMock.
+		Expect(response.Document{Name: "expenses-month.csv", Content: content}, "", int64(123)).
+		Return(nil)
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.AcceptReport(ctx, &apiv12.ReportResult{
+		Status:   &apiv12.OperationStatus{Success: true},
+		UserID:   123,
+		Period:   "month",
+		Format:   "csv",
+		Document: &apiv12.Document{Name: "expenses-month.csv", Content: content},
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnDocument_ShouldPreviewRowsWithErrors(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.GetUserByIDMock.Return(user.Record{}, nil)
+	storage.FindAccountMock.Return(user.Account{}, &customerr.NotFoundError{})
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) {
+		return name, nil
+	})
+	rates.DailyRatesMock.
+		Inspect(func(_ context.Context, name string, days []time.Time) {
+			assert.Equal(m, "RUB", name)
+			assert.Len(m, days, 2)
+		}).
+		Return(map[string]currency.Rate{"2022-09-01": {BaseRate: 1}, "2022-09-03": {BaseRate: 1}}, nil)
+
+	sender.SendKeyboardMessageMock.
+		Inspect(func(text string, buttons []response.Button, userID int64) {
+			assert.Equal(m, "Rows: 4\nReady to import: 2\nWith errors: 2\n"+
+				"Row 3: The date is incorrect. Should be dd.mm.yyyy or yyyy-mm-dd\n"+
+				"Row 4: The amount is incorrect", text)
+			assert.Equal(m, []response.Button{
+				{Text: "Import", Data: "/import confirm 1"},
+				{Text: "Cancel", Data: "/import cancel 1"},
+			}, buttons)
+			assert.Equal(m, int64(123), userID)
+		}).
+		Return(nil)
+
+	content := "Дата;Категория;Сумма\n" +
+		"01.09.2022;Food;10,50\n" +
+		"31.02.2022;Food;10\n" +
+		"02.09.2022;Food;-5\n" +
+		"2022-09-03;Taxi;7\n"
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		Text:     "/import date=Дата category=категория amount=3",
+		UserID:   123,
+		Document: &response.Document{Name: "bank.csv", Content: []byte(content)},
+	})
+
+	assert.NoError(t, err)
+}
+
+func Test_OnImportConfirm_ShouldImportAndReportDuplicates(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	defer m.Finish()
+	sender := mock.NewMessageSenderMock(m)
+	storage := mock.NewUserStorageMock(m)
+	rates := mock.NewHistoricalRatesMock(m)
+	cache := mock.NewReportCacheMock(m)
+	producer := mock.NewReportRequestProducerMock(m)
+	cfg := newTestConfig(m)
+
+	storage.GetUserByIDMock.Return(user.Record{}, nil)
+	storage.FindAccountMock.Return(user.Account{ID: 5, Name: "card", Currency: "RUB", Default: true}, nil)
+	storage.ResolveCategoryMock.Set(func(_ context.Context, _ int64, name string) (string, error) {
+		return name, nil
+	})
+	rates.DailyRatesMock.Set(func(_ context.Context, name string, _ []time.Time) (map[string]currency.Rate, error) {
+		if name == "USD" {
+			return map[string]currency.Rate{"2022-09-01": {BaseRate: 0.01}}, nil
+		}
+		return map[string]currency.Rate{"2022-09-02": {BaseRate: 1}}, nil
+	})
+	sender.SendKeyboardMessageMock.Return(nil)
+
+	storage.ImportExpensesMock.
+		Inspect(func(_ context.Context, userID int64, recs []user.ExpenseRecord) {
+			assert.Equal(m, int64(123), userID)
+			assert.Equal(m, 2, len(recs))
+			assert.Equal(m, money.FromFloat(1000), recs[0].Amount)
+			assert.Equal(m, money.FromFloat(10), recs[0].OriginalAmount)
+			assert.Equal(m, "USD", recs[0].Currency)
+			assert.Equal(m, "Taxi", recs[0].Note)
+			// only expenses in the currency of the default account are bound to it
+			assert.Equal(m, int64(0), recs[0].AccountID)
+			assert.Equal(m, "RUB", recs[1].Currency)
+			assert.Equal(m, int64(5), recs[1].AccountID)
+		}).
+		Return(1, nil)
+	cache.InvalidateCacheMock.Return(nil)
+
+	sender.EditMessageMock.
+		Inspect(func(text string, buttons []response.Button, chatID int64, messageID int) {
+			assert.Equal(m, "Gotcha! Imported expenses: 1, skipped duplicates: 1", text)
+			assert.Empty(m, buttons)
+			assert.Equal(m, int64(123), chatID)
+			assert.Equal(m, 42, messageID)
+		}).
+		Return(nil)
+
+	content := "date,category,base_amount,original_amount,currency,note\n" +
+		"2022-09-01,Transport,1000,10,USD,Taxi\n" +
+		"2022-09-02,Food,500,500,RUB,\n"
+
+	model := NewService(cfg, sender, storage, rates, cache, producer)
+	err := model.HandleIncomingMessage(ctx, Message{
+		UserID:   123,
+		Document: &response.Document{Name: "expenses-month.csv", Content: []byte(content)},
+	})
+	assert.NoError(t, err)
+
+	err = model.HandleIncomingMessage(ctx, Message{
+		Text:          "/import confirm 1",
+		UserID:        123,
+		EditMessageID: 42,
+		ChatID:        123,
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,311 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/response"
+	"max.ks1230/finances-bot/internal/entity/schedule"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/customerr"
+)
+
+const (
+	// recurringInterval is the schedule resolution, cron-like schedules fire at minutes
+	recurringInterval = time.Minute
+	// recurringBatch bounds the runs saved at once, the rest is saved on the next ticks
+	recurringBatch = 100
+	// recurringMinInterval keeps schedules from flooding users with expenses and notifications
+	recurringMinInterval = time.Hour
+)
+
+const (
+	recurringAddCmd    = "add"
+	recurringListCmd   = "list"
+	recurringRemoveCmd = "remove"
+)
+
+// recurringAddMinParts are "add <category> <amount>" followed by the schedule
+const recurringAddMinParts = 4
+
+const dateTimeLayout = "02.01.2006 15:04"
+
+const (
+	recurringAddedTemplate     = "Gotcha! Recurring expense ID: %d, the first one is on %s"
+	recurringHeaderMessage     = "Recurring expenses:"
+	recurringRecordTemplate    = "#%d %s: %s, %s, next on %s"
+	noRecurringMessage         = "You have no recurring expenses"
+	recurringSavedTemplate     = "Recurring expense #%d %s is saved. Expense ID: %d"
+	recurringRejectedTemplate  = "Recurring expense #%d %s is not saved. %s"
+	recurringSavedManyTemplate = "Recurring expense #%d %s is saved for %d missed runs. Expense IDs: %s"
+	recurringRejectedManyTmpl  = "Recurring expense #%d %s is not saved for %d runs. %s"
+	frequentScheduleMessage    = "Recurring expenses can't be saved more often than hourly"
+	recurringNotFoundMessage   = "I can't find a recurring expense with that ID"
+	incorrectScheduleMessage   = "The schedule is incorrect. Try minute hour day month weekday, like 0 10 1 * *, or daily, weekly, monthly, yearly"
+	cannotSaveRecurringMessage = "Can't save your recurring expense atm. Try later"
+	cannotGetRecurringMessage  = "Can't get your recurring expenses atm. Try later"
+	cannotDelRecurringMessage  = "Can't remove your recurring expense atm. Try later"
+)
+
+// handleRecurring handles "add <category> <amount> <schedule>", "list" and "remove <id>" subcommands.
+// The amount is in user's preferred currency, the schedule is cron-like and evaluated in user's timezone.
+func (s *HandlerService) handleRecurring(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleRecurring - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleRecurring - end")
+
+	args := strings.Fields(arg)
+	if len(args) == 0 {
+		return incorrectUsageMessage, nil
+	}
+	switch strings.ToLower(args[0]) {
+	case recurringAddCmd:
+		return s.addRecurring(ctx, args, userID)
+	case recurringListCmd:
+		return s.listRecurring(ctx, userID)
+	case recurringRemoveCmd:
+		if len(args) != 2 {
+			return incorrectUsageMessage, nil
+		}
+		return s.removeRecurring(ctx, args[1], userID)
+	default:
+		return incorrectUsageMessage, nil
+	}
+}
+
+func (s *HandlerService) addRecurring(ctx context.Context, args []string, userID int64) (string, error) {
+	if len(args) < recurringAddMinParts {
+		return incorrectUsageMessage, nil
+	}
+	userRec, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotSaveRecurringMessage, errors.Wrap(err, "add recurring")
+	}
+	loc := userRec.LocationOrDefault(s.defaultLocation)
+	expense, msg, err := parseExpense(args[1:3], loc)
+	if err != nil {
+		return msg, errors.Wrap(err, "add recurring")
+	}
+	curr := userRec.PreferredCurrencyOrDefault(s.defaultCurrency)
+	msg, err = checkPrecision(expense.Amount, curr)
+	if err != nil {
+		return msg, errors.Wrap(err, "add recurring")
+	}
+	sched, err := schedule.Parse(strings.Join(args[3:], " "))
+	if err != nil {
+		return incorrectScheduleMessage, errors.Wrap(err, "add recurring")
+	}
+	if sched.MinInterval() < recurringMinInterval {
+		return frequentScheduleMessage, errors.Errorf("add recurring: schedule %s is too frequent", sched)
+	}
+	category, categoryHint, err := s.resolveCategory(ctx, userID, expense.Category)
+	if err != nil {
+		return categoryHint, errors.Wrap(err, "add recurring")
+	}
+
+	rec := user.RecurringExpense{
+		Category: category,
+		Amount:   expense.Amount,
+		Currency: curr,
+		Schedule: sched.String(),
+		NextRun:  sched.Next(time.Now().In(loc)),
+	}
+	id, err := s.storage.SaveRecurring(ctx, userID, rec)
+	if err != nil {
+		return cannotSaveRecurringMessage, errors.Wrap(err, "add recurring")
+	}
+	return withWarning(fmt.Sprintf(recurringAddedTemplate, id, rec.NextRun.Format(dateTimeLayout)), categoryHint), nil
+}
+
+func (s *HandlerService) listRecurring(ctx context.Context, userID int64) (string, error) {
+	userRec, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return cannotGetRecurringMessage, errors.Wrap(err, "list recurring")
+	}
+	recs, err := s.storage.GetRecurring(ctx, userID)
+	if err != nil {
+		return cannotGetRecurringMessage, errors.Wrap(err, "list recurring")
+	}
+	if len(recs) == 0 {
+		return noRecurringMessage, nil
+	}
+
+	loc := userRec.LocationOrDefault(s.defaultLocation)
+	res := make([]string, 0, len(recs)+1)
+	res = append(res, recurringHeaderMessage)
+	for _, rec := range recs {
+		res = append(res, fmt.Sprintf(recurringRecordTemplate,
+			rec.ID,
+			rec.Category,
+			formatMoney(rec.Amount, rec.Currency),
+			rec.Schedule,
+			rec.NextRun.In(loc).Format(dateTimeLayout),
+		))
+	}
+	return strings.Join(res, "\n"), nil
+}
+
+func (s *HandlerService) removeRecurring(ctx context.Context, arg string, userID int64) (string, error) {
+	id, err := strconv.ParseInt(arg, idBase, idBitSize)
+	if err != nil {
+		return incorrectUsageMessage, errors.Wrap(err, "remove recurring")
+	}
+	err = s.storage.DeleteRecurring(ctx, userID, id)
+	if err != nil {
+		var notFoundErr *customerr.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return recurringNotFoundMessage, err
+		}
+		return cannotDelRecurringMessage, errors.Wrap(err, "remove recurring")
+	}
+	return okMessage, nil
+}
+
+// SaveDueRecurring saves recurring expenses due at the moment as regular ones and schedules their next runs.
+// It returns notifications about saved and rejected expenses to be sent to their users,
+// runs missed while the bot was down are caught up with a single notification per recurring expense.
+// Runs failed for other reasons, like unavailable rates, are retried later.
+func (s *HandlerService) SaveDueRecurring(ctx context.Context, at time.Time) ([]response.Notification, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "saveDueRecurring")
+	defer span.Finish()
+
+	recs, err := s.storage.GetDueRecurring(ctx, at, recurringBatch)
+	if err != nil {
+		return nil, errors.Wrap(err, "save due recurring")
+	}
+
+	res := make([]response.Notification, 0, len(recs))
+	for _, rec := range recs {
+		text, err := s.saveRecurringRuns(ctx, rec, at)
+		if err != nil {
+			logger.Error("cannot save recurring expense", zap.Int64("id", rec.ID), zap.Error(err))
+		}
+		// runs saved before the error are notified anyway
+		if text != "" {
+			res = append(res, response.Notification{UserID: rec.UserID, Text: text})
+		}
+	}
+	return res, nil
+}
+
+// saveRecurringRuns saves the runs of the recurring expense due by the moment, at most recurringBatch of them,
+// and returns the notification about them.
+func (s *HandlerService) saveRecurringRuns(ctx context.Context, rec user.RecurringExpense, at time.Time) (string, error) {
+	sched, err := schedule.Parse(rec.Schedule)
+	if err != nil {
+		return "", err
+	}
+	userRec, err := s.storage.GetUserByID(ctx, rec.UserID)
+	if err != nil {
+		return "", err
+	}
+	loc := userRec.LocationOrDefault(s.defaultLocation)
+	acc, err := s.defaultAccountIn(ctx, rec.UserID, rec.Currency)
+	if err != nil {
+		return "", err
+	}
+
+	var runs recurringRuns
+	due := rec.NextRun
+	for i := 0; i < recurringBatch && !due.After(at); i++ {
+		due = due.In(loc)
+		if err = s.saveRecurringRun(ctx, rec, acc, due, &runs); err != nil {
+			break
+		}
+		next := sched.Next(due)
+		if err = s.storage.ScheduleRecurring(ctx, rec.ID, due, next); err != nil {
+			break
+		}
+		due = next
+	}
+	return s.recurringNotification(ctx, userRec, rec, runs), err
+}
+
+// recurringRuns collects the outcomes of the runs of a recurring expense to notify about them at once.
+type recurringRuns struct {
+	saved       []int64
+	rejected    []string
+	rateWarning string
+	// lastSaved is the moment of the last saved run, limits are warned about in its month
+	lastSaved time.Time
+}
+
+// saveRecurringRun saves the expense of the run due at the moment with the limits checked as for typed ones.
+// The expense is bound to the account, if any. A run saved before a restart is not saved again.
+func (s *HandlerService) saveRecurringRun(ctx context.Context, rec user.RecurringExpense, acc user.Account,
+	due time.Time, runs *recurringRuns) error {
+	expense := user.ExpenseRecord{
+		Amount:      rec.Amount,
+		Category:    rec.Category,
+		Created:     due,
+		AccountID:   acc.ID,
+		Account:     acc.Name,
+		RecurringID: rec.ID,
+	}
+	rateWarning, err := s.convertExpense(ctx, rec.Currency, &expense)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.storage.SaveExpense(ctx, rec.UserID, expense)
+	var existsErr *customerr.AlreadyExistsError
+	switch {
+	case err == nil:
+		runs.saved = append(runs.saved, id)
+		runs.lastSaved = due
+		if runs.rateWarning == "" {
+			runs.rateWarning = rateWarning
+		}
+	case errors.As(err, &existsErr):
+		// saved before a restart, the user has already been notified
+	default:
+		msg, ok := limitErrorMessage(err)
+		if !ok {
+			return err
+		}
+		runs.rejected = append(runs.rejected, msg)
+	}
+	return nil
+}
+
+// recurringNotification tells about saved and rejected runs of the recurring expense,
+// it is empty if there is nothing to tell.
+func (s *HandlerService) recurringNotification(ctx context.Context, userRec user.Record, rec user.RecurringExpense,
+	runs recurringRuns) string {
+	what := fmt.Sprintf("%s %s", rec.Category, formatMoney(rec.Amount, rec.Currency))
+
+	lines := make([]string, 0, 2)
+	switch len(runs.saved) {
+	case 0:
+	case 1:
+		lines = append(lines, fmt.Sprintf(recurringSavedTemplate, rec.ID, what, runs.saved[0]))
+	default:
+		ids := make([]string, 0, len(runs.saved))
+		for _, id := range runs.saved {
+			ids = append(ids, strconv.FormatInt(id, idBase))
+		}
+		lines = append(lines,
+			fmt.Sprintf(recurringSavedManyTemplate, rec.ID, what, len(runs.saved), strings.Join(ids, ", ")))
+	}
+	switch len(runs.rejected) {
+	case 0:
+	case 1:
+		lines = append(lines, fmt.Sprintf(recurringRejectedTemplate, rec.ID, what, runs.rejected[0]))
+	default:
+		lines = append(lines, fmt.Sprintf(recurringRejectedManyTmpl, rec.ID, what, len(runs.rejected),
+			runs.rejected[len(runs.rejected)-1]))
+	}
+
+	text := strings.Join(lines, "\n")
+	if len(runs.saved) > 0 {
+		s.invalidateReports(rec.UserID)
+		text = withWarning(s.withLimitWarning(ctx, userRec, rec.UserID, rec.Category, runs.lastSaved, text), runs.rateWarning)
+	}
+	return text
+}
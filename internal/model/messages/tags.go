@@ -0,0 +1,95 @@
+package messages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"max.ks1230/finances-bot/internal/utils"
+)
+
+const (
+	tagPrefix = "#"
+	noteQuote = `"`
+	maxTagLen = 64
+)
+
+const (
+	incorrectNoteMessage = `The note should be enclosed in double quotes, like "dinner with friends"`
+	incorrectTagTemplate = "Tags should be at most %d characters long"
+	reportTagTemplate    = "Tag: #%s"
+)
+
+// smartQuotes are replaced by plain ones, as mobile keyboards often type them instead.
+var smartQuotes = strings.NewReplacer("“", noteQuote, "”", noteQuote, "«", noteQuote, "»", noteQuote)
+
+// expenseArgs are arguments of expense commands split into positional ones and optional parts.
+type expenseArgs struct {
+	args    []string
+	account string
+	tags    []string
+	note    string
+}
+
+// splitExpenseArgs takes an optional quoted note, #tags and @account out of the command argument.
+// In case of an error it returns the message to be shown to user.
+func splitExpenseArgs(arg string) (expenseArgs, string, error) {
+	var res expenseArgs
+	rest, note, err := extractNote(arg)
+	if err != nil {
+		return expenseArgs{}, incorrectNoteMessage, err
+	}
+	res.note = note
+
+	res.args, res.tags = extractTags(strings.Fields(rest))
+	for _, tag := range res.tags {
+		if len([]rune(tag)) > maxTagLen {
+			return expenseArgs{}, fmt.Sprintf(incorrectTagTemplate, maxTagLen), errors.New("tag is too long")
+		}
+	}
+	res.args, res.account = extractAccount(res.args)
+	return res, "", nil
+}
+
+// extractNote takes the text enclosed in double quotes out of the argument.
+func extractNote(arg string) (rest, note string, err error) {
+	arg = smartQuotes.Replace(arg)
+	start := strings.Index(arg, noteQuote)
+	if start < 0 {
+		return arg, "", nil
+	}
+	end := strings.LastIndex(arg, noteQuote)
+	if end == start {
+		return "", "", errors.New("unclosed note")
+	}
+	return arg[:start] + " " + arg[end+1:], strings.TrimSpace(arg[start+1 : end]), nil
+}
+
+// extractTags takes "#tag" tokens out of command arguments, the tags are lowercase and unique.
+func extractTags(args []string) ([]string, []string) {
+	rest := make([]string, 0, len(args))
+	var tags []string
+	for _, a := range args {
+		if !strings.HasPrefix(a, tagPrefix) || len(a) == len(tagPrefix) {
+			rest = append(rest, a)
+			continue
+		}
+		tag := strings.ToLower(strings.TrimPrefix(a, tagPrefix))
+		if !utils.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return rest, tags
+}
+
+// formatTagsAndNote formats tags and the note to be appended to an expense line.
+func formatTagsAndNote(tags []string, note string) string {
+	var res string
+	for _, tag := range tags {
+		res += " " + tagPrefix + tag
+	}
+	if note != "" {
+		res += " " + noteQuote + note + noteQuote
+	}
+	return res
+}
@@ -0,0 +1,160 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/currency"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+)
+
+const (
+	transferMinParts = 3
+	transferMaxParts = 4
+)
+
+const (
+	transferSavedTemplate    = "Gotcha! Transfer ID: %d\n%s → %s: %s = %s"
+	transferRateTemplate     = "Rate: 1 %s = %s %s"
+	incorrectTransferMessage = "The transfer amount is incorrect"
+	sameAccountMessage       = "Transfer needs two different accounts"
+	cannotSaveTransferMsg    = "Can't save your transfer atm. Try later"
+)
+
+// handleTransfer handles "<from> <to> <amount> [received-amount]".
+// The amount is in the source account currency, the received one is in the destination account currency.
+// Without the received amount money is exchanged at the current rate.
+func (s *HandlerService) handleTransfer(ctx context.Context, arg string, userID int64) (string, error) {
+	logger.Info("handleTransfer - start", zap.Int64("userID", userID), zap.String("arg", arg))
+	defer logger.Info("handleTransfer - end")
+
+	args := strings.Fields(arg)
+	if len(args) < transferMinParts || len(args) > transferMaxParts {
+		return incorrectUsageMessage, nil
+	}
+	fromName, toName := strings.TrimPrefix(args[0], accountPrefix), strings.TrimPrefix(args[1], accountPrefix)
+	if fromName == "" || toName == "" {
+		return incorrectUsageMessage, nil
+	}
+
+	amount, err := parseTransferAmount(args[2])
+	if err != nil {
+		return incorrectTransferMessage, errors.Wrap(err, "handle transfer")
+	}
+	from, msg, err := s.accountOf(ctx, userID, fromName)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle transfer")
+	}
+	to, msg, err := s.accountOf(ctx, userID, toName)
+	if err != nil {
+		return msg, errors.Wrap(err, "handle transfer")
+	}
+	if from.ID == to.ID {
+		return sameAccountMessage, nil
+	}
+	if msg, err = checkPrecision(amount, from.Currency); err != nil {
+		return msg, errors.Wrap(err, "handle transfer")
+	}
+
+	var received money.Amount
+	var rate float64
+	var warning string
+	if len(args) == transferMaxParts {
+		received, err = parseTransferAmount(args[3])
+		if err != nil {
+			return incorrectTransferMessage, errors.Wrap(err, "handle transfer")
+		}
+		if msg, err = checkPrecision(received, to.Currency); err != nil {
+			return msg, errors.Wrap(err, "handle transfer")
+		}
+		// the effective rate money was actually exchanged at
+		rate = received.Float() / amount.Float()
+	} else {
+		rate, warning, err = s.exchangeRate(ctx, from.Currency, to.Currency)
+		if err != nil {
+			return rateErrorMessage(err), errors.Wrap(err, "handle transfer")
+		}
+		received = exchangeAt(amount, rate, to.Currency)
+	}
+
+	transfer := user.Transfer{
+		Created:       time.Now(),
+		FromAccountID: from.ID,
+		From:          from.Name,
+		Amount:        amount,
+		ToAccountID:   to.ID,
+		To:            to.Name,
+		Received:      received,
+		Rate:          rate,
+	}
+	id, err := s.storage.SaveTransfer(ctx, userID, transfer)
+	if err != nil {
+		return cannotSaveTransferMsg, errors.Wrap(err, "handle transfer")
+	}
+
+	res := fmt.Sprintf(transferSavedTemplate, id, from.Name, to.Name,
+		formatMoney(amount, from.Currency), formatMoney(received, to.Currency))
+	if from.Currency != to.Currency {
+		res += "\n" + fmt.Sprintf(transferRateTemplate,
+			from.Currency, strconv.FormatFloat(transfer.Rate, 'f', rateDigits, 64), to.Currency)
+	}
+	return withWarning(res, warning), nil
+}
+
+func parseTransferAmount(s string) (money.Amount, error) {
+	amount, err := money.Parse(s)
+	if err != nil {
+		return 0, err
+	}
+	if amount <= 0 {
+		return 0, errors.New("non-positive amount")
+	}
+	return amount, nil
+}
+
+// exchange converts the amount between currencies at their current rates.
+// It returns a warning to be shown to user if any of the rates is stale.
+func (s *HandlerService) exchange(ctx context.Context, amount money.Amount, from, to string) (money.Amount, string, error) {
+	rate, warning, err := s.exchangeRate(ctx, from, to)
+	if err != nil {
+		return 0, "", err
+	}
+	return exchangeAt(amount, rate, to), warning, nil
+}
+
+// exchangeRate returns the current rate of the currencies, the target amount per source one.
+// It returns a warning to be shown to user if any of the rates is stale.
+func (s *HandlerService) exchangeRate(ctx context.Context, from, to string) (float64, string, error) {
+	if from == to {
+		return 1, "", nil
+	}
+	fromRate, fromWarning, err := s.currentRate(ctx, from)
+	if err != nil {
+		return 0, "", err
+	}
+	toRate, toWarning, err := s.currentRate(ctx, to)
+	if err != nil {
+		return 0, "", err
+	}
+	if fromRate.BaseRate == 0 {
+		return 0, "", fmt.Errorf("rate %s is zero", from)
+	}
+	warning := strings.TrimPrefix(withWarning(fromWarning, toWarning), "\n")
+	return toRate.BaseRate / fromRate.BaseRate, warning, nil
+}
+
+// exchangeAt converts the amount at the rate rounding it to minor digits of the target currency.
+func exchangeAt(amount money.Amount, rate float64, to string) money.Amount {
+	res := amount.Mul(rate)
+	if info, ok := currency.Lookup(to); ok {
+		res = res.Round(info.MinorDigits)
+	}
+	return res
+}
@@ -2,23 +2,29 @@ package messages
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/jinzhu/now"
+	"github.com/pkg/errors"
+
 	apiv1 "max.ks1230/finances-bot/api/grpc"
+	"max.ks1230/finances-bot/internal/model/reports"
 
+	"max.ks1230/finances-bot/internal/entity/currency"
+	"max.ks1230/finances-bot/internal/entity/money"
 	"max.ks1230/finances-bot/internal/entity/user"
 )
 
-const commandParts = 2
+// reportIndent shifts subcategories of a report right of their parents
+const reportIndent = "    "
 
-func location() *time.Location {
-	loc, err := time.LoadLocation("Europe/Moscow")
-	if err != nil {
-		return time.UTC
-	}
-	return loc
-}
+const (
+	commandParts   = 2
+	dateRangeParts = 2
+	dateRangeSep   = "-"
+)
 
 func parseCommand(text string) (cmd, arg string) {
 	text = strings.TrimSpace(text)
@@ -33,19 +39,133 @@ func parseCommand(text string) (cmd, arg string) {
 	return "", text
 }
 
-func convertExpenseToBase(exp *user.ExpenseRecord, rate float64) {
-	exp.Amount /= rate
+// parseDateRange parses "dd.mm.yyyy-dd.mm.yyyy" range in the given location, both dates are inclusive.
+func parseDateRange(text string, loc *time.Location) (reports.Range, bool) {
+	split := strings.Split(text, dateRangeSep)
+	if len(split) != dateRangeParts {
+		return reports.Range{}, false
+	}
+	from, err := time.ParseInLocation(dateLayout, split[0], loc)
+	if err != nil {
+		return reports.Range{}, false
+	}
+	to, err := time.ParseInLocation(dateLayout, split[1], loc)
+	if err != nil || to.Before(from) {
+		return reports.Range{}, false
+	}
+	return reports.Range{From: from, To: to.AddDate(0, 0, 1)}, true
+}
+
+// parsePeriod parses either a named period resolved relative to the given moment or a date range in its location.
+func parsePeriod(text string, at time.Time, weekStart time.Weekday) (reports.Range, bool) {
+	rng, ok := reports.ResolvePeriod(text, at, weekStart)
+	if !ok {
+		rng, ok = parseDateRange(text, at.Location())
+	}
+	return rng, ok
+}
+
+// namedPeriods returns non-empty named report periods in a stable order
+func namedPeriods() []string {
+	res := make([]string, 0)
+	for _, p := range reports.ReportPeriods() {
+		if p != "" {
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// isBackdated tells if the moment is before the current day in its location.
+func isBackdated(t time.Time) bool {
+	return t.Before(now.With(time.Now().In(t.Location())).BeginningOfDay())
 }
 
-func convertToBase(amount float64, rate float64) float64 {
-	return amount / rate
+// convertExpenseToBase converts typed expense amount to base currency keeping the original one.
+func convertExpenseToBase(exp *user.ExpenseRecord, curr string, rate float64) {
+	exp.OriginalAmount, exp.Currency, exp.Rate = exp.Amount, curr, rate
+	exp.Amount = exp.Amount.Div(rate)
+}
+
+func convertToBase(amount money.Amount, rate float64) money.Amount {
+	return amount.Div(rate)
 }
 
 func formatReport(report *apiv1.ReportResult) string {
+	curr := report.GetCurrency()
 	res := make([]string, 0)
-	for _, rec := range report.GetRecords() {
-		res = append(res, fmt.Sprintf("%s: %.2f", rec.GetCategory(), rec.GetAmount()))
+	switch {
+	case report.GetAccount() != "":
+		res = append(res, fmt.Sprintf(reportAccountTemplate, report.GetAccount()), "")
+	case report.GetByAccount():
+		res = append(res, reportByAccountMessage, "")
+	}
+	if report.GetTag() != "" {
+		res = append(res, fmt.Sprintf(reportTagTemplate, report.GetTag()), "")
+	}
+	if report.GetCategory() != "" {
+		res = append(res, fmt.Sprintf(reportCategoryTemplate, report.GetCategory()), "")
+	}
+	res = formatRecords(res, report.GetRecords(), 0, curr)
+	res = append(res, "", fmt.Sprintf("Total: %s", formatMoney(money.Amount(report.GetTotalAmount()), curr)))
+	if len(report.GetIncomes()) > 0 {
+		res = append(res, "", "Income:")
+		res = formatRecords(res, report.GetIncomes(), 0, curr)
+		res = append(res,
+			"",
+			fmt.Sprintf("Total income: %s", formatMoney(money.Amount(report.GetTotalIncome()), curr)),
+			fmt.Sprintf("Balance: %s", formatMoney(money.Amount(report.GetTotalIncome()-report.GetTotalAmount()), curr)),
+		)
 	}
-	res = append(res, "", fmt.Sprintf("Total: %.2f", report.GetTotalAmount()))
 	return strings.Join(res, "\n")
 }
+
+// formatRecords appends lines of the records, subcategories are indented under their parents with subtotals.
+func formatRecords(lines []string, records []*apiv1.ReportRecord, depth int, curr string) []string {
+	indent := strings.Repeat(reportIndent, depth)
+	for _, rec := range records {
+		lines = append(lines,
+			fmt.Sprintf("%s%s: %s", indent, rec.GetCategory(), formatMoney(money.Amount(rec.GetAmount()), curr)))
+		lines = formatRecords(lines, rec.GetChildren(), depth+1, curr)
+	}
+	return lines
+}
+
+// formatMoney formats the amount with minor digits and symbol of the currency.
+// Amounts of unknown or empty currency are formatted as is.
+func formatMoney(amount money.Amount, curr string) string {
+	info, ok := currency.Lookup(curr)
+	if !ok {
+		return strings.TrimSpace(amount.String() + " " + curr)
+	}
+	return amount.Format(info.MinorDigits) + " " + info.Symbol
+}
+
+// checkPrecision returns a message and an error if the amount has more fraction digits than the currency has.
+// Amounts of unknown currencies are kept to the digits money amounts have.
+func checkPrecision(amount money.Amount, curr string) (string, error) {
+	info, ok := currency.Lookup(curr)
+	if !ok || amount.FitsDigits(info.MinorDigits) {
+		return "", nil
+	}
+	err := errors.Errorf("%s amount %s is too precise", curr, amount)
+	if info.MinorDigits == 0 {
+		return fmt.Sprintf(noFractionTemplate, curr), err
+	}
+	return fmt.Sprintf(tooPreciseTemplate, curr, info.MinorDigits), err
+}
+
+// formatAge formats the duration roughly, like 2d 5h, 3h 12m or 40m.
+func formatAge(d time.Duration) string {
+	const day = 24 * time.Hour
+	d = d.Round(time.Minute)
+	switch {
+	case d >= day:
+		return fmt.Sprintf("%dd %dh", d/day, d%day/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %dm", d/time.Hour, d%time.Hour/time.Minute)
+	default:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+}
@@ -0,0 +1,87 @@
+package rates
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/logger"
+)
+
+// Quote is a rate value along with the name of the source it came from.
+type Quote struct {
+	Value  float64
+	Source string
+}
+
+type sourceProvider interface {
+	GetRates(ctx context.Context, base string, relatives []string) (map[string]float64, error)
+	GetHistoricalRates(ctx context.Context, base string, relatives []string, date time.Time) (map[string]float64, error)
+}
+
+// Source is a rates provider known by its name.
+type Source struct {
+	Name     string
+	Provider sourceProvider
+}
+
+// Chain pulls rates from sources in order, every next source is asked only for the rates the previous ones missed.
+type Chain struct {
+	sources []Source
+}
+
+func NewChain(sources ...Source) *Chain {
+	return &Chain{sources: sources}
+}
+
+func (c *Chain) GetRates(ctx context.Context, base string, relatives []string) (map[string]Quote, error) {
+	return c.pull(relatives, func(p sourceProvider, missing []string) (map[string]float64, error) {
+		return p.GetRates(ctx, base, missing)
+	})
+}
+
+func (c *Chain) GetHistoricalRates(ctx context.Context, base string, relatives []string,
+	date time.Time) (map[string]Quote, error) {
+	return c.pull(relatives, func(p sourceProvider, missing []string) (map[string]float64, error) {
+		return p.GetHistoricalRates(ctx, base, missing, date)
+	})
+}
+
+func (c *Chain) pull(relatives []string,
+	get func(p sourceProvider, missing []string) (map[string]float64, error)) (map[string]Quote, error) {
+	res := make(map[string]Quote, len(relatives))
+	missing := relatives
+	lastErr := fmt.Errorf("no rate sources")
+	for _, src := range c.sources {
+		if len(missing) == 0 {
+			break
+		}
+
+		pulled, err := get(src.Provider, missing)
+		if err != nil {
+			logger.Error("rate source failed", zap.String("source", src.Name), zap.Error(err))
+			lastErr = err
+			continue
+		}
+
+		stillMissing := make([]string, 0, len(missing))
+		for _, curr := range missing {
+			if val, ok := pulled[curr]; ok && val > 0 {
+				res[curr] = Quote{Value: val, Source: src.Name}
+			} else {
+				stillMissing = append(stillMissing, curr)
+			}
+		}
+		missing = stillMissing
+	}
+
+	if len(res) == 0 && len(relatives) > 0 {
+		return nil, errors.Wrap(lastErr, "rates chain")
+	}
+	if len(missing) > 0 {
+		logger.Error("rates are missing in all sources", zap.Strings("rates", missing))
+	}
+	return res, nil
+}
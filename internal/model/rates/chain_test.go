@@ -0,0 +1,57 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubProvider struct {
+	rates map[string]float64
+	err   error
+	asked [][]string
+}
+
+func (p *stubProvider) GetRates(_ context.Context, _ string, relatives []string) (map[string]float64, error) {
+	p.asked = append(p.asked, relatives)
+	return p.rates, p.err
+}
+
+func (p *stubProvider) GetHistoricalRates(ctx context.Context, base string, relatives []string,
+	_ time.Time) (map[string]float64, error) {
+	return p.GetRates(ctx, base, relatives)
+}
+
+func Test_OnChainGetRates_ShouldAskNextSourcesForMissingRates(t *testing.T) {
+	failing := &stubProvider{err: errors.New("unavailable")}
+	partial := &stubProvider{rates: map[string]float64{"USD": 0.016}}
+	full := &stubProvider{rates: map[string]float64{"USD": 0.017, "EUR": 0.015}}
+	chain := NewChain(
+		Source{Name: "fixer", Provider: failing},
+		Source{Name: "cbr", Provider: partial},
+		Source{Name: "ecb", Provider: full},
+	)
+
+	quotes, err := chain.GetRates(context.Background(), "RUB", []string{"USD", "EUR"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Quote{
+		"USD": {Value: 0.016, Source: "cbr"},
+		"EUR": {Value: 0.015, Source: "ecb"},
+	}, quotes)
+	assert.Equal(t, [][]string{{"EUR"}}, full.asked)
+}
+
+func Test_OnChainGetHistoricalRates_ShouldFailWhenAllSourcesFail(t *testing.T) {
+	chain := NewChain(
+		Source{Name: "fixer", Provider: &stubProvider{err: errors.New("unavailable")}},
+		Source{Name: "cbr", Provider: &stubProvider{rates: map[string]float64{}}},
+	)
+
+	_, err := chain.GetHistoricalRates(context.Background(), "RUB", []string{"USD"}, time.Now())
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package rates
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var rateAgeDesc = prometheus.NewDesc(
+	"route256_rates_rate_age_seconds",
+	"Age of the latest stored rate of a currency",
+	[]string{"currency"},
+	nil,
+)
+
+// rateAges is a collector reporting rate ages at scrape time, so they keep growing while pulling fails.
+type rateAges struct {
+	mu      sync.RWMutex
+	updated map[string]time.Time
+}
+
+var rateAgeCollector = &rateAges{updated: make(map[string]time.Time)}
+
+func init() {
+	prometheus.MustRegister(rateAgeCollector)
+}
+
+func (a *rateAges) observe(name string, updatedAt time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if updatedAt.After(a.updated[name]) {
+		a.updated[name] = updatedAt
+	}
+}
+
+func (a *rateAges) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rateAgeDesc
+}
+
+func (a *rateAges) Collect(ch chan<- prometheus.Metric) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for name, updatedAt := range a.updated {
+		ch <- prometheus.MustNewConstMetric(rateAgeDesc, prometheus.GaugeValue, time.Since(updatedAt).Seconds(), name)
+	}
+}
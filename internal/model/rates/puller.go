@@ -17,23 +17,29 @@ import (
 )
 
 type ratesStorage interface {
-	NewRate(ctx context.Context, name string) error
-	UpdateRateValue(ctx context.Context, name string, val float64) error
+	GetRate(ctx context.Context, name string) (currency.Rate, error)
+	UpdateRateValue(ctx context.Context, name string, val float64, source string) error
+	GetRateAt(ctx context.Context, name string, at time.Time) (currency.Rate, error)
+	GetRatesBetween(ctx context.Context, name string, from, to time.Time) ([]currency.Rate, error)
+	SaveRateAt(ctx context.Context, name string, val float64, source string, at time.Time) error
 }
 
 type ratesProvider interface {
-	GetRates(ctx context.Context, base string, relatives []string) (map[string]float64, error)
+	GetRates(ctx context.Context, base string, relatives []string) (map[string]Quote, error)
+	GetHistoricalRates(ctx context.Context, base string, relatives []string, date time.Time) (map[string]Quote, error)
 }
 
 type config interface {
 	BaseCurrency() string
 	PullingDelayMinutes() int64
+	Currencies() []string
 }
 
 type Puller struct {
 	storage      ratesStorage
 	provider     ratesProvider
 	baseCurrency string
+	currencies   []string
 	pullingDelay int64
 }
 
@@ -42,6 +48,7 @@ func NewPuller(storage ratesStorage, provider ratesProvider, config config) (*Pu
 		storage:      storage,
 		provider:     provider,
 		baseCurrency: config.BaseCurrency(),
+		currencies:   config.Currencies(),
 		pullingDelay: config.PullingDelayMinutes(),
 	}
 	err := p.initStorage()
@@ -54,21 +61,22 @@ func NewPuller(storage ratesStorage, provider ratesProvider, config config) (*Pu
 func (p *Puller) initStorage() error {
 	ctx := context.Background()
 
-	if !utils.Contains(currency.Currencies, p.baseCurrency) {
+	if !utils.Contains(p.currencies, p.baseCurrency) {
 		return fmt.Errorf("unknown currency %s", p.baseCurrency)
 	}
 
-	for _, curr := range currency.Currencies {
-		err := p.storage.NewRate(ctx, curr)
-		if err != nil {
-			return errors.New("cannot save currency to storage")
-		}
-	}
-
-	err := p.storage.UpdateRateValue(ctx, p.baseCurrency, 1)
+	err := p.storage.UpdateRateValue(ctx, p.baseCurrency, 1, "")
 	if err != nil {
 		return errors.New("cannot update currency")
 	}
+
+	// the ages of rates pulled before the restart are reported from the start, so they keep growing
+	// if pulling fails, rates never pulled are reported after the first successful pull
+	for _, curr := range p.nonBaseCurrencies() {
+		if rate, err := p.storage.GetRate(ctx, curr); err == nil {
+			rateAgeCollector.observe(curr, rate.UpdatedAt)
+		}
+	}
 	return nil
 }
 
@@ -105,30 +113,140 @@ func (p *Puller) pullOnce(ctx context.Context) {
 		return
 	}
 
-	for name, rate := range pulledRates {
-		p.updateRate(ctx, name, rate)
+	for name, quote := range pulledRates {
+		p.updateRate(ctx, name, quote)
 	}
 
 	logger.Info("Successfully pulled current rates")
 }
 
-func (p *Puller) updateRate(ctx context.Context, name string, rate float64) {
+func (p *Puller) updateRate(ctx context.Context, name string, quote Quote) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "updateRate")
 	defer span.Finish()
 	span.SetTag("rate", name)
+	span.SetTag("source", quote.Source)
 
-	err := p.storage.UpdateRateValue(ctx, name, rate)
+	err := p.storage.UpdateRateValue(ctx, name, quote.Value, quote.Source)
 	if err == nil {
-		logger.Info("successfully saved rate", zap.String("rate", name))
+		rateAgeCollector.observe(name, time.Now())
+		logger.Info("successfully saved rate", zap.String("rate", name), zap.String("source", quote.Source))
 	} else {
 		ext.Error.Set(span, true)
 		logger.Error("failed to save rate", zap.Error(err), zap.String("rate", name))
 	}
 }
 
+// DayLayout formats the days rates are keyed by.
+const DayLayout = "2006-01-02"
+
+// RateAt returns the rate of the day of the given moment.
+// Rates missing in storage are fetched from the provider and saved for the later use.
+func (p *Puller) RateAt(ctx context.Context, name string, at time.Time) (currency.Rate, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "rateAt")
+	defer span.Finish()
+	span.SetTag("rate", name)
+
+	dayStart := startOfDay(at)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	if name == p.baseCurrency {
+		return currency.Rate{Name: name, BaseRate: 1, Set: true, UpdatedAt: dayStart}, nil
+	}
+
+	rate, err := p.storage.GetRateAt(ctx, name, dayEnd)
+	if err == nil && !rate.UpdatedAt.Before(dayStart) {
+		return rate, nil
+	}
+
+	rate, err = p.pullRateAt(ctx, name, dayStart)
+	if err != nil {
+		ext.Error.Set(span, true)
+		return currency.Rate{}, errors.Wrap(err, "rate at")
+	}
+	return rate, nil
+}
+
+// DailyRates returns the rates of the days of the given moments keyed by the days formatted with DayLayout.
+// Stored rates of all the days are got at once, only the missing ones are fetched from the provider.
+func (p *Puller) DailyRates(ctx context.Context, name string, days []time.Time) (map[string]currency.Rate, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "dailyRates")
+	defer span.Finish()
+	span.SetTag("rate", name)
+
+	res := make(map[string]currency.Rate, len(days))
+	if len(days) == 0 {
+		return res, nil
+	}
+	if name == p.baseCurrency {
+		for _, day := range days {
+			dayStart := startOfDay(day)
+			res[dayStart.Format(DayLayout)] = currency.Rate{Name: name, BaseRate: 1, Set: true, UpdatedAt: dayStart}
+		}
+		return res, nil
+	}
+
+	first, last := startOfDay(days[0]), startOfDay(days[0])
+	for _, day := range days[1:] {
+		if day = startOfDay(day); day.Before(first) {
+			first = day
+		} else if day.After(last) {
+			last = day
+		}
+	}
+	stored, err := p.storage.GetRatesBetween(ctx, name, first, last.AddDate(0, 0, 1))
+	if err != nil {
+		ext.Error.Set(span, true)
+		return nil, errors.Wrap(err, "daily rates")
+	}
+	// stored rates go from the earliest, so the last one of a day is kept
+	for _, rate := range stored {
+		res[rate.UpdatedAt.In(first.Location()).Format(DayLayout)] = rate
+	}
+
+	for _, day := range days {
+		dayStart := startOfDay(day)
+		key := dayStart.Format(DayLayout)
+		if _, ok := res[key]; ok {
+			continue
+		}
+		rate, err := p.pullRateAt(ctx, name, dayStart)
+		if err != nil {
+			ext.Error.Set(span, true)
+			return nil, errors.Wrap(err, "daily rates")
+		}
+		res[key] = rate
+	}
+	return res, nil
+}
+
+// pullRateAt fetches the rates of all currencies of the day from the provider, saves them
+// and returns the one of the currency.
+func (p *Puller) pullRateAt(ctx context.Context, name string, dayStart time.Time) (currency.Rate, error) {
+	logger.Info("Pulling historical rates...", zap.Time("date", dayStart))
+	pulledRates, err := p.provider.GetHistoricalRates(ctx, p.baseCurrency, p.nonBaseCurrencies(), dayStart)
+	if err != nil {
+		return currency.Rate{}, err
+	}
+	for n, quote := range pulledRates {
+		if err = p.storage.SaveRateAt(ctx, n, quote.Value, quote.Source, dayStart); err != nil {
+			logger.Error("failed to save historical rate", zap.Error(err), zap.String("rate", n))
+		}
+	}
+
+	quote, ok := pulledRates[name]
+	if !ok {
+		return currency.Rate{}, fmt.Errorf("rate %s at %s is unknown", name, dayStart.Format(time.RFC3339))
+	}
+	return currency.Rate{Name: name, BaseRate: quote.Value, Set: true, UpdatedAt: dayStart, Source: quote.Source}, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
 func (p *Puller) nonBaseCurrencies() []string {
 	var relatives []string
-	for _, curr := range currency.Currencies {
+	for _, curr := range p.currencies {
 		if curr != p.baseCurrency {
 			relatives = append(relatives, curr)
 		}
@@ -0,0 +1,107 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"max.ks1230/finances-bot/internal/entity/currency"
+)
+
+// stubStorage keeps the rates in memory, the latest one of a currency goes last
+type stubStorage struct {
+	rates   map[string][]currency.Rate
+	between int
+}
+
+func (s *stubStorage) GetRate(_ context.Context, name string) (currency.Rate, error) {
+	rates := s.rates[name]
+	if len(rates) == 0 {
+		return currency.Rate{}, fmt.Errorf("rate %s is not set yet", name)
+	}
+	return rates[len(rates)-1], nil
+}
+
+func (s *stubStorage) UpdateRateValue(ctx context.Context, name string, val float64, source string) error {
+	return s.SaveRateAt(ctx, name, val, source, time.Now())
+}
+
+func (s *stubStorage) GetRateAt(_ context.Context, name string, at time.Time) (currency.Rate, error) {
+	rates := s.rates[name]
+	for i := len(rates) - 1; i >= 0; i-- {
+		if !rates[i].UpdatedAt.After(at) {
+			return rates[i], nil
+		}
+	}
+	return currency.Rate{}, fmt.Errorf("rate %s at %s is unknown", name, at)
+}
+
+func (s *stubStorage) GetRatesBetween(_ context.Context, name string, from, to time.Time) ([]currency.Rate, error) {
+	s.between++
+	res := make([]currency.Rate, 0)
+	for _, rate := range s.rates[name] {
+		if !rate.UpdatedAt.Before(from) && rate.UpdatedAt.Before(to) {
+			res = append(res, rate)
+		}
+	}
+	return res, nil
+}
+
+func (s *stubStorage) SaveRateAt(_ context.Context, name string, val float64, source string, at time.Time) error {
+	s.rates[name] = append(s.rates[name], currency.Rate{Name: name, BaseRate: val, Set: true, UpdatedAt: at, Source: source})
+	return nil
+}
+
+type stubPullerConfig struct{}
+
+func (stubPullerConfig) BaseCurrency() string       { return "RUB" }
+func (stubPullerConfig) PullingDelayMinutes() int64 { return 60 }
+func (stubPullerConfig) Currencies() []string       { return []string{"RUB", "USD", "EUR"} }
+
+func Test_OnRestartWithFailedPull_ShouldReportAgeOfPulledRates(t *testing.T) {
+	pulledAt := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	storage := &stubStorage{rates: map[string][]currency.Rate{
+		"USD": {{Name: "USD", BaseRate: 0.016, Set: true, UpdatedAt: pulledAt, Source: "cbr"}},
+	}}
+	provider := NewChain(Source{Name: "cbr", Provider: &stubProvider{err: errors.New("unavailable")}})
+
+	p, err := NewPuller(storage, provider, stubPullerConfig{})
+	assert.NoError(t, err)
+	p.pullOnce(context.Background())
+
+	rateAgeCollector.mu.RLock()
+	defer rateAgeCollector.mu.RUnlock()
+	assert.Equal(t, pulledAt, rateAgeCollector.updated["USD"])
+	assert.NotContains(t, rateAgeCollector.updated, "EUR")
+}
+
+func Test_OnDailyRates_ShouldPullOnlyMissingDays(t *testing.T) {
+	day := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	storage := &stubStorage{rates: map[string][]currency.Rate{
+		"USD": {
+			{Name: "USD", BaseRate: 0.016, Set: true, UpdatedAt: day.Add(time.Hour)},
+			{Name: "USD", BaseRate: 0.017, Set: true, UpdatedAt: day.Add(20 * time.Hour)},
+		},
+	}}
+	provider := &stubProvider{rates: map[string]float64{"USD": 0.018, "EUR": 0.015}}
+	p, err := NewPuller(storage, NewChain(Source{Name: "cbr", Provider: provider}), stubPullerConfig{})
+	assert.NoError(t, err)
+
+	rates, err := p.DailyRates(context.Background(), "USD", []time.Time{
+		day.Add(10 * time.Hour),
+		day.AddDate(0, 0, 5).Add(12 * time.Hour),
+		day.Add(15 * time.Hour),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, storage.between)
+	assert.Len(t, provider.asked, 1)
+	assert.Len(t, rates, 2)
+	assert.Equal(t, 0.017, rates["2022-09-01"].BaseRate)
+	assert.Equal(t, 0.018, rates["2022-09-06"].BaseRate)
+	// the pulled rates of the day are saved for all currencies
+	assert.Len(t, storage.rates["EUR"], 1)
+}
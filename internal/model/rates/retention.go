@@ -0,0 +1,73 @@
+package rates
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/logger"
+)
+
+const compactionInterval = 24 * time.Hour
+
+type compactingStorage interface {
+	CompactRates(ctx context.Context, after, before time.Time) (int64, error)
+}
+
+type retentionConfig interface {
+	RatesRetention() time.Duration
+}
+
+// Compactor thins out rates older than the retention window to one per currency per day.
+// Every run considers only the rates since the previous cutoff, the first one after a start considers all of them.
+type Compactor struct {
+	storage   compactingStorage
+	retention time.Duration
+	clock     func() time.Time
+	// compactedBefore is the cutoff of the last successful run
+	compactedBefore time.Time
+}
+
+func NewCompactor(storage compactingStorage, config retentionConfig) *Compactor {
+	return &Compactor{
+		storage:   storage,
+		retention: config.RatesRetention(),
+		clock:     time.Now,
+	}
+}
+
+func (c *Compactor) Run(ctx context.Context) {
+	ticker := time.NewTicker(compactionInterval)
+	defer ticker.Stop()
+	firstTick := make(chan struct{}, 1)
+	firstTick <- struct{}{}
+
+	logger.Info("Start compacting rates", zap.Duration("retention", c.retention))
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stop compacting rates")
+			return
+		// fake first tick to compact rates piled up while the bot was down
+		case <-firstTick:
+			c.compactOnce(ctx)
+		case <-ticker.C:
+			c.compactOnce(ctx)
+		}
+	}
+}
+
+func (c *Compactor) compactOnce(ctx context.Context) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "compactRates")
+	defer span.Finish()
+
+	before := c.clock().Add(-c.retention)
+	deleted, err := c.storage.CompactRates(ctx, c.compactedBefore, before)
+	if err != nil {
+		logger.Error("cannot compact rates", zap.Error(err))
+		return
+	}
+	c.compactedBefore = before
+	logger.Info("Successfully compacted rates", zap.Int64("deleted", deleted))
+}
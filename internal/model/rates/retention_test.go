@@ -0,0 +1,55 @@
+package rates
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCompactingStorage struct {
+	after  []time.Time
+	before []time.Time
+}
+
+func (s *stubCompactingStorage) CompactRates(_ context.Context, after, before time.Time) (int64, error) {
+	s.after = append(s.after, after)
+	s.before = append(s.before, before)
+	return 0, nil
+}
+
+type stubRetentionConfig time.Duration
+
+func (c stubRetentionConfig) RatesRetention() time.Duration {
+	return time.Duration(c)
+}
+
+func Test_OnCompact_ShouldKeepRatesOfRetentionWindow(t *testing.T) {
+	now := time.Date(2022, 11, 30, 12, 0, 0, 0, time.UTC)
+	storage := &stubCompactingStorage{}
+	compactor := NewCompactor(storage, stubRetentionConfig(30*24*time.Hour))
+	compactor.clock = func() time.Time {
+		return now
+	}
+
+	compactor.compactOnce(context.Background())
+
+	assert.Equal(t, []time.Time{time.Date(2022, 10, 31, 12, 0, 0, 0, time.UTC)}, storage.before)
+}
+
+func Test_OnCompact_ShouldStartFromPreviousCutoff(t *testing.T) {
+	now := time.Date(2022, 11, 30, 12, 0, 0, 0, time.UTC)
+	storage := &stubCompactingStorage{}
+	compactor := NewCompactor(storage, stubRetentionConfig(30*24*time.Hour))
+	compactor.clock = func() time.Time {
+		return now
+	}
+
+	compactor.compactOnce(context.Background())
+	now = now.Add(compactionInterval)
+	compactor.compactOnce(context.Background())
+
+	assert.Equal(t, []time.Time{{}, time.Date(2022, 10, 31, 12, 0, 0, 0, time.UTC)}, storage.after)
+	assert.Equal(t, time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC), storage.before[1])
+}
@@ -13,6 +13,9 @@ import (
 	pb "max.ks1230/finances-bot/api/grpc"
 )
 
+// maxReportSize lets exported documents up to the Telegram bot upload limit through
+const maxReportSize = 50 << 20
+
 type reportAcceptor interface {
 	AcceptReport(ctx context.Context, report *pb.ReportResult) error
 }
@@ -30,7 +33,7 @@ func NewServer(port int, acceptor reportAcceptor) (*AcceptorServer, error) {
 		return nil, errors.Wrap(err, "cannot create server")
 	}
 
-	rpcServer := grpc.NewServer()
+	rpcServer := grpc.NewServer(grpc.MaxRecvMsgSize(maxReportSize))
 	service := &AcceptorServer{
 		acceptor: acceptor,
 		server:   rpcServer,
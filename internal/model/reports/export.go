@@ -0,0 +1,159 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	apiv1 "max.ks1230/finances-bot/api/grpc"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+)
+
+// Export formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+const (
+	exportDateLayout = "2006-01-02"
+	exportFileName   = "expenses"
+)
+
+var csvHeader = []string{"date", "category", "base_amount", "original_amount", "currency"}
+
+// exportRow is an expense as it is exported, amounts are written as decimals.
+type exportRow struct {
+	Date           string       `json:"date"`
+	Category       string       `json:"category"`
+	BaseAmount     money.Amount `json:"baseAmount"`
+	OriginalAmount money.Amount `json:"originalAmount"`
+	Currency       string       `json:"currency"`
+}
+
+// ExportFormats returns supported export formats, the default one first.
+func ExportFormats() []string {
+	return []string{FormatCSV, FormatJSON}
+}
+
+// GenerateExport exports user expenses within the range to a document of the format, the earliest first.
+// If the range is zero, it is resolved from the named period. No document is attached if there are no expenses.
+func (g *Generator) GenerateExport(ctx context.Context, userID int64, period string, rng Range,
+	format string) (report *apiv1.ReportResult, err error) {
+	logger.Info("GenerateExport - start", zap.Int64("userID", userID), zap.String("period", period))
+	defer logger.Info("GenerateExport - end")
+
+	defer func() {
+		report = withStatus(report, err)
+		report.UserID = userID
+		report.Period = period
+		report.Format = format
+	}()
+
+	userRec, err := g.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate export")
+	}
+	rng, err = g.resolveRange(userRec, period, rng)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate export")
+	}
+	expenses, err := g.storage.GetUserExpenses(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate export")
+	}
+	expenses = filterExpensesWithin(expenses, rng)
+	if len(expenses) == 0 {
+		return nil, nil
+	}
+
+	rows := exportRows(expenses, g.defaultCurrency, userRec.LocationOrDefault(g.location))
+	var content []byte
+	switch format {
+	case FormatCSV:
+		content, err = encodeCSV(rows)
+	case FormatJSON:
+		content, err = json.MarshalIndent(rows, "", "  ")
+	default:
+		err = fmt.Errorf("export format %s is not supported", format)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "generate export")
+	}
+	return &apiv1.ReportResult{
+		Document: &apiv1.Document{
+			Name:    exportName(period, rng, format),
+			Content: content,
+		},
+	}, nil
+}
+
+// exportRows converts expenses to rows in the order they are made, dates are in the location.
+// Expenses typed in the base currency before original amounts were kept have the base amount as the original one.
+func exportRows(expenses []user.ExpenseRecord, baseCurrency string, loc *time.Location) []exportRow {
+	sorted := append([]user.ExpenseRecord(nil), expenses...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Created.Before(sorted[j].Created)
+	})
+
+	rows := make([]exportRow, 0, len(sorted))
+	for _, exp := range sorted {
+		row := exportRow{
+			Date:           exp.Created.In(loc).Format(exportDateLayout),
+			Category:       exp.Category,
+			BaseAmount:     exp.Amount,
+			OriginalAmount: exp.OriginalAmount,
+			Currency:       exp.Currency,
+		}
+		if row.Currency == "" {
+			row.OriginalAmount, row.Currency = exp.Amount, baseCurrency
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func encodeCSV(rows []exportRow) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		err := w.Write([]string{
+			row.Date,
+			row.Category,
+			row.BaseAmount.String(),
+			row.OriginalAmount.String(),
+			row.Currency,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// exportName names the document after the period, like expenses-month.csv or expenses-2023-01-01_2023-01-31.json.
+func exportName(period string, rng Range, format string) string {
+	parts := []string{exportFileName}
+	_, named := reportFilters[period]
+	switch {
+	case named && period != "":
+		parts = append(parts, period)
+	case !rng.From.IsZero() && !rng.To.IsZero():
+		// the end of the range is exclusive
+		parts = append(parts, rng.From.Format(exportDateLayout)+"_"+rng.To.AddDate(0, 0, -1).Format(exportDateLayout))
+	}
+	return strings.Join(parts, "-") + "." + format
+}
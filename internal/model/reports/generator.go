@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -11,22 +12,16 @@ import (
 
 	apiv1 "max.ks1230/finances-bot/api/grpc"
 
-	"github.com/jinzhu/now"
 	"github.com/pkg/errors"
 	"max.ks1230/finances-bot/internal/entity/currency"
+	"max.ks1230/finances-bot/internal/entity/money"
 
 	"max.ks1230/finances-bot/internal/entity/user"
 )
 
-var reportFilters = map[string]time.Time{
-	"":      {},
-	"week":  now.BeginningOfWeek(),
-	"month": now.BeginningOfMonth(),
-	"year":  now.BeginningOfYear(),
-}
-
 type expensesStorage interface {
 	GetUserExpenses(ctx context.Context, userID int64) ([]user.ExpenseRecord, error)
+	GetUserIncomes(ctx context.Context, userID int64) ([]user.IncomeRecord, error)
 	GetUserByID(ctx context.Context, userID int64) (user.Record, error)
 	GetRate(ctx context.Context, name string) (currency.Rate, error)
 }
@@ -34,35 +29,58 @@ type expensesStorage interface {
 type Generator struct {
 	storage         expensesStorage
 	defaultCurrency string
+	location        *time.Location
+	weekStart       time.Weekday
+	clock           func() time.Time
 }
 
 type config interface {
 	BaseCurrency() string
+	Location() *time.Location
+	WeekStartDay() time.Weekday
 }
 
 func NewGenerator(config config, storage expensesStorage) *Generator {
 	return &Generator{
 		storage:         storage,
 		defaultCurrency: config.BaseCurrency(),
+		location:        config.Location(),
+		weekStart:       config.WeekStartDay(),
+		clock:           time.Now,
 	}
 }
 
-func (g *Generator) GenerateReport(ctx context.Context, userID int64, period string) (report *apiv1.ReportResult, err error) {
+// noAccountKey groups records not bound to any account.
+const noAccountKey = "no account"
+
+// Filter narrows down report records and chooses how they are grouped.
+// Zero filter reports all records grouped by categories.
+type Filter struct {
+	// Account keeps the records of the account only, its name is matched regardless of case
+	Account string
+	// ByAccount groups records by accounts instead of categories and sources
+	ByAccount bool
+	// Tag keeps the tagged expenses only, incomes are not tagged so they are left out
+	Tag string
+	// Category keeps the expenses of the category and its subcategories only, incomes are left out as well
+	Category string
+}
+
+// GenerateReport generates report of user expenses and incomes within the range.
+// If the range is zero, it is resolved from the named period.
+func (g *Generator) GenerateReport(ctx context.Context, userID int64, period string, rng Range,
+	filter Filter) (report *apiv1.ReportResult, err error) {
 	logger.Info("GenerateReport - start", zap.Int64("userID", userID), zap.String("period", period))
 	defer logger.Info("GenerateReport - end")
 
 	defer func() {
-		if report == nil {
-			report = &apiv1.ReportResult{}
-		}
-		if err == nil {
-			report.Status = &apiv1.OperationStatus{Success: true}
-		} else {
-			errMsg := err.Error()
-			report.Status = &apiv1.OperationStatus{Success: false, Error: &errMsg}
-		}
+		report = withStatus(report, err)
 		report.UserID = userID
 		report.Period = period
+		report.Account = filter.Account
+		report.ByAccount = filter.ByAccount
+		report.Tag = filter.Tag
+		report.Category = filter.Category
 	}()
 
 	userRec, err := g.storage.GetUserByID(ctx, userID)
@@ -74,72 +92,281 @@ func (g *Generator) GenerateReport(ctx context.Context, userID int64, period str
 	if err != nil {
 		return nil, errors.Wrap(err, "generate report")
 	}
-	if len(expenses) == 0 {
+	incomes, err := g.storage.GetUserIncomes(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate report")
+	}
+	if len(expenses) == 0 && len(incomes) == 0 {
 		return nil, nil
 	}
 
-	filter, ok := reportFilters[period]
-	if !ok {
-		return nil, errors.Wrap(
-			fmt.Errorf("report period %s is not supported", period),
-			"generate report",
-		)
+	rng, err = g.resolveRange(userRec, period, rng)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate report")
+	}
+	expenses = filterExpensesWithin(expenses, rng)
+	incomes = filterIncomesWithin(incomes, rng)
+	if filter.Account != "" {
+		expenses = filterExpensesOf(expenses, filter.Account)
+		incomes = filterIncomesOf(incomes, filter.Account)
+	}
+	if filter.Tag != "" {
+		expenses = filterExpensesTagged(expenses, filter.Tag)
+		incomes = nil
+	}
+	if filter.Category != "" {
+		expenses = filterExpensesWithinCategory(expenses, filter.Category)
+		incomes = nil
 	}
-	expenses = filterExpensesAfter(expenses, filter)
 
-	rate, err := g.storage.GetRate(ctx, userRec.PreferredCurrencyOrDefault(g.defaultCurrency))
+	curr := userRec.PreferredCurrencyOrDefault(g.defaultCurrency)
+	rate, err := g.storage.GetRate(ctx, curr)
 	if err != nil {
 		return nil, errors.Wrap(err, "generate report")
 	}
-	expenses = convertExpensesFromBase(expenses, rate.BaseRate)
+	expenses = convertExpensesFromBase(expenses, curr, rate.BaseRate)
+	incomes = convertIncomesFromBase(incomes, curr, rate.BaseRate)
 
-	report = groupExpenses(expenses)
+	expenseKey, incomeKey := expenseCategory, incomeSource
+	if filter.ByAccount {
+		expenseKey, incomeKey = expenseAccount, incomeAccount
+	}
+	report = groupExpenses(expenses, expenseKey)
+	if !filter.ByAccount {
+		report.Records = categoryTree(report.Records)
+	}
+	report.Incomes, report.TotalIncome = groupIncomes(incomes, incomeKey)
+	report.Currency = curr
 	return report, nil
 }
 
-func filterExpensesAfter(exps []user.ExpenseRecord, after time.Time) []user.ExpenseRecord {
+// withStatus returns the result, empty one if there is none, with the status of its generation.
+func withStatus(report *apiv1.ReportResult, err error) *apiv1.ReportResult {
+	if report == nil {
+		report = &apiv1.ReportResult{}
+	}
+	if err == nil {
+		report.Status = &apiv1.OperationStatus{Success: true}
+	} else {
+		errMsg := err.Error()
+		report.Status = &apiv1.OperationStatus{Success: false, Error: &errMsg}
+	}
+	return report
+}
+
+// resolveRange resolves the named period in user's timezone unless the range is given.
+func (g *Generator) resolveRange(userRec user.Record, period string, rng Range) (Range, error) {
+	if !rng.IsZero() {
+		return rng, nil
+	}
+	// period boundaries depend on the request time, so they are resolved for every report
+	rng, ok := ResolvePeriod(period, g.clock().In(userRec.LocationOrDefault(g.location)), g.weekStart)
+	if !ok {
+		return Range{}, fmt.Errorf("report period %s is not supported", period)
+	}
+	return rng, nil
+}
+
+func filterExpensesWithin(exps []user.ExpenseRecord, rng Range) []user.ExpenseRecord {
+	res := make([]user.ExpenseRecord, 0, len(exps))
+	for _, exp := range exps {
+		if rng.Contains(exp.Created) {
+			res = append(res, exp)
+		}
+	}
+	return res
+}
+
+func filterExpensesOf(exps []user.ExpenseRecord, account string) []user.ExpenseRecord {
+	res := make([]user.ExpenseRecord, 0, len(exps))
+	for _, exp := range exps {
+		if strings.EqualFold(exp.Account, account) {
+			res = append(res, exp)
+		}
+	}
+	return res
+}
+
+func filterExpensesTagged(exps []user.ExpenseRecord, tag string) []user.ExpenseRecord {
+	res := make([]user.ExpenseRecord, 0, len(exps))
+	for _, exp := range exps {
+		if exp.HasTag(tag) {
+			res = append(res, exp)
+		}
+	}
+	return res
+}
+
+func filterExpensesWithinCategory(exps []user.ExpenseRecord, category string) []user.ExpenseRecord {
 	res := make([]user.ExpenseRecord, 0, len(exps))
 	for _, exp := range exps {
-		if after.Before(exp.Created) {
+		if user.IsWithinCategory(exp.Category, category) {
 			res = append(res, exp)
 		}
 	}
 	return res
 }
 
-func convertExpensesFromBase(expenses []user.ExpenseRecord, rate float64) (result []user.ExpenseRecord) {
+func filterIncomesOf(incomes []user.IncomeRecord, account string) []user.IncomeRecord {
+	res := make([]user.IncomeRecord, 0, len(incomes))
+	for _, inc := range incomes {
+		if strings.EqualFold(inc.Account, account) {
+			res = append(res, inc)
+		}
+	}
+	return res
+}
+
+func expenseCategory(exp user.ExpenseRecord) string {
+	return exp.Category
+}
+
+func expenseAccount(exp user.ExpenseRecord) string {
+	if exp.Account == "" {
+		return noAccountKey
+	}
+	return exp.Account
+}
+
+func incomeSource(inc user.IncomeRecord) string {
+	return inc.Source
+}
+
+func incomeAccount(inc user.IncomeRecord) string {
+	if inc.Account == "" {
+		return noAccountKey
+	}
+	return inc.Account
+}
+
+func filterIncomesWithin(incomes []user.IncomeRecord, rng Range) []user.IncomeRecord {
+	res := make([]user.IncomeRecord, 0, len(incomes))
+	for _, inc := range incomes {
+		if rng.Contains(inc.Created) {
+			res = append(res, inc)
+		}
+	}
+	return res
+}
+
+// convertExpensesFromBase converts expenses to the currency, the ones typed in it keep their original amounts.
+func convertExpensesFromBase(expenses []user.ExpenseRecord, curr string, rate float64) (result []user.ExpenseRecord) {
 	result = make([]user.ExpenseRecord, 0, len(expenses))
 	for _, exp := range expenses {
-		exp.Amount *= rate
+		exp.Amount = exp.AmountIn(curr, rate)
 		result = append(result, exp)
 	}
 	return
 }
 
-func groupExpenses(exps []user.ExpenseRecord) *apiv1.ReportResult {
-	m := make(map[string]float64)
+// groupExpenses groups expenses by the key, categories or accounts, amounts are passed in minor units.
+func groupExpenses(exps []user.ExpenseRecord, key func(user.ExpenseRecord) string) *apiv1.ReportResult {
+	m := make(map[string]money.Amount)
 	for _, exp := range exps {
-		m[exp.Category] += exp.Amount
+		m[key(exp)] += exp.Amount
 	}
 	records := make([]*apiv1.ReportRecord, 0, len(m))
-	total := 0.0
+	var total money.Amount
 	for cat, am := range m {
-		records = append(records, &apiv1.ReportRecord{Category: cat, Amount: am})
+		records = append(records, &apiv1.ReportRecord{Category: cat, Amount: int64(am)})
 		total += am
 	}
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].Amount > records[j].Amount
-	})
+	sortRecords(records)
 	return &apiv1.ReportResult{
 		Records:     records,
-		TotalAmount: total,
+		TotalAmount: int64(total),
+	}
+}
+
+// convertIncomesFromBase converts incomes to the currency the same way as expenses.
+func convertIncomesFromBase(incomes []user.IncomeRecord, curr string, rate float64) (result []user.IncomeRecord) {
+	result = make([]user.IncomeRecord, 0, len(incomes))
+	for _, inc := range incomes {
+		inc.Amount = inc.AmountIn(curr, rate)
+		result = append(result, inc)
 	}
+	return
 }
 
-func ReportPeriods() []string {
-	res := make([]string, 0, len(reportFilters))
-	for k := range reportFilters {
-		res = append(res, k)
+// groupIncomes groups incomes by the key, sources or accounts, the records reuse category field for it.
+func groupIncomes(incomes []user.IncomeRecord, key func(user.IncomeRecord) string) ([]*apiv1.ReportRecord, int64) {
+	m := make(map[string]money.Amount)
+	for _, inc := range incomes {
+		m[key(inc)] += inc.Amount
+	}
+	records := make([]*apiv1.ReportRecord, 0, len(m))
+	var total money.Amount
+	for src, am := range m {
+		records = append(records, &apiv1.ReportRecord{Category: src, Amount: int64(am)})
+		total += am
 	}
+	sortRecords(records)
+	return records, int64(total)
+}
+
+// categoryNode is a category of the report tree, its record amount includes the ones of subcategories.
+type categoryNode struct {
+	record   *apiv1.ReportRecord
+	children map[string]*categoryNode
+}
+
+func newCategoryNode(name string) *categoryNode {
+	return &categoryNode{
+		record:   &apiv1.ReportRecord{Category: name},
+		children: make(map[string]*categoryNode),
+	}
+}
+
+// categoryTree rolls records of category paths, like food/groceries and food/restaurants, up into their parents.
+// The records become the top categories with subcategories as their children, parts are matched regardless of case.
+func categoryTree(records []*apiv1.ReportRecord) []*apiv1.ReportRecord {
+	// the spelling of the first path in order names a category differing in case
+	sorted := append([]*apiv1.ReportRecord(nil), records...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetCategory() < sorted[j].GetCategory()
+	})
+
+	root := newCategoryNode("")
+	for _, rec := range sorted {
+		path := user.CategoryPath(rec.GetCategory())
+		if len(path) == 0 {
+			path = []string{rec.GetCategory()}
+		}
+		node := root
+		for _, part := range path {
+			key := strings.ToLower(part)
+			child, ok := node.children[key]
+			if !ok {
+				child = newCategoryNode(part)
+				node.children[key] = child
+			}
+			child.record.Amount += rec.GetAmount()
+			node = child
+		}
+	}
+	return root.records()
+}
+
+// records returns the records of subcategories, each with its own subcategories.
+func (n *categoryNode) records() []*apiv1.ReportRecord {
+	if len(n.children) == 0 {
+		return nil
+	}
+	res := make([]*apiv1.ReportRecord, 0, len(n.children))
+	for _, child := range n.children {
+		child.record.Children = child.records()
+		res = append(res, child.record)
+	}
+	sortRecords(res)
 	return res
 }
+
+// sortRecords sorts records by amount, the largest first.
+func sortRecords(records []*apiv1.ReportRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].GetAmount() != records[j].GetAmount() {
+			return records[i].GetAmount() > records[j].GetAmount()
+		}
+		return records[i].GetCategory() < records[j].GetCategory()
+	})
+}
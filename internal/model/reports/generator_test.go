@@ -2,6 +2,7 @@ package reports
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -20,6 +21,8 @@ func Test_OnGenerateReport_ShouldReturnReportInUSD(t *testing.T) {
 	storage := mock.NewExpensesStorageMock(m)
 
 	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
 
 	u := user.Record{}
 	u.SetPreferredCurrency("USD")
@@ -30,21 +33,23 @@ func Test_OnGenerateReport_ShouldReturnReportInUSD(t *testing.T) {
 		}).
 		Return([]user.ExpenseRecord{
 			{
-				Amount:   1000,
+				Amount:   10000000,
 				Category: "Internet",
 				Created:  time.Now(),
 			},
 			{
-				Amount:   1500,
+				Amount:   15000000,
 				Category: "Shopping",
 				Created:  time.Now(),
 			},
 			{
-				Amount:   100,
+				Amount:   1000000,
 				Category: "Shopping",
 				Created:  time.Now(),
 			},
 		}, nil).
+		GetUserIncomesMock.
+		Return(nil, nil).
 		GetUserByIDMock.
 		Inspect(func(_ context.Context, userID int64) {
 			assert.Equal(m, int64(123), userID)
@@ -57,14 +62,15 @@ func Test_OnGenerateReport_ShouldReturnReportInUSD(t *testing.T) {
 		Return(currency.Rate{BaseRate: 0.1}, nil)
 
 	generator := NewGenerator(cfg, storage)
-	report, err := generator.GenerateReport(ctx, 123, "")
+	report, err := generator.GenerateReport(ctx, 123, "", Range{}, Filter{})
 	assert.NoError(m, err)
 	assert.Equal(m, true, report.GetStatus().GetSuccess())
-	assert.Equal(m, 260.0, report.GetTotalAmount())
+	assert.Equal(m, "USD", report.GetCurrency())
+	assert.Equal(m, int64(2600000), report.GetTotalAmount())
 	assert.Equal(m, "Shopping", report.GetRecords()[0].GetCategory())
-	assert.Equal(m, 160.0, report.GetRecords()[0].GetAmount())
+	assert.Equal(m, int64(1600000), report.GetRecords()[0].GetAmount())
 	assert.Equal(m, "Internet", report.GetRecords()[1].GetCategory())
-	assert.Equal(m, 100.0, report.GetRecords()[1].GetAmount())
+	assert.Equal(m, int64(1000000), report.GetRecords()[1].GetAmount())
 }
 
 func Test_OnGenerateReport_ShouldReturnReportInRUB(t *testing.T) {
@@ -75,6 +81,8 @@ func Test_OnGenerateReport_ShouldReturnReportInRUB(t *testing.T) {
 	storage := mock.NewExpensesStorageMock(m)
 
 	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
 
 	u := user.Record{}
 	storage.
@@ -84,21 +92,23 @@ func Test_OnGenerateReport_ShouldReturnReportInRUB(t *testing.T) {
 		}).
 		Return([]user.ExpenseRecord{
 			{
-				Amount:   1000,
+				Amount:   10000000,
 				Category: "Internet",
 				Created:  time.Now(),
 			},
 			{
-				Amount:   1500,
+				Amount:   15000000,
 				Category: "Shopping",
 				Created:  time.Now(),
 			},
 			{
-				Amount:   100,
+				Amount:   1000000,
 				Category: "Shopping",
 				Created:  time.Now(),
 			},
 		}, nil).
+		GetUserIncomesMock.
+		Return(nil, nil).
 		GetUserByIDMock.
 		Inspect(func(_ context.Context, userID int64) {
 			assert.Equal(m, int64(123), userID)
@@ -111,12 +121,437 @@ func Test_OnGenerateReport_ShouldReturnReportInRUB(t *testing.T) {
 		Return(currency.Rate{BaseRate: 1}, nil)
 
 	generator := NewGenerator(cfg, storage)
-	report, err := generator.GenerateReport(ctx, 123, "")
+	report, err := generator.GenerateReport(ctx, 123, "", Range{}, Filter{})
 	assert.NoError(m, err)
 	assert.Equal(m, true, report.GetStatus().GetSuccess())
-	assert.Equal(m, 2600.0, report.GetTotalAmount())
+	assert.Equal(m, int64(26000000), report.GetTotalAmount())
 	assert.Equal(m, "Shopping", report.GetRecords()[0].GetCategory())
-	assert.Equal(m, 1600.0, report.GetRecords()[0].GetAmount())
+	assert.Equal(m, int64(16000000), report.GetRecords()[0].GetAmount())
 	assert.Equal(m, "Internet", report.GetRecords()[1].GetCategory())
-	assert.Equal(m, 1000.0, report.GetRecords()[1].GetAmount())
+	assert.Equal(m, int64(10000000), report.GetRecords()[1].GetAmount())
+}
+
+func Test_OnGenerateReport_ShouldFilterByRange(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	from := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 9, 16, 0, 0, 0, 0, time.UTC)
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{
+				Amount:   10000000,
+				Category: "Internet",
+				Created:  from.Add(-time.Second),
+			},
+			{
+				Amount:   15000000,
+				Category: "Shopping",
+				Created:  from,
+			},
+			{
+				Amount:   1000000,
+				Category: "Shopping",
+				Created:  to.Add(-time.Second),
+			},
+			{
+				Amount:   2000000,
+				Category: "Taxi",
+				Created:  to,
+			},
+		}, nil).
+		GetUserIncomesMock.
+		Return(nil, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	report, err := generator.GenerateReport(ctx, 123, "01.09.2022-15.09.2022", Range{From: from, To: to}, Filter{})
+	assert.NoError(m, err)
+	assert.Equal(m, true, report.GetStatus().GetSuccess())
+	assert.Equal(m, int64(16000000), report.GetTotalAmount())
+	assert.Equal(m, 1, len(report.GetRecords()))
+	assert.Equal(m, "Shopping", report.GetRecords()[0].GetCategory())
+}
+
+func Test_OnGenerateReport_ShouldResolvePeriodAtRequestTime(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	loc := time.FixedZone("UTC+10", 10*60*60)
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(loc)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{
+				Amount:   10000000,
+				Category: "Internet",
+				// Sunday, previous week in UTC+10
+				Created: time.Date(2022, 9, 4, 13, 0, 0, 0, time.UTC),
+			},
+			{
+				Amount:   15000000,
+				Category: "Shopping",
+				// Monday, current week in UTC+10 while still Sunday in UTC
+				Created: time.Date(2022, 9, 4, 14, 0, 0, 0, time.UTC),
+			},
+		}, nil).
+		GetUserIncomesMock.
+		Return(nil, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	generator.clock = func() time.Time {
+		return time.Date(2022, 9, 5, 12, 0, 0, 0, loc)
+	}
+	report, err := generator.GenerateReport(ctx, 123, "week", Range{}, Filter{})
+	assert.NoError(m, err)
+	assert.Equal(m, int64(15000000), report.GetTotalAmount())
+
+	// a week later the same generator resolves the next week
+	generator.clock = func() time.Time {
+		return time.Date(2022, 9, 12, 12, 0, 0, 0, loc)
+	}
+	report, err = generator.GenerateReport(ctx, 123, "week", Range{}, Filter{})
+	assert.NoError(m, err)
+	assert.Equal(m, int64(0), report.GetTotalAmount())
+}
+
+func Test_OnGenerateReport_ShouldIncludeIncomes(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	storage.
+		GetUserExpensesMock.
+		Return(nil, nil).
+		GetUserIncomesMock.
+		Return([]user.IncomeRecord{
+			{
+				Amount:  500000000,
+				Source:  "Salary",
+				Created: time.Now(),
+			},
+			{
+				Amount:  50000000,
+				Source:  "Freelance",
+				Created: time.Now(),
+			},
+			{
+				Amount:  100000000,
+				Source:  "Salary",
+				Created: time.Now(),
+			},
+		}, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 0.1}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	report, err := generator.GenerateReport(ctx, 123, "", Range{}, Filter{})
+	assert.NoError(m, err)
+	assert.Equal(m, true, report.GetStatus().GetSuccess())
+	assert.Equal(m, 0, len(report.GetRecords()))
+	assert.Equal(m, int64(65000000), report.GetTotalIncome())
+	assert.Equal(m, "Salary", report.GetIncomes()[0].GetCategory())
+	assert.Equal(m, int64(60000000), report.GetIncomes()[0].GetAmount())
+	assert.Equal(m, "Freelance", report.GetIncomes()[1].GetCategory())
+}
+
+func Test_OnGenerateReport_ShouldKeepOriginalAmountsInTheirCurrency(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	u := user.Record{}
+	u.SetPreferredCurrency("USD")
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{
+				// typed as 10 USD a year ago, when the rate was 0.02
+				Amount:         5000000,
+				Category:       "Internet",
+				Created:        time.Now(),
+				OriginalAmount: 100000,
+				Currency:       "USD",
+				Rate:           0.02,
+			},
+			{
+				Amount:         10000000,
+				Category:       "Shopping",
+				Created:        time.Now(),
+				OriginalAmount: 10000000,
+				Currency:       "RUB",
+				Rate:           1,
+			},
+		}, nil).
+		GetUserIncomesMock.
+		Return(nil, nil).
+		GetUserByIDMock.
+		Return(u, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 0.01}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	report, err := generator.GenerateReport(ctx, 123, "", Range{}, Filter{})
+	assert.NoError(m, err)
+	assert.Equal(m, int64(200000), report.GetTotalAmount())
+	assert.Equal(m, "Internet", report.GetRecords()[0].GetCategory())
+	assert.Equal(m, int64(100000), report.GetRecords()[0].GetAmount())
+}
+
+func Test_OnGenerateReport_ShouldFilterAndGroupByAccount(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{Amount: 10000000, Category: "Internet", Created: time.Now(), AccountID: 1, Account: "card"},
+			{Amount: 2000000, Category: "Taxi", Created: time.Now(), AccountID: 2, Account: "cash"},
+			{Amount: 500000, Category: "Taxi", Created: time.Now()},
+		}, nil).
+		GetUserIncomesMock.
+		Return(nil, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	generator := NewGenerator(cfg, storage)
+
+	report, err := generator.GenerateReport(ctx, 123, "", Range{}, Filter{Account: "Card"})
+	assert.NoError(m, err)
+	assert.Equal(m, "Card", report.GetAccount())
+	assert.Equal(m, int64(10000000), report.GetTotalAmount())
+	assert.Len(m, report.GetRecords(), 1)
+	assert.Equal(m, "Internet", report.GetRecords()[0].GetCategory())
+
+	report, err = generator.GenerateReport(ctx, 123, "", Range{}, Filter{ByAccount: true})
+	assert.NoError(m, err)
+	assert.True(m, report.GetByAccount())
+	assert.Equal(m, int64(12500000), report.GetTotalAmount())
+	assert.Equal(m, "card", report.GetRecords()[0].GetCategory())
+	assert.Equal(m, "cash", report.GetRecords()[1].GetCategory())
+	assert.Equal(m, "no account", report.GetRecords()[2].GetCategory())
+}
+
+func Test_OnGenerateReport_ShouldFilterByTag(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{Amount: 10000000, Category: "Hotel", Created: time.Now(), Tags: []string{"vacation"}},
+			{Amount: 2000000, Category: "Food", Created: time.Now(), Tags: []string{"rome", "vacation"}},
+			{Amount: 500000, Category: "Food", Created: time.Now()},
+		}, nil).
+		GetUserIncomesMock.
+		Return([]user.IncomeRecord{{Amount: 50000000, Source: "Salary", Created: time.Now()}}, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	report, err := generator.GenerateReport(ctx, 123, "", Range{}, Filter{Tag: "vacation"})
+	assert.NoError(m, err)
+	assert.Equal(m, "vacation", report.GetTag())
+	assert.Equal(m, int64(12000000), report.GetTotalAmount())
+	assert.Len(m, report.GetRecords(), 2)
+	assert.Empty(m, report.GetIncomes())
+}
+
+func Test_OnGenerateReport_ShouldRollUpSubcategories(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{Amount: 3000000, Category: "Food/Groceries", Created: time.Now()},
+			{Amount: 2000000, Category: "food/restaurants", Created: time.Now()},
+			{Amount: 500000, Category: "Food", Created: time.Now()},
+			{Amount: 4000000, Category: "Internet", Created: time.Now()},
+		}, nil).
+		GetUserIncomesMock.
+		Return(nil, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	report, err := generator.GenerateReport(ctx, 123, "", Range{}, Filter{})
+	assert.NoError(m, err)
+	assert.Equal(m, int64(9500000), report.GetTotalAmount())
+
+	records := report.GetRecords()
+	assert.Len(m, records, 2)
+	assert.Equal(m, "Food", records[0].GetCategory())
+	assert.Equal(m, int64(5500000), records[0].GetAmount())
+	assert.Equal(m, "Internet", records[1].GetCategory())
+	assert.Empty(m, records[1].GetChildren())
+
+	children := records[0].GetChildren()
+	assert.Len(m, children, 2)
+	assert.Equal(m, "Groceries", children[0].GetCategory())
+	assert.Equal(m, int64(3000000), children[0].GetAmount())
+	assert.Equal(m, "restaurants", children[1].GetCategory())
+	assert.Equal(m, int64(2000000), children[1].GetAmount())
+}
+
+func Test_OnGenerateReport_ShouldDrillDownIntoCategory(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{Amount: 3000000, Category: "food/groceries", Created: time.Now()},
+			{Amount: 2000000, Category: "food/restaurants", Created: time.Now()},
+			{Amount: 4000000, Category: "foodtrucks", Created: time.Now()},
+		}, nil).
+		GetUserIncomesMock.
+		Return([]user.IncomeRecord{{Amount: 50000000, Source: "Salary", Created: time.Now()}}, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil).
+		GetRateMock.
+		Return(currency.Rate{BaseRate: 1}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	report, err := generator.GenerateReport(ctx, 123, "", Range{}, Filter{Category: "Food"})
+	assert.NoError(m, err)
+	assert.Equal(m, "Food", report.GetCategory())
+	assert.Equal(m, int64(5000000), report.GetTotalAmount())
+	assert.Len(m, report.GetRecords(), 1)
+	assert.Len(m, report.GetRecords()[0].GetChildren(), 2)
+	assert.Empty(m, report.GetIncomes())
+}
+
+func Test_OnGenerateExport_ShouldWriteCSVRowsInOrder(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{Amount: 65000000, Category: "Hotel, Rome", Created: time.Date(2023, 1, 20, 10, 0, 0, 0, time.UTC),
+				OriginalAmount: 1000000, Currency: "USD", Rate: 0.0154},
+			{Amount: 5000000, Category: "Internet", Created: time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC),
+				OriginalAmount: 5000000, Currency: "RUB", Rate: 1},
+			{Amount: 2000000, Category: "Food", Created: time.Date(2023, 1, 1, 23, 30, 0, 0, time.UTC)},
+			{Amount: 3000000, Category: "Food", Created: time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC)},
+		}, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	rng := Range{From: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)}
+	report, err := generator.GenerateExport(ctx, 123, "01.01.2023-31.01.2023", rng, FormatCSV)
+	assert.NoError(m, err)
+	assert.Equal(m, "csv", report.GetFormat())
+	assert.Equal(m, "expenses-2023-01-01_2023-01-31.csv", report.GetDocument().GetName())
+	assert.Equal(m, "date,category,base_amount,original_amount,currency\n"+
+		"2023-01-01,Food,200.00,200.00,RUB\n"+
+		"2023-01-02,Internet,500.00,500.00,RUB\n"+
+		"2023-01-20,\"Hotel, Rome\",6500.00,100.00,USD\n",
+		string(report.GetDocument().GetContent()))
+}
+
+func Test_OnGenerateExport_ShouldWriteJSONRows(t *testing.T) {
+	ctx := context.Background()
+
+	m := minimock.NewController(t)
+	cfg := mock.NewConfigMock(m)
+	storage := mock.NewExpensesStorageMock(m)
+
+	cfg.BaseCurrencyMock.Return("RUB")
+	cfg.LocationMock.Return(time.UTC)
+	cfg.WeekStartDayMock.Return(time.Monday)
+
+	storage.
+		GetUserExpensesMock.
+		Return([]user.ExpenseRecord{
+			{Amount: 65000000, Category: "Hotel", Created: time.Now(), OriginalAmount: 1000000, Currency: "USD"},
+		}, nil).
+		GetUserByIDMock.
+		Return(user.Record{}, nil)
+
+	generator := NewGenerator(cfg, storage)
+	report, err := generator.GenerateExport(ctx, 123, "month", Range{}, FormatJSON)
+	assert.NoError(m, err)
+	assert.Equal(m, "expenses-month.json", report.GetDocument().GetName())
+	assert.JSONEq(m, fmt.Sprintf(`[{"date": %q, "category": "Hotel", "baseAmount": 6500.00,
+		"originalAmount": 100.00, "currency": "USD"}]`, time.Now().UTC().Format("2006-01-02")),
+		string(report.GetDocument().GetContent()))
 }
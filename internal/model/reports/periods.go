@@ -0,0 +1,66 @@
+package reports
+
+import (
+	"time"
+
+	"github.com/jinzhu/now"
+)
+
+// Range bounds report expenses: From is inclusive, To is exclusive.
+// Zero values do not bound.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+func (r Range) IsZero() bool {
+	return r.From.IsZero() && r.To.IsZero()
+}
+
+func (r Range) Contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// reportFilters resolve named report periods relative to the given moment
+var reportFilters = map[string]func(n *now.Now) Range{
+	"": func(*now.Now) Range {
+		return Range{}
+	},
+	"week": func(n *now.Now) Range {
+		return Range{From: n.BeginningOfWeek()}
+	},
+	"month": func(n *now.Now) Range {
+		return Range{From: n.BeginningOfMonth()}
+	},
+	"year": func(n *now.Now) Range {
+		return Range{From: n.BeginningOfYear()}
+	},
+	"last-week": func(n *now.Now) Range {
+		begin := n.BeginningOfWeek()
+		return Range{From: begin.AddDate(0, 0, -7), To: begin}
+	},
+	"last-month": func(n *now.Now) Range {
+		begin := n.BeginningOfMonth()
+		return Range{From: begin.AddDate(0, -1, 0), To: begin}
+	},
+}
+
+// ResolvePeriod resolves the named report period relative to the given moment.
+// Boundaries are computed in the location of that moment, so it should be
+// converted to the user's timezone beforehand.
+func ResolvePeriod(period string, at time.Time, weekStart time.Weekday) (Range, bool) {
+	filter, ok := reportFilters[period]
+	if !ok {
+		return Range{}, false
+	}
+	cfg := &now.Config{WeekStartDay: weekStart, TimeLocation: at.Location()}
+	return filter(cfg.With(at)), true
+}
+
+func ReportPeriods() []string {
+	res := make([]string, 0, len(reportFilters))
+	for k := range reportFilters {
+		res = append(res, k)
+	}
+	return res
+}
@@ -0,0 +1,42 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnResolvePeriod_ShouldRespectWeekStartDay(t *testing.T) {
+	// Wednesday
+	at := time.Date(2022, 9, 7, 15, 30, 0, 0, time.UTC)
+
+	rng, ok := ResolvePeriod("week", at, time.Monday)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC), rng.From)
+	assert.True(t, rng.To.IsZero())
+
+	rng, ok = ResolvePeriod("week", at, time.Sunday)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2022, 9, 4, 0, 0, 0, 0, time.UTC), rng.From)
+}
+
+func Test_OnResolvePeriod_ShouldUseLocationOfMoment(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	// still August 31st in UTC-5
+	at := time.Date(2022, 9, 1, 2, 0, 0, 0, time.UTC).In(loc)
+
+	rng, ok := ResolvePeriod("month", at, time.Monday)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2022, 8, 1, 0, 0, 0, 0, loc), rng.From)
+
+	rng, ok = ResolvePeriod("last-month", at, time.Monday)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2022, 7, 1, 0, 0, 0, 0, loc), rng.From)
+	assert.Equal(t, time.Date(2022, 8, 1, 0, 0, 0, 0, loc), rng.To)
+}
+
+func Test_OnResolvePeriod_ShouldRejectUnknownPeriod(t *testing.T) {
+	_, ok := ResolvePeriod("decade", time.Now(), time.Monday)
+	assert.False(t, ok)
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/customerr"
+)
+
+// accountNameColumn selects the name of the account an expense or income is bound to.
+const accountNameColumn = "COALESCE((SELECT a.name FROM accounts a WHERE a.id = account_id), '')"
+
+// accountColumns are selected to be scanned by scanAccount.
+// Operations on an account are typed in its currency, so the balance sums their original amounts.
+// Transfer entries are signed, negative ones are sent from the account and positive ones are received.
+var accountColumns = []string{
+	"id", "name", "currency", "starting_balance", "is_default",
+	"(SELECT COALESCE(sum(original_amount), 0) FROM incomes i WHERE i.account_id = accounts.id)",
+	"(SELECT COALESCE(sum(original_amount), 0) FROM expenses e WHERE e.account_id = accounts.id)",
+	"(SELECT COALESCE(sum(t.amount), 0) FROM transfer_entries t WHERE t.account_id = accounts.id)",
+}
+
+type accountSnapshot struct {
+	ID int64 `json:"id"`
+}
+
+func scanAccount(row scanner) (user.Account, error) {
+	var a user.Account
+	var income, spent, transferred money.Amount
+	err := row.Scan(&a.ID, &a.Name, &a.Currency, &a.StartingBalance, &a.Default, &income, &spent, &transferred)
+	a.Balance = a.StartingBalance + income - spent + transferred
+	return a, err
+}
+
+// nullableID stores zero IDs of optional references as NULL.
+func nullableID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// SaveAccount adds a new account of the user, the first one becomes the default.
+func (s *PostgresStorage) SaveAccount(ctx context.Context, userID int64, acc user.Account) (id int64, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_saveAccount")
+	defer span.Finish()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "save account")
+	}
+	defer rollbackOnError(tx, &err)
+
+	var count int
+	err = psql.Select("count(*)").
+		From("accounts").
+		Where(sq.Eq{"user_id": userID}).
+		RunWith(tx).QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "save account")
+	}
+
+	query := psql.Insert("accounts").
+		Columns("user_id", "name", "currency", "starting_balance", "is_default").
+		Values(userID, acc.Name, acc.Currency, acc.StartingBalance, count == 0).
+		Suffix("ON CONFLICT DO NOTHING RETURNING id")
+	err = query.RunWith(tx).QueryRowContext(ctx).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, &customerr.AlreadyExistsError{Err: fmt.Sprintf("account %s already exists", acc.Name)}
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "save account")
+	}
+
+	err = recordAction(ctx, tx, userID, actionAccountAdded, accountSnapshot{ID: id})
+	if err != nil {
+		return 0, errors.Wrap(err, "save account")
+	}
+	err = tx.Commit()
+	return id, err
+}
+
+// GetAccounts returns all accounts of the user along with their balances.
+func (s *PostgresStorage) GetAccounts(ctx context.Context, userID int64) ([]user.Account, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getAccounts")
+	defer span.Finish()
+
+	query := psql.Select(accountColumns...).
+		From("accounts").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("id")
+
+	rows, err := query.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get accounts")
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	accounts := make([]user.Account, 0)
+	for rows.Next() {
+		var a user.Account
+		a, err = scanAccount(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "get accounts")
+		}
+		accounts = append(accounts, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "get accounts")
+	}
+
+	return accounts, nil
+}
+
+// FindAccount returns the account of the user by its name regardless of case.
+// The default account is returned for an empty name.
+func (s *PostgresStorage) FindAccount(ctx context.Context, userID int64, name string) (user.Account, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_findAccount")
+	defer span.Finish()
+
+	query := psql.Select(accountColumns...).
+		From("accounts").
+		Where(sq.Eq{"user_id": userID})
+	if name == "" {
+		query = query.Where(sq.Eq{"is_default": true})
+	} else {
+		query = query.Where(sq.Eq{"lower(name)": strings.ToLower(name)})
+	}
+
+	acc, err := scanAccount(query.RunWith(s.db).QueryRowContext(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		return user.Account{}, &customerr.NotFoundError{Err: fmt.Sprintf("account %s not found", name)}
+	}
+	if err != nil {
+		return user.Account{}, errors.Wrap(err, "find account")
+	}
+	return acc, nil
+}
+
+// SetDefaultAccount makes the named account the default one of the user.
+func (s *PostgresStorage) SetDefaultAccount(ctx context.Context, userID int64, name string) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_setDefaultAccount")
+	defer span.Finish()
+
+	// a single statement, so there is no moment without the default account
+	res, err := psql.Update("accounts").
+		Set("is_default", sq.Expr("lower(name) = ?", strings.ToLower(name))).
+		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Expr("EXISTS (SELECT 1 FROM accounts d WHERE d.user_id = ? AND lower(d.name) = ?)",
+			userID, strings.ToLower(name))).
+		RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "set default account")
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "set default account")
+	}
+	if updated == 0 {
+		return &customerr.NotFoundError{Err: fmt.Sprintf("account %s not found", name)}
+	}
+	return nil
+}
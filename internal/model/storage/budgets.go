@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jinzhu/now"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"max.ks1230/finances-bot/internal/entity/money"
+)
+
+type budgetSnapshot struct {
+	Category string       `json:"category"`
+	Amount   money.Amount `json:"amount"`
+	Existed  bool         `json:"existed"`
+}
+
+// SaveBudget sets monthly budget of the category, zero amount means no budget.
+func (s *PostgresStorage) SaveBudget(ctx context.Context, userID int64, category string, amount money.Amount) (err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_saveBudget")
+	defer span.Finish()
+
+	query := psql.Insert("budgets").
+		Columns("user_id", "category", "amount", "updated_at").
+		Values(userID, category, amount, time.Now()).
+		Suffix("ON CONFLICT(user_id, category) DO UPDATE SET amount = ?, updated_at = ?", amount, time.Now())
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "save budget")
+	}
+	defer rollbackOnError(tx, &err)
+
+	prev := budgetSnapshot{Category: category, Existed: true}
+	err = psql.Select("amount").
+		From("budgets").
+		Where(sq.Eq{"user_id": userID, "category": category}).
+		Suffix("FOR UPDATE").
+		RunWith(tx).QueryRowContext(ctx).
+		Scan(&prev.Amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		prev.Existed, err = false, nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "save budget")
+	}
+
+	_, err = query.RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "save budget")
+	}
+	if err = registerCategory(ctx, tx, userID, category); err != nil {
+		return errors.Wrap(err, "save budget")
+	}
+	if err = recordAction(ctx, tx, userID, actionBudgetUpdated, prev); err != nil {
+		return errors.Wrap(err, "save budget")
+	}
+	err = tx.Commit()
+	return err
+}
+
+func (s *PostgresStorage) isBudgetMet(ctx context.Context, tx *sql.Tx, userID int64, category string,
+	month *now.Now) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_isBudgetMet")
+	defer span.Finish()
+
+	query := `
+	SELECT COALESCE(sum(e.amount), 0) <= b.amount OR b.amount = 0 AS test FROM budgets b
+	LEFT JOIN expenses e ON e.user_id = b.user_id AND e.category = b.category
+		AND e.created_at >= $3 AND e.created_at <= $4
+	WHERE b.user_id = $1 AND b.category = $2
+	GROUP BY b.amount
+`
+	var test bool
+	err := tx.QueryRowContext(ctx, query,
+		userID, category, month.BeginningOfMonth(), month.EndOfMonth()).
+		Scan(&test)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the category has no budget
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "ensure budget")
+	}
+	return test, nil
+}
+
+func revertBudgetQuery(userID int64, b budgetSnapshot) sq.Sqlizer {
+	if !b.Existed {
+		return psql.Delete("budgets").
+			Where(sq.Eq{"user_id": userID, "category": b.Category})
+	}
+	return psql.Update("budgets").
+		Set("amount", b.Amount).
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"user_id": userID, "category": b.Category})
+}
@@ -0,0 +1,626 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/customerr"
+)
+
+// categoryTables keep category names that are rewritten on renames and merges along with budgets.
+// Their rows are journaled by ids, so the names they had are restored on undo.
+var categoryTables = []string{"expenses", "recurring_expenses"}
+
+type registeredCategory struct {
+	id   int64
+	name string
+}
+
+// categorySnapshot keeps what a rename or a merge has changed, so it can be reverted.
+type categorySnapshot struct {
+	// Renamed are registered categories with the names they had
+	Renamed []categoryNameSnapshot `json:"renamed"`
+	// Deleted are merged categories, their names are added as aliases of the ones they are merged into
+	Deleted      []deletedCategorySnapshot `json:"deleted"`
+	AddedAliases []int64                   `json:"addedAliases"`
+	// RemovedAliases are aliases equal to the new names of categories, by the category ID
+	RemovedAliases []categoryNameSnapshot `json:"removedAliases"`
+
+	Rows    map[string][]categoryNameSnapshot `json:"rows"`
+	Budgets []categoryBudgetSnapshot          `json:"budgets"`
+}
+
+type categoryNameSnapshot struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type deletedCategorySnapshot struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// MovedAliases are aliases of the category moved to the one it is merged into
+	MovedAliases []int64 `json:"movedAliases"`
+}
+
+type categoryBudgetSnapshot struct {
+	Category string       `json:"category"`
+	Amount   money.Amount `json:"amount"`
+	// Renamed is the category the budget is moved to, empty if the budget is dropped
+	Renamed string `json:"renamed"`
+}
+
+// registerCategory adds the category to the registry of the user unless it is there in any case.
+func registerCategory(ctx context.Context, tx *sql.Tx, userID int64, name string) error {
+	_, err := psql.Insert("categories").
+		Columns("user_id", "name").
+		Values(userID, name).
+		Suffix("ON CONFLICT DO NOTHING").
+		RunWith(tx).ExecContext(ctx)
+	return err
+}
+
+func findCategory(ctx context.Context, tx *sql.Tx, userID int64, name string) (registeredCategory, error) {
+	var c registeredCategory
+	err := psql.Select("id", "name").
+		From("categories").
+		Where(sq.Eq{"user_id": userID, "lower(name)": strings.ToLower(name)}).
+		Suffix("FOR UPDATE").
+		RunWith(tx).QueryRowContext(ctx).Scan(&c.id, &c.name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return registeredCategory{}, &customerr.NotFoundError{Err: fmt.Sprintf("category %s not found", name)}
+	}
+	return c, err
+}
+
+// isAlias reports whether the name is an alias of any category of the user other than the given one.
+func isAlias(ctx context.Context, tx *sql.Tx, userID int64, name string, exceptCategoryID int64) (bool, error) {
+	var exists bool
+	err := psql.Select("count(*) > 0").
+		From("category_aliases").
+		Where(sq.Eq{"user_id": userID, "lower(alias)": strings.ToLower(name)}).
+		Where(sq.NotEq{"category_id": exceptCategoryID}).
+		RunWith(tx).QueryRowContext(ctx).Scan(&exists)
+	return exists, err
+}
+
+// ResolveCategory returns the registered name of the category typed in any case or by its alias.
+func (s *PostgresStorage) ResolveCategory(ctx context.Context, userID int64, name string) (string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_resolveCategory")
+	defer span.Finish()
+
+	const query = `
+	SELECT name FROM categories WHERE user_id = $1 AND lower(name) = $2
+	UNION ALL
+	SELECT c.name FROM category_aliases a JOIN categories c ON c.id = a.category_id
+	WHERE a.user_id = $1 AND lower(a.alias) = $2
+	LIMIT 1`
+
+	var resolved string
+	err := s.db.QueryRowContext(ctx, query, userID, strings.ToLower(name)).Scan(&resolved)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", &customerr.NotFoundError{Err: fmt.Sprintf("category %s not found", name)}
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "resolve category")
+	}
+	return resolved, nil
+}
+
+// GetCategories returns registered categories of the user along with their aliases.
+func (s *PostgresStorage) GetCategories(ctx context.Context, userID int64) ([]user.Category, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getCategories")
+	defer span.Finish()
+
+	query := psql.Select("name",
+		"ARRAY(SELECT alias FROM category_aliases a WHERE a.category_id = categories.id ORDER BY lower(alias))").
+		From("categories").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("lower(name)")
+
+	rows, err := query.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get categories")
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	categories := make([]user.Category, 0)
+	for rows.Next() {
+		var c user.Category
+		if err = rows.Scan(&c.Name, (*pq.StringArray)(&c.Aliases)); err != nil {
+			return nil, errors.Wrap(err, "get categories")
+		}
+		categories = append(categories, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "get categories")
+	}
+	return categories, nil
+}
+
+// AliasCategory makes the alias typed instead of the category, an existing alias is moved to it.
+// It returns customerr.AlreadyExistsError if the alias is a category itself.
+func (s *PostgresStorage) AliasCategory(ctx context.Context, userID int64, alias, category string) (err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_aliasCategory")
+	defer span.Finish()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "alias category")
+	}
+	defer rollbackOnError(tx, &err)
+
+	c, err := findCategory(ctx, tx, userID, category)
+	if err != nil {
+		return err
+	}
+	_, err = findCategory(ctx, tx, userID, alias)
+	if err == nil {
+		return &customerr.AlreadyExistsError{Err: fmt.Sprintf("category %s already exists", alias)}
+	}
+	var notFoundErr *customerr.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		return errors.Wrap(err, "alias category")
+	}
+
+	_, err = psql.Insert("category_aliases").
+		Columns("user_id", "category_id", "alias").
+		Values(userID, c.id, alias).
+		Suffix("ON CONFLICT (user_id, lower(alias)) DO UPDATE SET category_id = EXCLUDED.category_id, alias = EXCLUDED.alias").
+		RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "alias category")
+	}
+	err = tx.Commit()
+	return err
+}
+
+// RenameCategory renames the category along with all expenses, budgets and recurring expenses in it.
+// Subcategories are renamed as well keeping their paths, like food/groceries into meals/groceries.
+// It returns customerr.AlreadyExistsError if a new name is taken by another category or alias.
+func (s *PostgresStorage) RenameCategory(ctx context.Context, userID int64, from, to string) (err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_renameCategory")
+	defer span.Finish()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "rename category")
+	}
+	defer rollbackOnError(tx, &err)
+
+	c, err := findCategory(ctx, tx, userID, from)
+	if err != nil {
+		return err
+	}
+	subs, err := subcategories(ctx, tx, userID, c.name)
+	if err != nil {
+		return errors.Wrap(err, "rename category")
+	}
+	// changing the case of the name only is a rename too
+	for _, r := range append([]registeredCategory{c}, subs...) {
+		if err = checkNameFree(ctx, tx, userID, r.id, renamedCategory(r.name, c.name, to)); err != nil {
+			return err
+		}
+	}
+
+	var snapshot categorySnapshot
+	for _, r := range append([]registeredCategory{c}, subs...) {
+		if err = renameRegistered(ctx, tx, userID, r, renamedCategory(r.name, c.name, to), &snapshot); err != nil {
+			return errors.Wrap(err, "rename category")
+		}
+	}
+	if _, err = rewriteCategory(ctx, tx, userID, c.name, to, &snapshot); err != nil {
+		return errors.Wrap(err, "rename category")
+	}
+	if err = recordAction(ctx, tx, userID, actionCategoryRenamed, snapshot); err != nil {
+		return errors.Wrap(err, "rename category")
+	}
+	err = tx.Commit()
+	return err
+}
+
+// MergeCategories moves all expenses, budgets and recurring expenses of a category into another one.
+// The merged category becomes an alias of the one it is merged into, so it is not created again.
+// Subcategories are moved keeping their paths and merged into the ones already there.
+// The budget of a merged category is dropped if the other one has its own.
+// It returns the number of moved expenses.
+func (s *PostgresStorage) MergeCategories(ctx context.Context, userID int64, from, into string) (moved int64, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_mergeCategories")
+	defer span.Finish()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "merge categories")
+	}
+	defer rollbackOnError(tx, &err)
+
+	src, err := findCategory(ctx, tx, userID, from)
+	if err != nil {
+		return 0, err
+	}
+	dst, err := findCategory(ctx, tx, userID, into)
+	if err != nil {
+		return 0, err
+	}
+	if src.id == dst.id || user.IsWithinCategory(dst.name, src.name) {
+		return 0, errors.New("merge category into itself")
+	}
+	subs, err := subcategories(ctx, tx, userID, src.name)
+	if err != nil {
+		return 0, errors.Wrap(err, "merge categories")
+	}
+
+	var snapshot categorySnapshot
+	if err = mergeRegistered(ctx, tx, userID, src, dst, &snapshot); err != nil {
+		return 0, errors.Wrap(err, "merge categories")
+	}
+	for _, sub := range subs {
+		name := renamedCategory(sub.name, src.name, dst.name)
+		target, err := findCategory(ctx, tx, userID, name)
+		var notFoundErr *customerr.NotFoundError
+		switch {
+		case err == nil:
+			err = mergeRegistered(ctx, tx, userID, sub, target, &snapshot)
+		case errors.As(err, &notFoundErr):
+			if err = checkNameFree(ctx, tx, userID, sub.id, name); err != nil {
+				return 0, err
+			}
+			err = renameRegistered(ctx, tx, userID, sub, name, &snapshot)
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "merge categories")
+		}
+	}
+	moved, err = rewriteCategory(ctx, tx, userID, src.name, dst.name, &snapshot)
+	if err != nil {
+		return 0, errors.Wrap(err, "merge categories")
+	}
+	if err = recordAction(ctx, tx, userID, actionCategoriesMerged, snapshot); err != nil {
+		return 0, errors.Wrap(err, "merge categories")
+	}
+
+	err = tx.Commit()
+	return moved, err
+}
+
+// subcategories returns registered subcategories of the category at any depth.
+func subcategories(ctx context.Context, tx *sql.Tx, userID int64, name string) ([]registeredCategory, error) {
+	rows, err := queryCategoryNames(ctx, tx, psql.Select("id", "name").
+		From("categories").
+		Where(sq.Eq{"user_id": userID}).
+		Where(subcategoryMatch("name", name)).
+		Suffix("FOR UPDATE"))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]registeredCategory, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, registeredCategory{id: r.ID, name: r.Name})
+	}
+	return res, nil
+}
+
+// checkNameFree returns customerr.AlreadyExistsError if the name is taken by a category or an alias
+// other than the given category.
+func checkNameFree(ctx context.Context, tx *sql.Tx, userID, categoryID int64, name string) error {
+	other, err := findCategory(ctx, tx, userID, name)
+	if err == nil && other.id != categoryID {
+		return &customerr.AlreadyExistsError{Err: fmt.Sprintf("category %s already exists", name)}
+	}
+	var notFoundErr *customerr.NotFoundError
+	if err != nil && !errors.As(err, &notFoundErr) {
+		return err
+	}
+	taken, err := isAlias(ctx, tx, userID, name, categoryID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return &customerr.AlreadyExistsError{Err: fmt.Sprintf("alias %s already exists", name)}
+	}
+	return nil
+}
+
+// renameRegistered renames the registered category, its alias equal to the new name is useless then and removed.
+func renameRegistered(ctx context.Context, tx *sql.Tx, userID int64, c registeredCategory, name string,
+	snapshot *categorySnapshot) error {
+	_, err := psql.Update("categories").
+		Set("name", name).
+		Where(sq.Eq{"id": c.id}).
+		RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot.Renamed = append(snapshot.Renamed, categoryNameSnapshot{ID: c.id, Name: c.name})
+
+	var removed string
+	err = psql.Delete("category_aliases").
+		Where(sq.Eq{"user_id": userID, "category_id": c.id, "lower(alias)": strings.ToLower(name)}).
+		Suffix("RETURNING alias").
+		RunWith(tx).QueryRowContext(ctx).Scan(&removed)
+	switch {
+	case err == nil:
+		snapshot.RemovedAliases = append(snapshot.RemovedAliases, categoryNameSnapshot{ID: c.id, Name: removed})
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	return nil
+}
+
+// mergeRegistered removes the registered category, its aliases and the name itself become aliases of the other one.
+func mergeRegistered(ctx context.Context, tx *sql.Tx, userID int64, src, dst registeredCategory,
+	snapshot *categorySnapshot) error {
+	moved, err := queryColumn[int64](ctx, tx, psql.Update("category_aliases").
+		Set("category_id", dst.id).
+		Where(sq.Eq{"user_id": userID, "category_id": src.id}).
+		Suffix("RETURNING id"))
+	if err != nil {
+		return err
+	}
+	_, err = psql.Delete("categories").
+		Where(sq.Eq{"id": src.id}).
+		RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot.Deleted = append(snapshot.Deleted, deletedCategorySnapshot{ID: src.id, Name: src.name, MovedAliases: moved})
+
+	added, err := queryColumn[int64](ctx, tx, psql.Insert("category_aliases").
+		Columns("user_id", "category_id", "alias").
+		Values(userID, dst.id, src.name).
+		Suffix("ON CONFLICT DO NOTHING RETURNING id"))
+	if err != nil {
+		return err
+	}
+	snapshot.AddedAliases = append(snapshot.AddedAliases, added...)
+	return nil
+}
+
+// subcategoryMatch matches the column keeping subcategories of the category, like food/groceries of food,
+// regardless of case.
+func subcategoryMatch(column, name string) sq.Sqlizer {
+	prefix := strings.ToLower(name) + user.CategorySeparator
+	return sq.Expr(fmt.Sprintf("left(lower(%s), %d) = ?", column, utf8.RuneCountInString(prefix)), prefix)
+}
+
+// categoryMatch matches the column keeping the category or any of its subcategories regardless of case.
+func categoryMatch(column, name string) sq.Sqlizer {
+	return sq.Or{
+		sq.Eq{fmt.Sprintf("lower(%s)", column): strings.ToLower(name)},
+		subcategoryMatch(column, name),
+	}
+}
+
+// renamedCategory returns the name the category or its subcategory gets when the category is renamed,
+// the path below the category is kept as it is.
+func renamedCategory(name, from, to string) string {
+	path := []rune(name)
+	if n := utf8.RuneCountInString(from); n < len(path) {
+		return to + string(path[n:])
+	}
+	return to
+}
+
+// rewriteCategory renames the category and its subcategories in all tables keeping them,
+// the names are matched regardless of case. A budget is dropped if the new category has its own.
+// The rewritten rows and budgets are added to the snapshot. It returns the number of rewritten expenses.
+func rewriteCategory(ctx context.Context, tx *sql.Tx, userID int64, from, to string,
+	snapshot *categorySnapshot) (int64, error) {
+	if snapshot.Rows == nil {
+		snapshot.Rows = make(map[string][]categoryNameSnapshot, len(categoryTables))
+	}
+
+	var expenses int64
+	for _, table := range categoryTables {
+		rows, err := queryCategoryNames(ctx, tx, psql.Select("id", "category").
+			From(table).
+			Where(sq.Eq{"user_id": userID}).
+			Where(categoryMatch("category", from)).
+			Suffix("FOR UPDATE"))
+		if err != nil {
+			return 0, err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		renamed := make([]categoryNameSnapshot, 0, len(rows))
+		for _, r := range rows {
+			renamed = append(renamed, categoryNameSnapshot{ID: r.ID, Name: renamedCategory(r.Name, from, to)})
+		}
+		if err = execQueries(ctx, tx, renameRows(table, userID, renamed)); err != nil {
+			return 0, err
+		}
+		snapshot.Rows[table] = append(snapshot.Rows[table], rows...)
+		if table == "expenses" {
+			expenses = int64(len(rows))
+		}
+	}
+
+	budgets, err := queryColumn[string](ctx, tx, psql.Select("category").
+		From("budgets").
+		Where(sq.Eq{"user_id": userID}).
+		Where(categoryMatch("category", from)).
+		Suffix("FOR UPDATE"))
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range budgets {
+		name := renamedCategory(b, from, to)
+		// the budget is kept only if there is no other one of the category
+		var dropped money.Amount
+		err = tx.QueryRowContext(ctx, `
+	DELETE FROM budgets b
+	WHERE b.user_id = $1 AND b.category = $2
+		AND EXISTS (SELECT 1 FROM budgets d WHERE d.user_id = $1 AND lower(d.category) = lower($3) AND d.category <> $2)
+	RETURNING b.amount`,
+			userID, b, name).Scan(&dropped)
+		switch {
+		case err == nil:
+			snapshot.Budgets = append(snapshot.Budgets, categoryBudgetSnapshot{Category: b, Amount: dropped})
+			continue
+		case !errors.Is(err, sql.ErrNoRows):
+			return 0, err
+		}
+		_, err = psql.Update("budgets").
+			Set("category", name).
+			Where(sq.Eq{"user_id": userID, "category": b}).
+			RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return 0, err
+		}
+		snapshot.Budgets = append(snapshot.Budgets, categoryBudgetSnapshot{Category: b, Renamed: name})
+	}
+	return expenses, nil
+}
+
+// renameRows returns the query setting category names of the table rows by their IDs.
+func renameRows(table string, userID int64, rows []categoryNameSnapshot) sq.Sqlizer {
+	ids, names := make([]int64, 0, len(rows)), make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+		names = append(names, r.Name)
+	}
+	return sq.Expr(fmt.Sprintf(`
+	UPDATE %s t SET category = v.name
+	FROM unnest($1::integer[], $2::text[]) AS v(id, name)
+	WHERE t.id = v.id AND t.user_id = $3`, table),
+		pq.Array(ids), pq.Array(names), userID)
+}
+
+// revertCategoryChange restores registered categories, aliases, category names of rows and budgets
+// as they were before the rename or the merge.
+func revertCategoryChange(ctx context.Context, tx *sql.Tx, userID int64, c categorySnapshot) error {
+	queries := make([]sq.Sqlizer, 0)
+	if len(c.AddedAliases) > 0 {
+		queries = append(queries, psql.Delete("category_aliases").
+			Where(sq.Eq{"id": c.AddedAliases, "user_id": userID}))
+	}
+	for _, d := range c.Deleted {
+		queries = append(queries, psql.Insert("categories").
+			Columns("id", "user_id", "name").
+			Values(d.ID, userID, d.Name))
+		if len(d.MovedAliases) > 0 {
+			queries = append(queries, psql.Update("category_aliases").
+				Set("category_id", d.ID).
+				Where(sq.Eq{"id": d.MovedAliases, "user_id": userID}))
+		}
+	}
+	for _, r := range c.Renamed {
+		// the old name may have been registered again since, its expenses are in the restored category then
+		queries = append(queries, psql.Delete("categories").
+			Where(sq.Eq{"user_id": userID, "lower(name)": strings.ToLower(r.Name)}).
+			Where(sq.NotEq{"id": r.ID}))
+		queries = append(queries, psql.Update("categories").
+			Set("name", r.Name).
+			Where(sq.Eq{"id": r.ID, "user_id": userID}))
+	}
+	for _, a := range c.RemovedAliases {
+		queries = append(queries, psql.Insert("category_aliases").
+			Columns("user_id", "category_id", "alias").
+			Values(userID, a.ID, a.Name).
+			Suffix("ON CONFLICT DO NOTHING"))
+	}
+	for _, table := range categoryTables {
+		if rows := c.Rows[table]; len(rows) > 0 {
+			queries = append(queries, renameRows(table, userID, rows))
+		}
+	}
+	for _, b := range c.Budgets {
+		if b.Renamed != "" {
+			queries = append(queries, psql.Update("budgets").
+				Set("category", b.Category).
+				Where(sq.Eq{"user_id": userID, "category": b.Renamed}))
+			continue
+		}
+		queries = append(queries, psql.Insert("budgets").
+			Columns("user_id", "category", "amount").
+			Values(userID, b.Category, b.Amount).
+			Suffix("ON CONFLICT DO NOTHING"))
+	}
+	return execQueries(ctx, tx, queries...)
+}
+
+// execQueries executes the queries one by one in the transaction.
+func execQueries(ctx context.Context, tx *sql.Tx, queries ...sq.Sqlizer) error {
+	for _, query := range queries {
+		sqlStr, args, err := query.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, sqlStr, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryCategoryNames returns rows of IDs and category names selected by the query.
+func queryCategoryNames(ctx context.Context, tx *sql.Tx, query sq.Sqlizer) ([]categoryNameSnapshot, error) {
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	res := make([]categoryNameSnapshot, 0)
+	for rows.Next() {
+		var r categoryNameSnapshot
+		if err = rows.Scan(&r.ID, &r.Name); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+// queryColumn returns values of the single column selected or returned by the query.
+func queryColumn[T any](ctx context.Context, tx *sql.Tx, query sq.Sqlizer) ([]T, error) {
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	res := make([]T, 0)
+	for rows.Next() {
+		var v T
+		if err = rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
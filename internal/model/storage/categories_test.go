@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnCategoryRename_ShouldKeepPathsOfSubcategories(t *testing.T) {
+	assert.Equal(t, "meals", renamedCategory("Food", "food", "meals"))
+	assert.Equal(t, "meals/Groceries/Fruit", renamedCategory("Food/Groceries/Fruit", "food", "meals"))
+	assert.Equal(t, "Еда/кафе", renamedCategory("ЕДА/кафе", "еда", "Еда"))
+}
+
+func Test_OnCategoryRename_ShouldMatchSubcategoriesOnly(t *testing.T) {
+	sqlStr, args, err := psql.Select("id").
+		From("expenses").
+		Where(categoryMatch("category", "Еда")).
+		ToSql()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id FROM expenses WHERE (lower(category) = $1 OR left(lower(category), 4) = $2)", sqlStr)
+	assert.Equal(t, []any{"еда", "еда/"}, args)
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+)
+
+// importBatchSize bounds the expenses saved in one transaction, so a large import doesn't lock the table for long
+const importBatchSize = 100
+
+type importSnapshot struct {
+	IDs []int64 `json:"ids"`
+}
+
+// importKey identifies expenses considered the same: of one day, category, original amount and currency.
+type importKey struct {
+	day      string
+	category string
+	amount   money.Amount
+	currency string
+}
+
+func importKeyOf(rec user.ExpenseRecord) importKey {
+	return importKey{
+		day:      rec.Created.Format("2006-01-02"),
+		category: strings.ToLower(rec.Category),
+		amount:   rec.OriginalAmount,
+		currency: rec.Currency,
+	}
+}
+
+// ImportExpenses saves past expenses of the user in batches, one transaction per batch, without checking limits.
+// Expenses the user already has are skipped: as many of the same day, category, original amount and currency
+// as there are saved, so repeated rows of a file are kept. Days are taken in the location of expense dates.
+// The whole import is journaled as one action, so it is undone at once. It returns the number of saved expenses,
+// on an error the number saved by the batches before the failed one.
+func (s *PostgresStorage) ImportExpenses(ctx context.Context, userID int64, recs []user.ExpenseRecord) (int, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_importExpenses")
+	defer span.Finish()
+
+	run := newImportRun(userID)
+	imported := 0
+	for start := 0; start < len(recs); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(recs) {
+			end = len(recs)
+		}
+		n, err := s.importBatch(ctx, run, recs[start:end])
+		if err != nil {
+			return imported, errors.Wrap(err, "import expenses")
+		}
+		imported += n
+	}
+	return imported, nil
+}
+
+// importRun keeps the state of an import across its batches.
+type importRun struct {
+	userID int64
+	// saved are the numbers of expenses the user had before the import by their keys, less the rows matched to them
+	saved map[importKey]int
+	// actionID is the action journaling the import, it is recorded by the first batch saving expenses
+	actionID int64
+}
+
+func newImportRun(userID int64) *importRun {
+	return &importRun{userID: userID, saved: make(map[importKey]int)}
+}
+
+// isDuplicate reports whether the row matches an expense the user had before the import.
+// The count returns the number of such expenses saved, it is called once per key, before any row of it is saved.
+func (r *importRun) isDuplicate(rec user.ExpenseRecord, count func() (int, error)) (bool, error) {
+	key := importKeyOf(rec)
+	n, ok := r.saved[key]
+	if !ok {
+		var err error
+		if n, err = count(); err != nil {
+			return false, err
+		}
+	}
+	if n > 0 {
+		r.saved[key] = n - 1
+		return true, nil
+	}
+	r.saved[key] = 0
+	return false, nil
+}
+
+func (s *PostgresStorage) importBatch(ctx context.Context, run *importRun, recs []user.ExpenseRecord) (n int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rollbackOnError(tx, &err)
+
+	ids := make([]int64, 0, len(recs))
+	for _, rec := range recs {
+		rec := rec
+		var duplicate bool
+		duplicate, err = run.isDuplicate(rec, func() (int, error) {
+			return countSameExpenses(ctx, tx, run.userID, rec)
+		})
+		if err != nil {
+			return 0, err
+		}
+		if duplicate {
+			continue
+		}
+
+		var id int64
+		err = psql.Insert("expenses").
+			Columns("user_id", "amount", "category", "created_at", "original_amount", "currency", "rate", "account_id",
+				"note").
+			Values(run.userID, rec.Amount, rec.Category, rec.Created, rec.OriginalAmount, rec.Currency, rec.Rate,
+				nullableID(rec.AccountID), rec.Note).
+			Suffix("RETURNING id").
+			RunWith(tx).QueryRowContext(ctx).Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+		if err = registerCategory(ctx, tx, run.userID, rec.Category); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) > 0 {
+		if err = journalImport(ctx, tx, run, ids); err != nil {
+			return 0, err
+		}
+	}
+	err = tx.Commit()
+	return len(ids), err
+}
+
+// journalImport adds the expenses saved by a batch to the action of the import, recording it by the first batch.
+func journalImport(ctx context.Context, tx *sql.Tx, run *importRun, ids []int64) error {
+	if run.actionID == 0 {
+		payload, err := json.Marshal(importSnapshot{IDs: ids})
+		if err != nil {
+			return err
+		}
+		return psql.Insert("actions").
+			Columns("user_id", "kind", "payload").
+			Values(run.userID, actionExpensesImported, string(payload)).
+			Suffix("RETURNING id").
+			RunWith(tx).QueryRowContext(ctx).Scan(&run.actionID)
+	}
+
+	payload, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+	UPDATE actions SET payload = jsonb_set(payload, '{ids}', (payload -> 'ids') || $1::jsonb)
+	WHERE id = $2 AND user_id = $3`,
+		string(payload), run.actionID, run.userID)
+	return err
+}
+
+func countSameExpenses(ctx context.Context, tx *sql.Tx, userID int64, rec user.ExpenseRecord) (int, error) {
+	y, m, d := rec.Created.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, rec.Created.Location())
+
+	var count int
+	err := psql.Select("count(*)").
+		From("expenses").
+		Where(sq.Eq{
+			"user_id":         userID,
+			"lower(category)": strings.ToLower(rec.Category),
+			"original_amount": rec.OriginalAmount,
+			"currency":        rec.Currency,
+		}).
+		Where(sq.GtOrEq{"created_at": day}).
+		Where(sq.Lt{"created_at": day.AddDate(0, 0, 1)}).
+		RunWith(tx).QueryRowContext(ctx).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+)
+
+func Test_OnImportExpenses_ShouldMatchSavedExpensesOnceAcrossBatches(t *testing.T) {
+	day := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+	same := user.ExpenseRecord{Category: "Food", Created: day, OriginalAmount: money.Amount(5000000), Currency: "RUB"}
+
+	// the user has one of the two same rows of the file, the other one is in the next batch
+	recs := make([]user.ExpenseRecord, 0, importBatchSize+2)
+	recs = append(recs, same)
+	for i := 0; i < importBatchSize; i++ {
+		recs = append(recs, user.ExpenseRecord{
+			Category:       "Taxi",
+			Created:        day.AddDate(0, 0, -i-1),
+			OriginalAmount: money.Amount(1000000),
+			Currency:       "RUB",
+		})
+	}
+	recs = append(recs, same)
+	stored := []user.ExpenseRecord{same}
+
+	run := newImportRun(123)
+	saved := 0
+	for start := 0; start < len(recs); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(recs) {
+			end = len(recs)
+		}
+		for _, rec := range recs[start:end] {
+			duplicate, err := run.isDuplicate(rec, func() (int, error) {
+				count := 0
+				for _, s := range stored {
+					if importKeyOf(s) == importKeyOf(rec) {
+						count++
+					}
+				}
+				return count, nil
+			})
+			assert.NoError(t, err)
+			if !duplicate {
+				stored = append(stored, rec)
+				saved++
+			}
+		}
+	}
+
+	assert.Equal(t, importBatchSize+1, saved)
+	assert.Len(t, stored, importBatchSize+2)
+}
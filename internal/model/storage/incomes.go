@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+)
+
+type incomeSnapshot struct {
+	ID int64 `json:"id"`
+}
+
+func (s *PostgresStorage) SaveIncome(ctx context.Context, userID int64, rec user.IncomeRecord) (id int64, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_saveIncome")
+	defer span.Finish()
+
+	query := psql.Insert("incomes").
+		Columns("user_id", "amount", "source", "created_at", "original_amount", "currency", "account_id").
+		Values(userID, rec.Amount, rec.Source, rec.Created, rec.OriginalAmount, rec.Currency, nullableID(rec.AccountID)).
+		Suffix("RETURNING id")
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "save income")
+	}
+	defer rollbackOnError(tx, &err)
+
+	err = query.RunWith(tx).QueryRowContext(ctx).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "save income")
+	}
+	err = recordAction(ctx, tx, userID, actionIncomeAdded, incomeSnapshot{ID: id})
+	if err != nil {
+		return 0, errors.Wrap(err, "save income")
+	}
+	err = tx.Commit()
+	return id, err
+}
+
+func (s *PostgresStorage) GetUserIncomes(ctx context.Context, userID int64) ([]user.IncomeRecord, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getUserIncomes")
+	defer span.Finish()
+
+	query := psql.Select("id", "amount", "source", "created_at",
+		"COALESCE(original_amount, amount)", "COALESCE(currency, '')", "COALESCE(account_id, 0)", accountNameColumn).
+		From("incomes").
+		Where(sq.Eq{"user_id": userID})
+
+	rows, err := query.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get incomes")
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	incomes := make([]user.IncomeRecord, 0)
+	for rows.Next() {
+		var inc user.IncomeRecord
+		err = rows.Scan(&inc.ID, &inc.Amount, &inc.Source, &inc.Created,
+			&inc.OriginalAmount, &inc.Currency, &inc.AccountID, &inc.Account)
+		if err != nil {
+			return nil, errors.Wrap(err, "get incomes")
+		}
+		incomes = append(incomes, inc)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "get incomes")
+	}
+
+	return incomes, nil
+}
+
+// GetBalance returns total incomes and expenses of the user in base currency.
+// Zero bounds do not filter, from is inclusive, to is exclusive.
+func (s *PostgresStorage) GetBalance(ctx context.Context, userID int64, from, to time.Time) (
+	income, expenses money.Amount, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getBalance")
+	defer span.Finish()
+
+	income, err = s.sumWithin(ctx, "incomes", userID, from, to)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "get balance")
+	}
+	expenses, err = s.sumWithin(ctx, "expenses", userID, from, to)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "get balance")
+	}
+	return income, expenses, nil
+}
+
+func (s *PostgresStorage) sumWithin(ctx context.Context, table string, userID int64, from, to time.Time) (money.Amount, error) {
+	query := psql.Select("COALESCE(sum(amount), 0)").
+		From(table).
+		Where(sq.Eq{"user_id": userID})
+	if !from.IsZero() {
+		query = query.Where(sq.GtOrEq{"created_at": from})
+	}
+	if !to.IsZero() {
+		query = query.Where(sq.Lt{"created_at": to})
+	}
+
+	var res money.Amount
+	err := query.RunWith(s.db).QueryRowContext(ctx).Scan(&res)
+	return res, err
+}
@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+)
+
+// Kinds of journaled user actions.
+// Every action stores a snapshot of the state needed to revert it.
+const (
+	actionExpenseAdded   = "expense_added"
+	actionExpenseUpdated = "expense_updated"
+	actionExpenseDeleted = "expense_deleted"
+	actionUserUpdated    = "user_updated"
+	actionBudgetUpdated  = "budget_updated"
+	actionIncomeAdded    = "income_added"
+	actionAccountAdded   = "account_added"
+	actionTransferAdded  = "transfer_added"
+
+	actionRecurringAdded   = "recurring_added"
+	actionRecurringDeleted = "recurring_deleted"
+
+	actionExpensesImported = "expenses_imported"
+
+	actionCategoryRenamed  = "category_renamed"
+	actionCategoriesMerged = "categories_merged"
+)
+
+type action struct {
+	id      int64
+	kind    string
+	payload []byte
+}
+
+type expenseSnapshot struct {
+	ID       int64        `json:"id"`
+	Amount   money.Amount `json:"amount"`
+	Category string       `json:"category"`
+	Created  time.Time    `json:"created"`
+
+	OriginalAmount money.Amount `json:"originalAmount"`
+	Currency       string       `json:"currency"`
+	Rate           float64      `json:"rate"`
+
+	AccountID int64  `json:"accountId"`
+	Account   string `json:"account"`
+
+	Tags []string `json:"tags"`
+	Note string   `json:"note"`
+
+	RecurringID int64 `json:"recurringId"`
+}
+
+// expenseSnapshotOf maps the expense to its journaled state field by field,
+// so that changes of the record don't change the payloads already journaled.
+func expenseSnapshotOf(rec user.ExpenseRecord) expenseSnapshot {
+	return expenseSnapshot{
+		ID:             rec.ID,
+		Amount:         rec.Amount,
+		Category:       rec.Category,
+		Created:        rec.Created,
+		OriginalAmount: rec.OriginalAmount,
+		Currency:       rec.Currency,
+		Rate:           rec.Rate,
+		AccountID:      rec.AccountID,
+		Account:        rec.Account,
+		Tags:           rec.Tags,
+		Note:           rec.Note,
+		RecurringID:    rec.RecurringID,
+	}
+}
+
+type userSnapshot struct {
+	PreferredCurrency string       `json:"preferredCurrency"`
+	Timezone          string       `json:"timezone"`
+	MonthLimit        money.Amount `json:"monthLimit"`
+	SoftLimit         bool         `json:"softLimit"`
+}
+
+func recordAction(ctx context.Context, tx *sql.Tx, userID int64, kind string, snapshot any) error {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrap(err, "record action")
+	}
+
+	query := psql.Insert("actions").
+		Columns("user_id", "kind", "payload").
+		Values(userID, kind, string(payload))
+
+	_, err = query.RunWith(tx).ExecContext(ctx)
+	return errors.Wrap(err, "record action")
+}
+
+// UndoActions reverts at most n last actions of the user, the most recent first.
+// It returns the number of actions actually reverted.
+func (s *PostgresStorage) UndoActions(ctx context.Context, userID int64, n int) (undone int, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_undoActions")
+	defer span.Finish()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "undo actions")
+	}
+	defer rollbackOnError(tx, &err)
+
+	actions, err := lastActions(ctx, tx, userID, n)
+	if err != nil {
+		return 0, errors.Wrap(err, "undo actions")
+	}
+
+	ids := make([]int64, 0, len(actions))
+	for _, a := range actions {
+		if err = revertAction(ctx, tx, userID, a); err != nil {
+			return 0, errors.Wrap(err, "undo actions")
+		}
+		ids = append(ids, a.id)
+	}
+
+	if len(ids) > 0 {
+		_, err = psql.Delete("actions").
+			Where(sq.Eq{"id": ids}).
+			RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return 0, errors.Wrap(err, "undo actions")
+		}
+	}
+
+	err = tx.Commit()
+	return len(ids), err
+}
+
+func lastActions(ctx context.Context, tx *sql.Tx, userID int64, n int) ([]action, error) {
+	query := psql.Select("id", "kind", "payload").
+		From("actions").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("id DESC").
+		Limit(uint64(n)).
+		Suffix("FOR UPDATE")
+
+	rows, err := query.RunWith(tx).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	actions := make([]action, 0, n)
+	for rows.Next() {
+		var a action
+		if err = rows.Scan(&a.id, &a.kind, &a.payload); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+func revertAction(ctx context.Context, tx *sql.Tx, userID int64, a action) error {
+	var query sq.Sqlizer
+	switch a.kind {
+	case actionExpenseAdded, actionExpenseUpdated, actionExpenseDeleted:
+		var exp expenseSnapshot
+		if err := json.Unmarshal(a.payload, &exp); err != nil {
+			return err
+		}
+		return revertExpense(ctx, tx, a.kind, userID, exp)
+	case actionUserUpdated:
+		var u userSnapshot
+		if err := json.Unmarshal(a.payload, &u); err != nil {
+			return err
+		}
+		query = psql.Update("users").
+			Set("preferred_currency", u.PreferredCurrency).
+			Set("timezone", u.Timezone).
+			Set("month_limit", u.MonthLimit).
+			Set("soft_limit", u.SoftLimit).
+			Set("updated_at", time.Now()).
+			Where(sq.Eq{"id": userID})
+	case actionBudgetUpdated:
+		var b budgetSnapshot
+		if err := json.Unmarshal(a.payload, &b); err != nil {
+			return err
+		}
+		query = revertBudgetQuery(userID, b)
+	case actionIncomeAdded:
+		var inc incomeSnapshot
+		if err := json.Unmarshal(a.payload, &inc); err != nil {
+			return err
+		}
+		query = psql.Delete("incomes").
+			Where(sq.Eq{"id": inc.ID, "user_id": userID})
+	case actionAccountAdded:
+		var acc accountSnapshot
+		if err := json.Unmarshal(a.payload, &acc); err != nil {
+			return err
+		}
+		query = psql.Delete("accounts").
+			Where(sq.Eq{"id": acc.ID, "user_id": userID})
+	case actionTransferAdded:
+		var t transferSnapshot
+		if err := json.Unmarshal(a.payload, &t); err != nil {
+			return err
+		}
+		// entries are deleted along with the transfer
+		query = psql.Delete("transfers").
+			Where(sq.Eq{"id": t.ID, "user_id": userID})
+	case actionRecurringAdded:
+		var r recurringSnapshot
+		if err := json.Unmarshal(a.payload, &r); err != nil {
+			return err
+		}
+		query = psql.Delete("recurring_expenses").
+			Where(sq.Eq{"id": r.ID, "user_id": userID})
+	case actionRecurringDeleted:
+		var r recurringSnapshot
+		if err := json.Unmarshal(a.payload, &r); err != nil {
+			return err
+		}
+		// runs missed while it was deleted are caught up from its old next run
+		query = psql.Insert("recurring_expenses").
+			Columns("id", "user_id", "category", "amount", "currency", "schedule", "next_run_at").
+			Values(r.ID, userID, r.Category, r.Amount, r.Currency, r.Schedule, r.NextRun)
+	case actionExpensesImported:
+		var imp importSnapshot
+		if err := json.Unmarshal(a.payload, &imp); err != nil {
+			return err
+		}
+		query = psql.Delete("expenses").
+			Where(sq.Eq{"id": imp.IDs, "user_id": userID})
+	case actionCategoryRenamed, actionCategoriesMerged:
+		var c categorySnapshot
+		if err := json.Unmarshal(a.payload, &c); err != nil {
+			return err
+		}
+		return revertCategoryChange(ctx, tx, userID, c)
+	default:
+		return fmt.Errorf("unknown action kind %s", a.kind)
+	}
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, sqlStr, args...)
+	return err
+}
+
+func revertExpense(ctx context.Context, tx *sql.Tx, kind string, userID int64, exp expenseSnapshot) error {
+	sqlStr, args, err := revertExpenseQuery(kind, userID, exp).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, sqlStr, args...); err != nil {
+		return err
+	}
+	// tags of an added expense are deleted along with it
+	if kind == actionExpenseAdded {
+		return nil
+	}
+	return saveTags(ctx, tx, exp.ID, exp.Tags)
+}
+
+func revertExpenseQuery(kind string, userID int64, exp expenseSnapshot) sq.Sqlizer {
+	if exp.Rate == 0 {
+		// snapshots journaled before original amounts were stored
+		exp.OriginalAmount, exp.Rate = exp.Amount, 1
+	}
+	switch kind {
+	case actionExpenseAdded:
+		return psql.Delete("expenses").
+			Where(sq.Eq{"id": exp.ID, "user_id": userID})
+	case actionExpenseUpdated:
+		return psql.Update("expenses").
+			Set("amount", exp.Amount).
+			Set("category", exp.Category).
+			Set("created_at", exp.Created).
+			Set("original_amount", exp.OriginalAmount).
+			Set("currency", exp.Currency).
+			Set("rate", exp.Rate).
+			Set("account_id", nullableID(exp.AccountID)).
+			Set("note", exp.Note).
+			Where(sq.Eq{"id": exp.ID, "user_id": userID})
+	default:
+		// the recurring expense may have been removed since, then the link is not restored
+		recurringID := sq.Expr("(SELECT r.id FROM recurring_expenses r WHERE r.id = ?)", exp.RecurringID)
+		return psql.Insert("expenses").
+			Columns("id", "user_id", "amount", "category", "created_at", "original_amount", "currency", "rate", "account_id",
+				"note", "recurring_id").
+			Values(exp.ID, userID, exp.Amount, exp.Category, exp.Created, exp.OriginalAmount, exp.Currency, exp.Rate,
+				nullableID(exp.AccountID), exp.Note, recurringID)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/opentracing/opentracing-go"
 
@@ -15,9 +16,10 @@ import (
 
 	"time"
 
-	_ "github.com/lib/pq" // postgres driver
+	"github.com/lib/pq" // postgres driver
 	"github.com/pkg/errors"
 	"max.ks1230/finances-bot/internal/entity/currency"
+	"max.ks1230/finances-bot/internal/entity/money"
 	"max.ks1230/finances-bot/internal/entity/user"
 	"max.ks1230/finances-bot/internal/model/customerr"
 )
@@ -26,6 +28,26 @@ const dsnTemplate = "user=%s password=%s host=%s dbname=%s sslmode=disable"
 
 var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
+// expenseColumns are selected to be scanned by scanExpense
+var expenseColumns = []string{
+	"id", "amount", "category", "created_at",
+	"COALESCE(original_amount, amount)", "COALESCE(currency, '')", "COALESCE(rate, 1)",
+	"COALESCE(account_id, 0)", accountNameColumn,
+	"ARRAY(SELECT tag FROM expense_tags t WHERE t.expense_id = expenses.id ORDER BY tag)", "note",
+	"COALESCE(recurring_id, 0)",
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanExpense(row scanner) (user.ExpenseRecord, error) {
+	var e user.ExpenseRecord
+	err := row.Scan(&e.ID, &e.Amount, &e.Category, &e.Created, &e.OriginalAmount, &e.Currency, &e.Rate,
+		&e.AccountID, &e.Account, (*pq.StringArray)(&e.Tags), &e.Note, &e.RecurringID)
+	return e, err
+}
+
 type config interface {
 	Host() string
 	Username() string
@@ -33,11 +55,16 @@ type config interface {
 	Database() string
 }
 
+type defaultsConfig interface {
+	Location() *time.Location
+}
+
 type PostgresStorage struct {
-	db *sql.DB
+	db              *sql.DB
+	defaultLocation *time.Location
 }
 
-func NewPostgresStorage(config config) (*PostgresStorage, error) {
+func NewPostgresStorage(config config, defaults defaultsConfig) (*PostgresStorage, error) {
 	db, err := sql.Open("postgres", fmt.Sprintf(dsnTemplate,
 		config.Username(),
 		config.Password(),
@@ -49,78 +76,271 @@ func NewPostgresStorage(config config) (*PostgresStorage, error) {
 	if err = db.Ping(); err != nil {
 		return nil, errors.Wrap(err, "cannot connect to database")
 	}
-	return &PostgresStorage{db}, nil
+	return &PostgresStorage{
+		db:              db,
+		defaultLocation: defaults.Location(),
+	}, nil
 }
 
 func (s *PostgresStorage) GetUserByID(ctx context.Context, id int64) (user.Record, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getUserById")
 	defer span.Finish()
 
-	query := psql.Select("preferred_currency", "month_limit").
+	query := psql.Select("preferred_currency", "COALESCE(timezone, '')", "month_limit", "soft_limit").
 		From("users").
 		Where(sq.Eq{"id": id})
 
 	var res user.Record
-	var curr string
-	err := query.RunWith(s.db).QueryRowContext(ctx).Scan(&curr, &res.MonthLimit)
+	var curr, tz string
+	err := query.RunWith(s.db).QueryRowContext(ctx).Scan(&curr, &tz, &res.MonthLimit, &res.SoftLimit)
 	if err != nil {
 		return user.Record{}, errors.Wrap(err, "get user")
 	}
 	res.SetPreferredCurrency(curr)
+	res.SetTimezone(tz)
 	return res, nil
 }
 
-func (s *PostgresStorage) SaveUserByID(ctx context.Context, id int64, rec user.Record) error {
+func (s *PostgresStorage) SaveUserByID(ctx context.Context, id int64, rec user.Record) (err error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "db_saveUserById")
 	defer span.Finish()
 
 	query := psql.Insert("users").
-		Columns("id", "preferred_currency", "month_limit", "updated_at").
-		Values(id, rec.PreferredCurrency(), rec.MonthLimit, time.Now()).
-		Suffix("ON CONFLICT(id) DO UPDATE SET preferred_currency = ?, month_limit = ?, updated_at = ?",
-			rec.PreferredCurrency(), rec.MonthLimit, time.Now())
+		Columns("id", "preferred_currency", "timezone", "month_limit", "soft_limit", "updated_at").
+		Values(id, rec.PreferredCurrency(), rec.Timezone(), rec.MonthLimit, rec.SoftLimit, time.Now()).
+		Suffix("ON CONFLICT(id) DO UPDATE SET preferred_currency = ?, timezone = ?, month_limit = ?, soft_limit = ?, updated_at = ?",
+			rec.PreferredCurrency(), rec.Timezone(), rec.MonthLimit, rec.SoftLimit, time.Now())
 
-	_, err := query.RunWith(s.db).ExecContext(ctx)
-	return errors.Wrap(err, "save user")
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "save user")
+	}
+	defer rollbackOnError(tx, &err)
+
+	var prev userSnapshot
+	err = psql.Select("preferred_currency", "COALESCE(timezone, '')", "month_limit", "soft_limit").
+		From("users").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		RunWith(tx).QueryRowContext(ctx).
+		Scan(&prev.PreferredCurrency, &prev.Timezone, &prev.MonthLimit, &prev.SoftLimit)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// creation of a user is not journaled, there is nothing to revert it to
+		err = nil
+	case err != nil:
+		return errors.Wrap(err, "save user")
+	default:
+		if err = recordAction(ctx, tx, id, actionUserUpdated, prev); err != nil {
+			return errors.Wrap(err, "save user")
+		}
+	}
+
+	_, err = query.RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "save user")
+	}
+	err = tx.Commit()
+	return err
 }
 
-func (s *PostgresStorage) SaveExpense(ctx context.Context, userID int64, rec user.ExpenseRecord) (err error) {
+// SaveExpense saves the expense of the user and journals it to be undone.
+// Runs of recurring expenses are saved by the scheduler rather than the user, so they are not journaled.
+func (s *PostgresStorage) SaveExpense(ctx context.Context, userID int64, rec user.ExpenseRecord) (id int64, err error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "db_saveExpense")
 	defer span.Finish()
 
 	query := psql.Insert("expenses").
-		Columns("user_id", "amount", "category", "created_at").
-		Values(userID, rec.Amount, rec.Category, rec.Created)
+		Columns("user_id", "amount", "category", "created_at", "original_amount", "currency", "rate", "account_id",
+			"note", "recurring_id").
+		Values(userID, rec.Amount, rec.Category, rec.Created, rec.OriginalAmount, rec.Currency, rec.Rate,
+			nullableID(rec.AccountID), rec.Note, nullableID(rec.RecurringID)).
+		Suffix("RETURNING id")
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return errors.Wrap(err, "save expense")
+		return 0, errors.Wrap(err, "save expense")
 	}
-	defer func() {
+	defer rollbackOnError(tx, &err)
+
+	err = query.RunWith(tx).QueryRowContext(ctx).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "save expense")
+	}
+	if err = saveTags(ctx, tx, id, rec.Tags); err != nil {
+		return 0, errors.Wrap(err, "save expense")
+	}
+	if err = registerCategory(ctx, tx, userID, rec.Category); err != nil {
+		return 0, errors.Wrap(err, "save expense")
+	}
+	if rec.RecurringID != 0 {
+		if err = claimRecurringRun(ctx, tx, rec.RecurringID, rec.Created, id); err != nil {
+			return 0, errors.Wrap(err, "save expense")
+		}
+	}
+	if err = s.ensureLimits(ctx, tx, userID, rec.Category, rec.Created); err != nil {
+		return 0, err
+	}
+	if rec.RecurringID == 0 {
+		err = recordAction(ctx, tx, userID, actionExpenseAdded, expenseSnapshot{ID: id})
 		if err != nil {
-			txErr := tx.Rollback()
-			if txErr != nil {
-				logger.Error("error when transaction rollback", zap.Error(txErr))
-			}
+			return 0, errors.Wrap(err, "save expense")
 		}
-	}()
+	}
+	err = tx.Commit()
+	return id, err
+}
+
+func (s *PostgresStorage) UpdateExpense(ctx context.Context, userID int64, rec user.ExpenseRecord) (err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_updateExpense")
+	defer span.Finish()
 
+	query := psql.Update("expenses").
+		Set("amount", rec.Amount).
+		Set("category", rec.Category).
+		Set("created_at", rec.Created).
+		Set("original_amount", rec.OriginalAmount).
+		Set("currency", rec.Currency).
+		Set("rate", rec.Rate).
+		Set("account_id", nullableID(rec.AccountID)).
+		Set("note", rec.Note).
+		Where(sq.Eq{"id": rec.ID, "user_id": userID})
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "update expense")
+	}
+	defer rollbackOnError(tx, &err)
+
+	prev, err := expenseForUpdate(ctx, tx, userID, rec.ID)
+	if err != nil {
+		return errors.Wrap(err, "update expense")
+	}
 	_, err = query.RunWith(tx).ExecContext(ctx)
 	if err != nil {
-		return errors.Wrap(err, "save expense")
+		return errors.Wrap(err, "update expense")
+	}
+	if err = saveTags(ctx, tx, rec.ID, rec.Tags); err != nil {
+		return errors.Wrap(err, "update expense")
+	}
+	if err = registerCategory(ctx, tx, userID, rec.Category); err != nil {
+		return errors.Wrap(err, "update expense")
+	}
+	if err = s.ensureLimits(ctx, tx, userID, rec.Category, rec.Created); err != nil {
+		return err
+	}
+	err = recordAction(ctx, tx, userID, actionExpenseUpdated, prev)
+	if err != nil {
+		return errors.Wrap(err, "update expense")
 	}
-	limMet, err := s.isLimitMet(ctx, tx, userID)
+	err = tx.Commit()
+	return err
+}
+
+func (s *PostgresStorage) DeleteExpense(ctx context.Context, userID int64, expenseID int64) (err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_deleteExpense")
+	defer span.Finish()
+
+	query := psql.Delete("expenses").
+		Where(sq.Eq{"id": expenseID, "user_id": userID})
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return errors.Wrap(err, "save expense")
+		return errors.Wrap(err, "delete expense")
 	}
-	if !limMet {
-		return &customerr.LimitError{Err: "user limit exceeded"}
+	defer rollbackOnError(tx, &err)
+
+	prev, err := expenseForUpdate(ctx, tx, userID, expenseID)
+	if err != nil {
+		return errors.Wrap(err, "delete expense")
+	}
+	_, err = query.RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "delete expense")
+	}
+	err = recordAction(ctx, tx, userID, actionExpenseDeleted, prev)
+	if err != nil {
+		return errors.Wrap(err, "delete expense")
 	}
 	err = tx.Commit()
 	return err
 }
 
-func (s *PostgresStorage) isLimitMet(ctx context.Context, tx *sql.Tx, userID int64) (bool, error) {
+// saveTags replaces the tags of the expense.
+func saveTags(ctx context.Context, tx *sql.Tx, expenseID int64, tags []string) error {
+	_, err := psql.Delete("expense_tags").
+		Where(sq.Eq{"expense_id": expenseID}).
+		RunWith(tx).ExecContext(ctx)
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+
+	query := psql.Insert("expense_tags").
+		Columns("expense_id", "tag").
+		Suffix("ON CONFLICT DO NOTHING")
+	for _, tag := range tags {
+		query = query.Values(expenseID, strings.ToLower(tag))
+	}
+	_, err = query.RunWith(tx).ExecContext(ctx)
+	return err
+}
+
+// expenseForUpdate locks the expense row and returns its current state.
+func expenseForUpdate(ctx context.Context, tx *sql.Tx, userID int64, expenseID int64) (expenseSnapshot, error) {
+	query := psql.Select(expenseColumns...).
+		From("expenses").
+		Where(sq.Eq{"id": expenseID, "user_id": userID}).
+		Suffix("FOR UPDATE")
+
+	res, err := scanExpense(query.RunWith(tx).QueryRowContext(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		return expenseSnapshot{}, &customerr.NotFoundError{Err: fmt.Sprintf("expense %d not found", expenseID)}
+	}
+	return expenseSnapshotOf(res), err
+}
+
+func rollbackOnError(tx *sql.Tx, err *error) {
+	if *err != nil {
+		txErr := tx.Rollback()
+		if txErr != nil {
+			logger.Error("error when transaction rollback", zap.Error(txErr))
+		}
+	}
+}
+
+// ensureLimits checks user's month limit and the budget of the category in the month of the given moment,
+// that is the one the expense is saved in, within the transaction. It returns a customerr error if any of them is exceeded, unless the user is in soft limit mode.
+// In soft limit mode both are checked by FireLimitWarnings after the expense is saved.
+func (s *PostgresStorage) ensureLimits(ctx context.Context, tx *sql.Tx, userID int64, category string,
+	at time.Time) error {
+	settings, err := s.limitSettings(ctx, tx, userID)
+	if err != nil {
+		return errors.Wrap(err, "ensure limits")
+	}
+	if settings.soft {
+		// exceeding expenses are saved, user is warned afterwards
+		return nil
+	}
+	month := now.With(at.In(settings.loc))
+
+	limMet, err := s.isLimitMet(ctx, tx, userID, month)
+	if err != nil {
+		return errors.Wrap(err, "ensure limits")
+	}
+	if !limMet {
+		return &customerr.LimitError{Err: "user limit exceeded"}
+	}
+	budgetMet, err := s.isBudgetMet(ctx, tx, userID, category, month)
+	if err != nil {
+		return errors.Wrap(err, "ensure limits")
+	}
+	if !budgetMet {
+		return &customerr.BudgetError{Category: category}
+	}
+	return nil
+}
+
+func (s *PostgresStorage) isLimitMet(ctx context.Context, tx *sql.Tx, userID int64, month *now.Now) (bool, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "db_isLimitMet")
 	defer span.Finish()
 
@@ -129,25 +349,55 @@ func (s *PostgresStorage) isLimitMet(ctx context.Context, tx *sql.Tx, userID int
 		(
 			SELECT sum(e.amount) AS s, u.month_limit AS lim FROM expenses e
 			JOIN users u ON u.id = e.user_id
-			WHERE e.user_id = $1 AND e.created_at > $2 AND e.created_at < $3
+			WHERE e.user_id = $1 AND e.created_at >= $2 AND e.created_at <= $3
 			GROUP BY u.month_limit
 		) AS total
 `
 	var test bool
 	err := tx.QueryRowContext(ctx, query,
-		userID, now.BeginningOfMonth(), now.EndOfMonth()).
+		userID, month.BeginningOfMonth(), month.EndOfMonth()).
 		Scan(&test)
+	if errors.Is(err, sql.ErrNoRows) {
+		// no expenses in the month
+		return true, nil
+	}
 	if err != nil {
 		return false, errors.Wrap(err, "ensure limit")
 	}
 	return test, nil
 }
 
+type limitSettings struct {
+	// loc is the location of user's timezone, month limits are evaluated in it
+	loc   *time.Location
+	limit money.Amount
+	soft  bool
+}
+
+func (s *PostgresStorage) limitSettings(ctx context.Context, tx *sql.Tx, userID int64) (limitSettings, error) {
+	var rec user.Record
+	var tz string
+	err := psql.Select("COALESCE(timezone, '')", "COALESCE(month_limit, 0)", "soft_limit").
+		From("users").
+		Where(sq.Eq{"id": userID}).
+		RunWith(tx).QueryRowContext(ctx).
+		Scan(&tz, &rec.MonthLimit, &rec.SoftLimit)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return limitSettings{}, err
+	}
+	rec.SetTimezone(tz)
+	return limitSettings{
+		loc:   rec.LocationOrDefault(s.defaultLocation),
+		limit: rec.MonthLimit,
+		soft:  rec.SoftLimit,
+	}, nil
+}
+
 func (s *PostgresStorage) GetUserExpenses(ctx context.Context, userID int64) ([]user.ExpenseRecord, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getUserExpenses")
 	defer span.Finish()
 
-	query := psql.Select("amount", "category", "created_at").
+	query := psql.Select(expenseColumns...).
 		From("expenses").
 		Where(sq.Eq{"user_id": userID})
 
@@ -165,7 +415,7 @@ func (s *PostgresStorage) GetUserExpenses(ctx context.Context, userID int64) ([]
 	exps := make([]user.ExpenseRecord, 0)
 	for rows.Next() {
 		var e user.ExpenseRecord
-		err = rows.Scan(&e.Amount, &e.Category, &e.Created)
+		e, err = scanExpense(rows)
 		if err != nil {
 			return nil, errors.Wrap(err, "get expenses")
 		}
@@ -178,45 +428,179 @@ func (s *PostgresStorage) GetUserExpenses(ctx context.Context, userID int64) ([]
 	return exps, nil
 }
 
+// GetExpense returns the expense of the user, NotFoundError if there is no such expense.
+func (s *PostgresStorage) GetExpense(ctx context.Context, userID int64, expenseID int64) (user.ExpenseRecord, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getExpense")
+	defer span.Finish()
+
+	query := psql.Select(expenseColumns...).
+		From("expenses").
+		Where(sq.Eq{"id": expenseID, "user_id": userID})
+
+	res, err := scanExpense(query.RunWith(s.db).QueryRowContext(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		return user.ExpenseRecord{}, &customerr.NotFoundError{Err: fmt.Sprintf("expense %d not found", expenseID)}
+	}
+	return res, errors.Wrap(err, "get expense")
+}
+
+// GetExpensesPage returns filtered user expenses, the most recent first.
+func (s *PostgresStorage) GetExpensesPage(ctx context.Context, userID int64, filter user.ExpenseFilter,
+	offset, limit uint64) ([]user.ExpenseRecord, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getExpensesPage")
+	defer span.Finish()
+
+	rows, err := expensesPageQuery(userID, filter, offset, limit).RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get expenses page")
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	exps := make([]user.ExpenseRecord, 0, limit)
+	for rows.Next() {
+		var e user.ExpenseRecord
+		e, err = scanExpense(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "get expenses page")
+		}
+		exps = append(exps, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "get expenses page")
+	}
+
+	return exps, nil
+}
+
+// expensesPageQuery selects the page of filtered user expenses, the category is matched along with
+// its subcategories regardless of case, as in reports.
+func expensesPageQuery(userID int64, filter user.ExpenseFilter, offset, limit uint64) sq.SelectBuilder {
+	query := psql.Select(expenseColumns...).
+		From("expenses").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("created_at DESC", "id DESC").
+		Offset(offset).
+		Limit(limit)
+	if !filter.From.IsZero() {
+		query = query.Where(sq.GtOrEq{"created_at": filter.From})
+	}
+	if !filter.To.IsZero() {
+		query = query.Where(sq.Lt{"created_at": filter.To})
+	}
+	if filter.Category != "" {
+		query = query.Where(categoryMatch("category", filter.Category))
+	}
+	if filter.Tag != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM expense_tags t WHERE t.expense_id = expenses.id AND t.tag = ?)",
+			strings.ToLower(filter.Tag))
+	}
+	return query
+}
+
 func (s *PostgresStorage) GetRate(ctx context.Context, name string) (currency.Rate, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getRate")
 	defer span.Finish()
 
-	query := psql.Select("name", "base_rate", "is_set", "updated_at").
+	query := psql.Select("name", "base_rate", "is_set", "updated_at", "source").
 		From("rates").
-		Where(sq.Eq{"name": name}).
+		Where(sq.Eq{"name": name, "is_set": true}).
 		OrderBy("updated_at DESC").
 		Limit(1)
 
 	var res currency.Rate
-	err := query.RunWith(s.db).QueryRowContext(ctx).Scan(&res.Name, &res.BaseRate, &res.Set, &res.UpdatedAt)
+	err := query.RunWith(s.db).QueryRowContext(ctx).Scan(&res.Name, &res.BaseRate, &res.Set, &res.UpdatedAt, &res.Source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return currency.Rate{}, fmt.Errorf("rate %s is not set yet", name)
+	}
 	if err != nil {
 		return currency.Rate{}, err
 	}
-	if !res.Set {
-		return currency.Rate{}, fmt.Errorf("rate %s is not set yet", name)
+	return res, nil
+}
+
+// GetRateAt returns the latest rate known at the given moment.
+func (s *PostgresStorage) GetRateAt(ctx context.Context, name string, at time.Time) (currency.Rate, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getRateAt")
+	defer span.Finish()
+
+	query := psql.Select("name", "base_rate", "is_set", "updated_at", "source").
+		From("rates").
+		Where(sq.Eq{"name": name, "is_set": true}).
+		Where(sq.LtOrEq{"updated_at": at}).
+		OrderBy("updated_at DESC").
+		Limit(1)
+
+	var res currency.Rate
+	err := query.RunWith(s.db).QueryRowContext(ctx).Scan(&res.Name, &res.BaseRate, &res.Set, &res.UpdatedAt, &res.Source)
+	if err != nil {
+		return currency.Rate{}, errors.Wrap(err, "get rate at")
 	}
 	return res, nil
 }
 
-func (s *PostgresStorage) NewRate(ctx context.Context, name string) error {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "db_newRate")
+// UpdateRateValue saves the current rate value pulled from the named source.
+func (s *PostgresStorage) UpdateRateValue(ctx context.Context, name string, val float64, source string) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_updateRateValue")
 	defer span.Finish()
 
 	query := psql.Insert("rates").
-		Columns("name", "base_rate", "is_set").
-		Values(name, 0, false)
+		Columns("name", "base_rate", "is_set", "source").
+		Values(name, val, true, source)
 	_, err := query.RunWith(s.db).ExecContext(ctx)
-	return errors.Wrap(err, "new rate")
+	return errors.Wrap(err, "update rate")
 }
 
-func (s *PostgresStorage) UpdateRateValue(ctx context.Context, name string, val float64) error {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "db_updateRateValue")
+// GetRatesBetween returns the rates known from the given moment inclusive to the other one exclusive,
+// the earliest first.
+func (s *PostgresStorage) GetRatesBetween(ctx context.Context, name string, from, to time.Time) ([]currency.Rate, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getRatesBetween")
+	defer span.Finish()
+
+	query := psql.Select("name", "base_rate", "is_set", "updated_at", "source").
+		From("rates").
+		Where(sq.Eq{"name": name, "is_set": true}).
+		Where(sq.GtOrEq{"updated_at": from}).
+		Where(sq.Lt{"updated_at": to}).
+		OrderBy("updated_at")
+
+	rows, err := query.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get rates between")
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	res := make([]currency.Rate, 0)
+	for rows.Next() {
+		var r currency.Rate
+		if err = rows.Scan(&r.Name, &r.BaseRate, &r.Set, &r.UpdatedAt, &r.Source); err != nil {
+			return nil, errors.Wrap(err, "get rates between")
+		}
+		res = append(res, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "get rates between")
+	}
+	return res, nil
+}
+
+// SaveRateAt saves the rate value known at the given moment, e.g. a historical one.
+func (s *PostgresStorage) SaveRateAt(ctx context.Context, name string, val float64, source string, at time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_saveRateAt")
 	defer span.Finish()
 
 	query := psql.Insert("rates").
-		Columns("name", "base_rate", "is_set").
-		Values(name, val, true)
+		Columns("name", "base_rate", "is_set", "updated_at", "source").
+		Values(name, val, true, at, source)
 	_, err := query.RunWith(s.db).ExecContext(ctx)
-	return errors.Wrap(err, "update rate")
+	return errors.Wrap(err, "save rate at")
 }
@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"max.ks1230/finances-bot/internal/entity/user"
+)
+
+func Test_OnExpensesPage_ShouldMatchSubcategoriesOfCategory(t *testing.T) {
+	sqlStr, args, err := expensesPageQuery(123, user.ExpenseFilter{Category: "Food"}, 0, 10).ToSql()
+
+	assert.NoError(t, err)
+	assert.Contains(t, sqlStr, "WHERE user_id = $1 AND (lower(category) = $2 OR left(lower(category), 5) = $3)")
+	assert.Equal(t, []any{int64(123), "food", "food/"}, args)
+}
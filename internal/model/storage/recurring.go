@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+	"max.ks1230/finances-bot/internal/logger"
+	"max.ks1230/finances-bot/internal/model/customerr"
+)
+
+var recurringColumns = []string{"id", "user_id", "category", "amount", "currency", "schedule", "next_run_at"}
+
+type recurringSnapshot struct {
+	ID       int64        `json:"id"`
+	UserID   int64        `json:"userId"`
+	Category string       `json:"category"`
+	Amount   money.Amount `json:"amount"`
+	Currency string       `json:"currency"`
+	Schedule string       `json:"schedule"`
+	NextRun  time.Time    `json:"nextRun"`
+}
+
+// recurringSnapshotOf maps the recurring expense to its journaled state field by field.
+func recurringSnapshotOf(r user.RecurringExpense) recurringSnapshot {
+	return recurringSnapshot{
+		ID:       r.ID,
+		UserID:   r.UserID,
+		Category: r.Category,
+		Amount:   r.Amount,
+		Currency: r.Currency,
+		Schedule: r.Schedule,
+		NextRun:  r.NextRun,
+	}
+}
+
+func scanRecurring(row scanner) (user.RecurringExpense, error) {
+	var r user.RecurringExpense
+	err := row.Scan(&r.ID, &r.UserID, &r.Category, &r.Amount, &r.Currency, &r.Schedule, &r.NextRun)
+	return r, err
+}
+
+// SaveRecurring adds a new recurring expense of the user.
+func (s *PostgresStorage) SaveRecurring(ctx context.Context, userID int64, rec user.RecurringExpense) (id int64, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_saveRecurring")
+	defer span.Finish()
+
+	query := psql.Insert("recurring_expenses").
+		Columns("user_id", "category", "amount", "currency", "schedule", "next_run_at").
+		Values(userID, rec.Category, rec.Amount, rec.Currency, rec.Schedule, rec.NextRun).
+		Suffix("RETURNING id")
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "save recurring")
+	}
+	defer rollbackOnError(tx, &err)
+
+	err = query.RunWith(tx).QueryRowContext(ctx).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "save recurring")
+	}
+	if err = registerCategory(ctx, tx, userID, rec.Category); err != nil {
+		return 0, errors.Wrap(err, "save recurring")
+	}
+	err = recordAction(ctx, tx, userID, actionRecurringAdded, recurringSnapshot{ID: id})
+	if err != nil {
+		return 0, errors.Wrap(err, "save recurring")
+	}
+	err = tx.Commit()
+	return id, err
+}
+
+// GetRecurring returns all recurring expenses of the user.
+func (s *PostgresStorage) GetRecurring(ctx context.Context, userID int64) ([]user.RecurringExpense, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getRecurring")
+	defer span.Finish()
+
+	query := psql.Select(recurringColumns...).
+		From("recurring_expenses").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("id")
+	return s.queryRecurring(ctx, query)
+}
+
+// GetDueRecurring returns recurring expenses of all users which next run is not after the moment, the most overdue first.
+func (s *PostgresStorage) GetDueRecurring(ctx context.Context, at time.Time, limit uint64) ([]user.RecurringExpense, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_getDueRecurring")
+	defer span.Finish()
+
+	query := psql.Select(recurringColumns...).
+		From("recurring_expenses").
+		Where(sq.LtOrEq{"next_run_at": at}).
+		OrderBy("next_run_at", "id").
+		Limit(limit)
+	return s.queryRecurring(ctx, query)
+}
+
+func (s *PostgresStorage) queryRecurring(ctx context.Context, query sq.SelectBuilder) ([]user.RecurringExpense, error) {
+	rows, err := query.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get recurring")
+	}
+	defer func() {
+		rowErr := rows.Close()
+		if rowErr != nil {
+			logger.Error("error closing rows", zap.Error(rowErr))
+		}
+	}()
+
+	res := make([]user.RecurringExpense, 0)
+	for rows.Next() {
+		var r user.RecurringExpense
+		r, err = scanRecurring(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "get recurring")
+		}
+		res = append(res, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "get recurring")
+	}
+	return res, nil
+}
+
+// DeleteRecurring deletes the recurring expense of the user, expenses it has already saved are kept.
+func (s *PostgresStorage) DeleteRecurring(ctx context.Context, userID int64, id int64) (err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_deleteRecurring")
+	defer span.Finish()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "delete recurring")
+	}
+	defer rollbackOnError(tx, &err)
+
+	prev, err := scanRecurring(psql.Select(recurringColumns...).
+		From("recurring_expenses").
+		Where(sq.Eq{"id": id, "user_id": userID}).
+		Suffix("FOR UPDATE").
+		RunWith(tx).QueryRowContext(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		return &customerr.NotFoundError{Err: fmt.Sprintf("recurring expense %d not found", id)}
+	}
+	if err != nil {
+		return errors.Wrap(err, "delete recurring")
+	}
+
+	_, err = psql.Delete("recurring_expenses").
+		Where(sq.Eq{"id": id, "user_id": userID}).
+		RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "delete recurring")
+	}
+	err = recordAction(ctx, tx, userID, actionRecurringDeleted, recurringSnapshotOf(prev))
+	if err != nil {
+		return errors.Wrap(err, "delete recurring")
+	}
+	err = tx.Commit()
+	return err
+}
+
+// ScheduleRecurring moves the next run of the recurring expense from the due moment to the next one.
+// Nothing is changed if the run has already been moved, e.g. by another instance.
+func (s *PostgresStorage) ScheduleRecurring(ctx context.Context, id int64, due, next time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_scheduleRecurring")
+	defer span.Finish()
+
+	_, err := psql.Update("recurring_expenses").
+		Set("next_run_at", next).
+		Where(sq.Eq{"id": id, "next_run_at": due}).
+		RunWith(s.db).ExecContext(ctx)
+	return errors.Wrap(err, "schedule recurring")
+}
+
+// claimRecurringRun marks the run of the recurring expense due at the moment as done by the expense.
+// It returns customerr.AlreadyExistsError if the run is already done.
+func claimRecurringRun(ctx context.Context, tx *sql.Tx, recurringID int64, due time.Time, expenseID int64) error {
+	res, err := psql.Insert("recurring_runs").
+		Columns("recurring_id", "due_at", "expense_id").
+		Values(recurringID, due, expenseID).
+		Suffix("ON CONFLICT DO NOTHING").
+		RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		return &customerr.AlreadyExistsError{Err: fmt.Sprintf("recurring expense %d is already saved for %s", recurringID, due)}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// CompactRates deletes rates updated before the given moment except the last one of every currency per day.
+// Only the rates since the day of the previous cutoff are considered, the older ones are compacted already;
+// a zero previous cutoff considers all of them. Unset rates left by older versions are deleted as well.
+// It returns the number of deleted rates.
+func (s *PostgresStorage) CompactRates(ctx context.Context, after, before time.Time) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_compactRates")
+	defer span.Finish()
+
+	res, err := compactRatesQuery(after, before).RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "compact rates")
+	}
+	deleted, err := res.RowsAffected()
+	return deleted, errors.Wrap(err, "compact rates")
+}
+
+// compactRatesQuery deletes the rates of the window but the last one of every currency per day, days are taken
+// in UTC, the same for every currency. The window starts with the day of the previous cutoff, as the day was
+// not over by it and its kept rate is compared with the later ones.
+func compactRatesQuery(after, before time.Time) sq.DeleteBuilder {
+	window := sq.And{sq.Lt{"updated_at": before}}
+	if !after.IsZero() {
+		window = append(window, sq.GtOrEq{"updated_at": compactionDay(after)})
+	}
+	ranked := sq.Select("id", "row_number() OVER (PARTITION BY name, date_trunc('day', updated_at AT TIME ZONE 'UTC') "+
+		"ORDER BY updated_at DESC, id DESC) AS rn").
+		From("rates").
+		Where(window).
+		Where(sq.Eq{"is_set": true})
+	superseded := sq.Select("id").
+		FromSelect(ranked, "t").
+		Where(sq.Gt{"rn": 1})
+
+	return psql.Delete("rates").
+		Where(window).
+		Where(sq.Or{sq.Eq{"is_set": false}, sq.Expr("id IN (?)", superseded)})
+}
+
+// compactionDay returns the start of the UTC day of the moment.
+func compactionDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnCompactRates_ShouldKeepLastRateOfEveryDayBeforeCutoff(t *testing.T) {
+	before := time.Date(2022, 11, 2, 15, 30, 0, 0, time.UTC)
+
+	sqlStr, args, err := compactRatesQuery(time.Time{}, before).ToSql()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM rates WHERE (updated_at < $1) AND (is_set = $2 OR id IN ("+
+		"SELECT id FROM (SELECT id, row_number() OVER (PARTITION BY name, date_trunc('day', updated_at AT TIME ZONE 'UTC') "+
+		"ORDER BY updated_at DESC, id DESC) AS rn FROM rates WHERE (updated_at < $3) AND is_set = $4) AS t WHERE rn > $5))",
+		sqlStr)
+	assert.Equal(t, []any{before, false, before, true, 1}, args)
+}
+
+func Test_OnCompactRates_ShouldConsiderRatesSinceDayOfPreviousCutoff(t *testing.T) {
+	after := time.Date(2022, 11, 1, 15, 30, 0, 0, time.FixedZone("MSK", 3*60*60))
+	before := after.AddDate(0, 0, 1)
+	dayStart := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	sqlStr, args, err := compactRatesQuery(after, before).ToSql()
+
+	assert.NoError(t, err)
+	assert.Contains(t, sqlStr, "WHERE (updated_at < $1 AND updated_at >= $2) AND (is_set = $3")
+	assert.Equal(t, []any{before, dayStart, false, before, dayStart, true, 1}, args)
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+)
+
+type transferSnapshot struct {
+	ID int64 `json:"id"`
+}
+
+type transferEntry struct {
+	accountID int64
+	amount    money.Amount
+}
+
+// transferEntries returns the signed entries of the transfer balances of its accounts sum:
+// the sent amount is negative and the received one is positive.
+func transferEntries(t user.Transfer) []transferEntry {
+	return []transferEntry{
+		{accountID: t.FromAccountID, amount: -t.Amount},
+		{accountID: t.ToAccountID, amount: t.Received},
+	}
+}
+
+// SaveTransfer saves the transfer as a linked pair of entries,
+// the sent amount is taken from the source account and the received one is added to the destination.
+func (s *PostgresStorage) SaveTransfer(ctx context.Context, userID int64, t user.Transfer) (id int64, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_saveTransfer")
+	defer span.Finish()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "save transfer")
+	}
+	defer rollbackOnError(tx, &err)
+
+	err = psql.Insert("transfers").
+		Columns("user_id", "rate", "created_at").
+		Values(userID, t.Rate, t.Created).
+		Suffix("RETURNING id").
+		RunWith(tx).QueryRowContext(ctx).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "save transfer")
+	}
+
+	query := psql.Insert("transfer_entries").
+		Columns("transfer_id", "account_id", "amount")
+	for _, e := range transferEntries(t) {
+		query = query.Values(id, e.accountID, e.amount)
+	}
+	_, err = query.RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "save transfer")
+	}
+
+	err = recordAction(ctx, tx, userID, actionTransferAdded, transferSnapshot{ID: id})
+	if err != nil {
+		return 0, errors.Wrap(err, "save transfer")
+	}
+	err = tx.Commit()
+	return id, err
+}
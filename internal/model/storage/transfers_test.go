@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"max.ks1230/finances-bot/internal/entity/money"
+	"max.ks1230/finances-bot/internal/entity/user"
+)
+
+// stubRow scans its values as a database row would
+type stubRow []any
+
+func (r stubRow) Scan(dest ...any) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("%d columns scanned into %d destinations", len(r), len(dest))
+	}
+	for i, v := range r {
+		switch d := dest[i].(type) {
+		case *int64:
+			*d = v.(int64)
+		case *string:
+			*d = v.(string)
+		case *bool:
+			*d = v.(bool)
+		case sql.Scanner:
+			if err := d.Scan(v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected destination %T", d)
+		}
+	}
+	return nil
+}
+
+// accountRow returns the row of accountColumns with sums of operations of the account
+func accountRow(acc user.Account, income, spent string, entries []transferEntry) stubRow {
+	var transferred money.Amount
+	for _, e := range entries {
+		if e.accountID == acc.ID {
+			transferred += e.amount
+		}
+	}
+	return stubRow{acc.ID, acc.Name, acc.Currency, acc.StartingBalance.String(), false, income, spent,
+		transferred.String()}
+}
+
+func Test_OnTransfer_ShouldChangeBalancesOfBothAccounts(t *testing.T) {
+	cash := user.Account{ID: 1, Name: "cash", Currency: "RUB", StartingBalance: money.Amount(10000000)}
+	card := user.Account{ID: 2, Name: "card", Currency: "USD", StartingBalance: money.Amount(500000)}
+
+	entries := transferEntries(user.Transfer{
+		FromAccountID: cash.ID,
+		Amount:        money.Amount(6250000),
+		ToAccountID:   card.ID,
+		Received:      money.Amount(100000),
+	})
+
+	from, err := scanAccount(accountRow(cash, "200", "50.5", entries))
+	assert.NoError(t, err)
+	to, err := scanAccount(accountRow(card, "0", "1.25", entries))
+	assert.NoError(t, err)
+
+	assert.Equal(t, money.Amount(5245000), from.Balance)
+	assert.Equal(t, money.Amount(587500), to.Balance)
+	assert.Equal(t, len(accountColumns), len(accountRow(cash, "0", "0", nil)))
+}
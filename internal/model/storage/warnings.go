@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jinzhu/now"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"max.ks1230/finances-bot/internal/entity/money"
+)
+
+// FireLimitWarnings returns thresholds (percentages of month limit) reached by user's spending in the month
+// of the given moment and whether the budget of the category is exceeded then, for users in soft limit mode only.
+// Every threshold is returned once per month, it is considered fired afterwards.
+// An exceeded budget is reported every time, as hard limit mode rejects every exceeding expense.
+func (s *PostgresStorage) FireLimitWarnings(ctx context.Context, userID int64, category string, at time.Time,
+	thresholds []int) (fired []int, overBudget bool, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "db_fireLimitWarnings")
+	defer span.Finish()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "fire limit warnings")
+	}
+	defer rollbackOnError(tx, &err)
+
+	settings, err := s.limitSettings(ctx, tx, userID)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "fire limit warnings")
+	}
+	if !settings.soft {
+		err = tx.Commit()
+		return nil, false, err
+	}
+	month := now.With(at.In(settings.loc))
+
+	budgetMet, err := s.isBudgetMet(ctx, tx, userID, category, month)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "fire limit warnings")
+	}
+	if settings.limit == 0 {
+		err = tx.Commit()
+		return nil, !budgetMet, err
+	}
+
+	spent, err := monthSpending(ctx, tx, userID, month)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "fire limit warnings")
+	}
+	percent := spent.Float() / settings.limit.Float() * 100
+
+	for _, threshold := range thresholds {
+		if percent < float64(threshold) {
+			continue
+		}
+		var ok bool
+		ok, err = markWarningFired(ctx, tx, userID, month.BeginningOfMonth(), threshold)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "fire limit warnings")
+		}
+		if ok {
+			fired = append(fired, threshold)
+		}
+	}
+
+	err = tx.Commit()
+	return fired, !budgetMet, err
+}
+
+func monthSpending(ctx context.Context, tx *sql.Tx, userID int64, month *now.Now) (money.Amount, error) {
+	query := `
+	SELECT COALESCE(sum(amount), 0) FROM expenses
+	WHERE user_id = $1 AND created_at >= $2 AND created_at <= $3
+`
+	var res money.Amount
+	err := tx.QueryRowContext(ctx, query, userID, month.BeginningOfMonth(), month.EndOfMonth()).Scan(&res)
+	return res, err
+}
+
+// markWarningFired returns false if the warning has already been fired for the month.
+func markWarningFired(ctx context.Context, tx *sql.Tx, userID int64, month time.Time, threshold int) (bool, error) {
+	query := psql.Insert("limit_warnings").
+		Columns("user_id", "month", "threshold").
+		Values(userID, month, threshold).
+		Suffix("ON CONFLICT DO NOTHING")
+
+	res, err := query.RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
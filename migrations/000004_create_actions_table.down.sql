@@ -0,0 +1 @@
+DROP TABLE IF EXISTS actions;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS actions(
+    id serial PRIMARY KEY,
+    user_id bigint,
+    kind VARCHAR(32),
+    payload JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- B-Tree index on (user_id, id)
+-- actions are always retrieved for a single user, most recent first
+CREATE INDEX idx_actions_user_id ON actions (user_id, id DESC);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS budgets(
+    user_id bigint,
+    category VARCHAR(255),
+    amount real,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+
+    PRIMARY KEY (user_id, category),
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
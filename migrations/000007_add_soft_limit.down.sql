@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS limit_warnings;
+ALTER TABLE users DROP COLUMN IF EXISTS soft_limit;
\ No newline at end of file
@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS soft_limit BOOLEAN NOT NULL DEFAULT false;
+
+-- thresholds of month limit user was warned about, every one is fired once per month
+CREATE TABLE IF NOT EXISTS limit_warnings(
+    user_id bigint,
+    month DATE,
+    threshold INT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+
+    PRIMARY KEY (user_id, month, threshold),
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
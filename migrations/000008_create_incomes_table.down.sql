@@ -0,0 +1 @@
+DROP TABLE IF EXISTS incomes;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS incomes(
+    id serial PRIMARY KEY,
+    user_id bigint,
+    amount REAL,
+    source VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Hash index on user_id column, the same way as for expenses
+CREATE INDEX idx_incomes_user_id ON incomes USING HASH (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE expenses
+    DROP COLUMN IF EXISTS original_amount,
+    DROP COLUMN IF EXISTS currency,
+    DROP COLUMN IF EXISTS rate;
\ No newline at end of file
@@ -0,0 +1,8 @@
+ALTER TABLE expenses
+    ADD COLUMN IF NOT EXISTS original_amount REAL NULL,
+    ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NULL,
+    ADD COLUMN IF NOT EXISTS rate REAL NULL;
+
+-- the currency existing expenses were typed in is lost,
+-- they are considered typed in the base currency (empty one)
+UPDATE expenses SET original_amount = amount, currency = '', rate = 1 WHERE original_amount IS NULL;
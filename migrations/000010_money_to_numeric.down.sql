@@ -0,0 +1,12 @@
+ALTER TABLE budgets ALTER COLUMN amount TYPE REAL;
+
+ALTER TABLE incomes ALTER COLUMN amount TYPE REAL;
+
+ALTER TABLE rates ALTER COLUMN base_rate TYPE REAL;
+
+ALTER TABLE users ALTER COLUMN month_limit TYPE REAL;
+
+ALTER TABLE expenses
+    ALTER COLUMN amount TYPE REAL,
+    ALTER COLUMN original_amount TYPE REAL,
+    ALTER COLUMN rate TYPE REAL;
@@ -0,0 +1,17 @@
+-- money amounts are kept exactly with 2 minor digits, rates keep their full precision
+ALTER TABLE expenses
+    ALTER COLUMN amount TYPE NUMERIC(17, 2) USING round(amount::numeric, 2),
+    ALTER COLUMN original_amount TYPE NUMERIC(17, 2) USING round(original_amount::numeric, 2),
+    ALTER COLUMN rate TYPE NUMERIC USING rate::numeric;
+
+ALTER TABLE users
+    ALTER COLUMN month_limit TYPE NUMERIC(17, 2) USING round(month_limit::numeric, 2);
+
+ALTER TABLE rates
+    ALTER COLUMN base_rate TYPE NUMERIC USING base_rate::numeric;
+
+ALTER TABLE incomes
+    ALTER COLUMN amount TYPE NUMERIC(17, 2) USING round(amount::numeric, 2);
+
+ALTER TABLE budgets
+    ALTER COLUMN amount TYPE NUMERIC(17, 2) USING round(amount::numeric, 2);
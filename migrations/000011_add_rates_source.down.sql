@@ -0,0 +1 @@
+ALTER TABLE rates DROP COLUMN IF EXISTS source;
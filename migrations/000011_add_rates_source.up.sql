@@ -0,0 +1,2 @@
+-- the source of rates pulled before is unknown and left empty
+ALTER TABLE rates ADD COLUMN IF NOT EXISTS source VARCHAR(16) NOT NULL DEFAULT '';
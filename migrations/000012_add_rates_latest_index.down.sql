@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_rates_name_updated_at;
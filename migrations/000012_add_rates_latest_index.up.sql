@@ -0,0 +1,2 @@
+-- the latest rate of a currency is looked up on every conversion
+CREATE INDEX IF NOT EXISTS idx_rates_name_updated_at ON rates (name, updated_at DESC);
@@ -0,0 +1,8 @@
+ALTER TABLE incomes
+    DROP COLUMN IF EXISTS account_id,
+    DROP COLUMN IF EXISTS currency,
+    DROP COLUMN IF EXISTS original_amount;
+
+ALTER TABLE expenses DROP COLUMN IF EXISTS account_id;
+
+DROP TABLE IF EXISTS accounts;
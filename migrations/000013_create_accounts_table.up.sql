@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS accounts(
+    id serial PRIMARY KEY,
+    user_id bigint,
+    name VARCHAR(255),
+    currency VARCHAR(3),
+    starting_balance NUMERIC(17, 2) DEFAULT 0,
+    is_default BOOLEAN DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- account names are unique per user regardless of case
+CREATE UNIQUE INDEX idx_accounts_user_name ON accounts (user_id, lower(name));
+
+ALTER TABLE expenses
+    ADD COLUMN IF NOT EXISTS account_id integer NULL REFERENCES accounts(id) ON DELETE SET NULL;
+
+ALTER TABLE incomes
+    ADD COLUMN IF NOT EXISTS original_amount NUMERIC(17, 2) NULL,
+    ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NULL,
+    ADD COLUMN IF NOT EXISTS account_id integer NULL REFERENCES accounts(id) ON DELETE SET NULL;
+
+-- existing incomes are considered typed in the base currency (empty one)
+UPDATE incomes SET original_amount = amount, currency = '' WHERE original_amount IS NULL;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS transfers(
+    id serial PRIMARY KEY,
+    user_id bigint,
+    -- rate is the effective one, received amount per sent one
+    rate NUMERIC,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- every transfer is a linked pair of entries: a negative one on the source account
+-- and a positive one on the destination, both in their accounts currencies
+CREATE TABLE IF NOT EXISTS transfer_entries(
+    id serial PRIMARY KEY,
+    transfer_id integer,
+    account_id integer,
+    amount NUMERIC(17, 2),
+
+    CONSTRAINT fk_transfer FOREIGN KEY(transfer_id) REFERENCES transfers(id) ON DELETE CASCADE,
+    CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES accounts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfer_entries_account ON transfer_entries (account_id);
@@ -0,0 +1,12 @@
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS note TEXT NOT NULL DEFAULT '';
+
+-- tags are kept lowercase, so they are matched regardless of case
+CREATE TABLE IF NOT EXISTS expense_tags(
+    expense_id integer,
+    tag VARCHAR(64),
+
+    PRIMARY KEY (expense_id, tag),
+    CONSTRAINT fk_expense FOREIGN KEY(expense_id) REFERENCES expenses(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_expense_tags_tag ON expense_tags (tag);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS recurring_expenses(
+    id serial PRIMARY KEY,
+    user_id bigint,
+    category VARCHAR(255),
+    amount NUMERIC(17, 2),
+    currency VARCHAR(3),
+    schedule VARCHAR(255),
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- due recurring expenses of all users are looked up every minute
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_next_run ON recurring_expenses (next_run_at);
+
+-- every run saves at most one expense, so runs repeated after a restart are skipped
+CREATE TABLE IF NOT EXISTS recurring_runs(
+    recurring_id integer,
+    due_at TIMESTAMP WITH TIME ZONE,
+    expense_id integer NULL,
+
+    PRIMARY KEY (recurring_id, due_at),
+    CONSTRAINT fk_recurring FOREIGN KEY(recurring_id) REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+    CONSTRAINT fk_expense FOREIGN KEY(expense_id) REFERENCES expenses(id) ON DELETE SET NULL
+);
@@ -0,0 +1,62 @@
+CREATE TABLE IF NOT EXISTS categories(
+    id serial PRIMARY KEY,
+    user_id bigint,
+    name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- categories are matched regardless of case
+CREATE UNIQUE INDEX idx_categories_user_name ON categories (user_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS category_aliases(
+    id serial PRIMARY KEY,
+    user_id bigint,
+    category_id integer,
+    alias VARCHAR(255),
+
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_category FOREIGN KEY(category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_category_aliases_user_alias ON category_aliases (user_id, lower(alias));
+
+-- existing categories differing only in case are registered under their most used spelling
+INSERT INTO categories (user_id, name)
+SELECT user_id, category FROM (
+    SELECT user_id, category,
+        row_number() OVER (PARTITION BY user_id, lower(category) ORDER BY count(*) DESC, category) AS rank
+    FROM expenses
+    WHERE category IS NOT NULL
+    GROUP BY user_id, category
+) spellings
+WHERE rank = 1;
+
+INSERT INTO categories (user_id, name)
+SELECT DISTINCT user_id, category FROM budgets
+ON CONFLICT DO NOTHING;
+
+INSERT INTO categories (user_id, name)
+SELECT DISTINCT user_id, category FROM recurring_expenses
+ON CONFLICT DO NOTHING;
+
+-- and the other spellings are rewritten to it
+UPDATE expenses e SET category = c.name
+FROM categories c
+WHERE c.user_id = e.user_id AND lower(c.name) = lower(e.category) AND c.name <> e.category;
+
+UPDATE recurring_expenses r SET category = c.name
+FROM categories c
+WHERE c.user_id = r.user_id AND lower(c.name) = lower(r.category) AND c.name <> r.category;
+
+-- one budget is kept per category: the one of the kept spelling or else the first one
+DELETE FROM budgets b
+USING budgets d, categories c
+WHERE d.user_id = b.user_id AND lower(d.category) = lower(b.category) AND d.category <> b.category
+    AND c.user_id = b.user_id AND lower(c.name) = lower(b.category) AND c.name <> b.category
+    AND (d.category = c.name OR d.category < b.category);
+
+UPDATE budgets b SET category = c.name
+FROM categories c
+WHERE c.user_id = b.user_id AND lower(c.name) = lower(b.category) AND c.name <> b.category;
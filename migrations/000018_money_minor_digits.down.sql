@@ -0,0 +1,22 @@
+ALTER TABLE recurring_expenses
+    ALTER COLUMN amount TYPE NUMERIC(17, 2) USING round(amount, 2);
+
+ALTER TABLE transfer_entries
+    ALTER COLUMN amount TYPE NUMERIC(17, 2) USING round(amount, 2);
+
+ALTER TABLE accounts
+    ALTER COLUMN starting_balance TYPE NUMERIC(17, 2) USING round(starting_balance, 2);
+
+ALTER TABLE budgets
+    ALTER COLUMN amount TYPE NUMERIC(17, 2) USING round(amount, 2);
+
+ALTER TABLE incomes
+    ALTER COLUMN amount TYPE NUMERIC(17, 2) USING round(amount, 2),
+    ALTER COLUMN original_amount TYPE NUMERIC(17, 2) USING round(original_amount, 2);
+
+ALTER TABLE users
+    ALTER COLUMN month_limit TYPE NUMERIC(17, 2) USING round(month_limit, 2);
+
+ALTER TABLE expenses
+    ALTER COLUMN amount TYPE NUMERIC(17, 2) USING round(amount, 2),
+    ALTER COLUMN original_amount TYPE NUMERIC(17, 2) USING round(original_amount, 2);
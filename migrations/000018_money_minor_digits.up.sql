@@ -0,0 +1,23 @@
+-- money amounts keep 4 minor digits, the most of ISO 4217 currencies, like CLF
+ALTER TABLE expenses
+    ALTER COLUMN amount TYPE NUMERIC(18, 4),
+    ALTER COLUMN original_amount TYPE NUMERIC(18, 4);
+
+ALTER TABLE users
+    ALTER COLUMN month_limit TYPE NUMERIC(18, 4);
+
+ALTER TABLE incomes
+    ALTER COLUMN amount TYPE NUMERIC(18, 4),
+    ALTER COLUMN original_amount TYPE NUMERIC(18, 4);
+
+ALTER TABLE budgets
+    ALTER COLUMN amount TYPE NUMERIC(18, 4);
+
+ALTER TABLE accounts
+    ALTER COLUMN starting_balance TYPE NUMERIC(18, 4);
+
+ALTER TABLE transfer_entries
+    ALTER COLUMN amount TYPE NUMERIC(18, 4);
+
+ALTER TABLE recurring_expenses
+    ALTER COLUMN amount TYPE NUMERIC(18, 4);
@@ -0,0 +1,7 @@
+-- expenses keep the recurring expense that saved them, so the link survives deleting and restoring them
+ALTER TABLE expenses
+    ADD COLUMN IF NOT EXISTS recurring_id integer NULL REFERENCES recurring_expenses(id) ON DELETE SET NULL;
+
+UPDATE expenses e SET recurring_id = r.recurring_id
+FROM recurring_runs r
+WHERE r.expense_id = e.id;
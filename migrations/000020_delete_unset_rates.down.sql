@@ -0,0 +1 @@
+-- the placeholders are not needed, there is nothing to restore
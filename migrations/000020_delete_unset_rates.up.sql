@@ -0,0 +1,2 @@
+-- placeholders of rates not pulled yet are not inserted anymore, they hid the rates pulled before restarts
+DELETE FROM rates WHERE NOT is_set;